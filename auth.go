@@ -0,0 +1,151 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+const (
+	accessTokenLifetime  = 15 * time.Minute
+	refreshTokenLifetime = 30 * 24 * time.Hour
+	refreshCookieName    = "RefreshToken"
+	// refreshCookiePath keeps browsers from sending the refresh token
+	// anywhere but the auth endpoints.
+	refreshCookiePath = "/auth"
+)
+
+var (
+	ErrRefreshTokenInvalid = errors.New("invalid refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token used twice, every session of that login has been signed out")
+)
+
+// randomToken returns size random bytes encoded for use in a cookie.
+func randomToken(size int) (string, error) {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// hashRefreshToken is how refresh tokens are stored, so that a leaked table
+// holds nothing that can be presented to the server. The tokens are random,
+// so an unsalted SHA-256 suffices.
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// startSession signs username in with a new token family, the chain of
+// refresh tokens rotated from this login.
+func (u *UserServer) startSession(w http.ResponseWriter, username string) error {
+	family, err := randomToken(16)
+	if err != nil {
+		return err
+	}
+
+	refreshToken, err := randomToken(32)
+	if err != nil {
+		return err
+	}
+
+	if err := u.store.CreateRefreshToken(username, family, hashRefreshToken(refreshToken), time.Now().Add(refreshTokenLifetime)); err != nil {
+		return err
+	}
+
+	return setSessionCookies(w, username, refreshToken)
+}
+
+func setSessionCookies(w http.ResponseWriter, username, refreshToken string) error {
+	accessToken, err := generateJWTToken(username)
+	if err != nil {
+		return err
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     "Authorization",
+		Value:    accessToken,
+		Path:     "/",
+		MaxAge:   int(accessTokenLifetime.Seconds()),
+		Secure:   false,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name:     refreshCookieName,
+		Value:    refreshToken,
+		Path:     refreshCookiePath,
+		MaxAge:   int(refreshTokenLifetime.Seconds()),
+		Secure:   false,
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	})
+
+	return nil
+}
+
+func clearSessionCookies(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{Name: "Authorization", Path: "/", MaxAge: -1, HttpOnly: true})
+	http.SetCookie(w, &http.Cookie{Name: refreshCookieName, Path: refreshCookiePath, MaxAge: -1, HttpOnly: true})
+}
+
+// refreshSession trades the refresh token for a new access token and a new
+// refresh token. Each refresh token works once, presenting one again revokes
+// its whole family, as either the user or whoever stole it holds a copy.
+func (u *UserServer) refreshSession(w http.ResponseWriter, r *http.Request) {
+	cookie, err := r.Cookie(refreshCookieName)
+	if err != nil {
+		http.Error(w, fmt.Sprint(ErrRefreshTokenInvalid), http.StatusUnauthorized)
+		return
+	}
+
+	refreshToken, err := randomToken(32)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	username, err := u.store.RotateRefreshToken(hashRefreshToken(cookie.Value), hashRefreshToken(refreshToken), now, now.Add(refreshTokenLifetime))
+	if err != nil {
+		if errors.Is(err, ErrRefreshTokenInvalid) || errors.Is(err, ErrRefreshTokenReused) {
+			clearSessionCookies(w)
+			http.Error(w, fmt.Sprint(err), http.StatusUnauthorized)
+			return
+		}
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := setSessionCookies(w, username, refreshToken); err != nil {
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// logout revokes the family of the refresh token presented, the access
+// token in use expires on its own shortly.
+func (u *UserServer) logout(w http.ResponseWriter, r *http.Request) {
+	if cookie, err := r.Cookie(refreshCookieName); err == nil {
+		if err := u.store.RevokeRefreshTokens(hashRefreshToken(cookie.Value)); err != nil {
+			log.Println(err)
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	clearSessionCookies(w)
+	w.WriteHeader(http.StatusAccepted)
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestRefreshTokens(t *testing.T) {
+	store := NewInMemoryUserStore()
+	server := NewUserServer(store)
+
+	password, _ := bcrypt.GenerateFromPassword([]byte("nostromo"), bcrypt.MinCost)
+	store.CreateUser("Ellen", "ellen@test", string(password))
+
+	cookies := func(response *httptest.ResponseRecorder) map[string]*http.Cookie {
+		found := map[string]*http.Cookie{}
+		for _, cookie := range response.Result().Cookies() {
+			found[cookie.Name] = cookie
+		}
+		return found
+	}
+
+	login := func(t testing.TB) map[string]*http.Cookie {
+		t.Helper()
+
+		request, _ := http.NewRequest(http.MethodPost, "/login", bytes.NewBufferString(`{"username": "Ellen", "password": "nostromo"}`))
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+		assertStatus(t, response.Code, http.StatusAccepted)
+
+		return cookies(response)
+	}
+
+	refresh := func(refreshToken string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest(http.MethodPost, "/auth/refresh", nil)
+		if refreshToken != "" {
+			request.AddCookie(&http.Cookie{Name: refreshCookieName, Value: refreshToken})
+		}
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+		return response
+	}
+
+	t.Run("issues a short-lived access token and a refresh token", func(t *testing.T) {
+		session := login(t)
+
+		access := session["Authorization"]
+		assertEqual(t, access.MaxAge, int(accessTokenLifetime.Seconds()))
+
+		claims, err := parseJWTToken(access.Value)
+		assertNoError(t, err)
+		if lifetime := time.Until(claims.ExpiresAt.Time); lifetime > accessTokenLifetime {
+			t.Errorf("access token lives for %v, want at most %v", lifetime, accessTokenLifetime)
+		}
+
+		assertEqual(t, session[refreshCookieName].HttpOnly, true)
+		assertEqual(t, session[refreshCookieName].Path, refreshCookiePath)
+	})
+	t.Run("rotates refresh tokens", func(t *testing.T) {
+		first := login(t)[refreshCookieName].Value
+
+		response := refresh(first)
+		assertStatus(t, response.Code, http.StatusAccepted)
+
+		rotated := cookies(response)
+		if rotated[refreshCookieName].Value == first {
+			t.Error("got the same refresh token back")
+		}
+
+		request, _ := http.NewRequest(http.MethodGet, "/timeline", nil)
+		request.AddCookie(rotated["Authorization"])
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+		assertStatus(t, response.Code, http.StatusOK)
+
+		assertStatus(t, refresh(rotated[refreshCookieName].Value).Code, http.StatusAccepted)
+	})
+	t.Run("rejects missing and unknown refresh tokens", func(t *testing.T) {
+		assertStatus(t, refresh("").Code, http.StatusUnauthorized)
+		assertStatus(t, refresh("forged").Code, http.StatusUnauthorized)
+	})
+	t.Run("revokes the family when a refresh token is reused", func(t *testing.T) {
+		first := login(t)[refreshCookieName].Value
+		other := login(t)[refreshCookieName].Value
+
+		second := cookies(refresh(first))[refreshCookieName].Value
+
+		response := refresh(first)
+		assertStatus(t, response.Code, http.StatusUnauthorized)
+		assertError(t, response.Body.String(), ErrRefreshTokenReused.Error()+"\n")
+		assertEqual(t, cookies(response)[refreshCookieName].MaxAge, -1)
+
+		assertStatus(t, refresh(second).Code, http.StatusUnauthorized)
+		assertStatus(t, refresh(other).Code, http.StatusAccepted)
+	})
+	t.Run("revokes the family on logout", func(t *testing.T) {
+		token := login(t)[refreshCookieName].Value
+
+		request, _ := http.NewRequest(http.MethodPost, "/auth/logout", nil)
+		request.AddCookie(&http.Cookie{Name: refreshCookieName, Value: token})
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+		assertStatus(t, response.Code, http.StatusAccepted)
+		assertEqual(t, cookies(response)["Authorization"].MaxAge, -1)
+
+		assertStatus(t, refresh(token).Code, http.StatusUnauthorized)
+	})
+	t.Run("rejects expired refresh tokens", func(t *testing.T) {
+		assertNoError(t, store.CreateRefreshToken("Ellen", "family", hashRefreshToken("stale"), time.Now().Add(-time.Minute)))
+
+		_, err := store.RotateRefreshToken(hashRefreshToken("stale"), hashRefreshToken("fresh"), time.Now(), time.Now().Add(time.Hour))
+		if !errors.Is(err, ErrRefreshTokenInvalid) {
+			t.Errorf("got error %v, want %v", err, ErrRefreshTokenInvalid)
+		}
+	})
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+var ErrBlobNotFound = errors.New("blob not found")
+
+// BlobStore keeps the bytes of uploaded files under keys chosen by the
+// server. LocalBlobStore keeps them on disk and MemoryBlobStore in memory,
+// which suits tests.
+type BlobStore interface {
+	Put(key string, data []byte) error
+	// Get returns ErrBlobNotFound when nothing is stored under key.
+	Get(key string) ([]byte, error)
+	Delete(key string) error
+}
+
+// WithBlobStore makes the server keep uploads in blobs instead of memory.
+func WithBlobStore(blobs BlobStore) ServerOption {
+	return func(u *UserServer) {
+		u.blobs = blobs
+	}
+}
+
+// LocalBlobStore keeps every blob in a file named after its key in one
+// directory.
+type LocalBlobStore struct {
+	dir string
+}
+
+// NewLocalBlobStore creates dir if it does not exist yet.
+func NewLocalBlobStore(dir string) (*LocalBlobStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("NewLocalBlobStore: %w", err)
+	}
+
+	return &LocalBlobStore{dir: dir}, nil
+}
+
+// path maps key to its file, refusing keys that would leave the directory.
+func (l *LocalBlobStore) path(key string) (string, error) {
+	if key == "" || key == "." || key == ".." || filepath.Base(key) != key {
+		return "", fmt.Errorf("invalid blob key %q", key)
+	}
+
+	return filepath.Join(l.dir, key), nil
+}
+
+// Put writes data to a temporary file first and renames it into place, so
+// a blob is never seen half written.
+func (l *LocalBlobStore) Put(key string, data []byte) error {
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(l.dir, ".upload-*")
+	if err != nil {
+		return fmt.Errorf("Put: %w", err)
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return fmt.Errorf("Put: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("Put: %w", err)
+	}
+
+	if err := os.Rename(file.Name(), path); err != nil {
+		return fmt.Errorf("Put: %w", err)
+	}
+
+	return nil
+}
+
+func (l *LocalBlobStore) Get(key string) ([]byte, error) {
+	path, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrBlobNotFound
+		}
+		return nil, fmt.Errorf("Get: %w", err)
+	}
+
+	return data, nil
+}
+
+func (l *LocalBlobStore) Delete(key string) error {
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("Delete: %w", err)
+	}
+
+	return nil
+}
+
+type MemoryBlobStore struct {
+	mu    sync.RWMutex
+	blobs map[string][]byte
+}
+
+func NewMemoryBlobStore() *MemoryBlobStore {
+	return &MemoryBlobStore{blobs: map[string][]byte{}}
+}
+
+func (m *MemoryBlobStore) Put(key string, data []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.blobs[key] = append([]byte(nil), data...)
+	return nil
+}
+
+func (m *MemoryBlobStore) Get(key string) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	data, ok := m.blobs[key]
+	if !ok {
+		return nil, ErrBlobNotFound
+	}
+	return data, nil
+}
+
+func (m *MemoryBlobStore) Delete(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.blobs, key)
+	return nil
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLocalBlobStore(t *testing.T) {
+	blobs, err := NewLocalBlobStore(t.TempDir())
+	assertNoError(t, err)
+
+	t.Run("stores, returns and deletes blobs", func(t *testing.T) {
+		assertNoError(t, blobs.Put("photo", []byte("pixels")))
+
+		data, err := blobs.Get("photo")
+		assertNoError(t, err)
+		assertEqual(t, string(data), "pixels")
+
+		assertNoError(t, blobs.Delete("photo"))
+		_, err = blobs.Get("photo")
+		assertEqual(t, errors.Is(err, ErrBlobNotFound), true)
+	})
+	t.Run("refuses keys leaving its directory", func(t *testing.T) {
+		for _, key := range []string{"", "..", "../photo", "dir/photo"} {
+			if err := blobs.Put(key, []byte("pixels")); err == nil {
+				t.Errorf("stored blob under key %q", key)
+			}
+		}
+	})
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// allowedToInteract answers the request with 403 and returns false when
+// user and other block each other.
+func (u *UserServer) allowedToInteract(w http.ResponseWriter, user, other string) bool {
+	blocked, err := u.store.IsBlocked(user, other)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return false
+	}
+
+	if blocked {
+		http.Error(w, fmt.Sprintf("you cannot interact with %s", other), http.StatusForbidden)
+		return false
+	}
+
+	return true
+}
+
+// changeRelation applies change between the acting user and user {name}.
+func (u *UserServer) changeRelation(change func(name, other string) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := userFromContext(r.Context())
+		other := r.PathValue("name")
+
+		if user.Username == other {
+			http.Error(w, "you cannot do that to yourself", http.StatusBadRequest)
+			return
+		}
+
+		if _, err := u.store.GetUserByUsername(other); err != nil {
+			http.Error(w, fmt.Sprint(err), http.StatusNotFound)
+			return
+		}
+
+		if err := change(user.Username, other); err != nil {
+			log.Println(err)
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+// showRelation lists the users list returns for the acting user.
+func (u *UserServer) showRelation(list func(name string) ([]User, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		users, err := list(userFromContext(r.Context()).Username)
+		if err != nil {
+			log.Println(err)
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", jsonContentType)
+
+		if err := json.NewEncoder(w).Encode(newPublicUsers(users)); err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBlocks(t *testing.T) {
+	store := NewInMemoryUserStore()
+	server := NewUserServer(store)
+
+	store.CreateUser("Luke", "luke@test", "")
+	store.CreateUser("Vader", "vader@test", "")
+	store.CreateUser("Leia", "leia@test", "")
+	lukeID, _ := store.PostSqueak("Luke", "I'll never join you")
+	store.PostSqueak("Vader", "I am your father")
+	store.FollowUser("Vader", "Luke")
+
+	lukeToken, _ := generateJWTToken("Luke")
+	vaderToken, _ := generateJWTToken("Vader")
+
+	t.Run("it requires authentication", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newRelationRequest(http.MethodPost, "Vader", "block", ""))
+
+		assertStatus(t, response.Code, http.StatusUnauthorized)
+	})
+	t.Run("Luke blocks Vader", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newRelationRequest(http.MethodPost, "Vader", "block", lukeToken))
+		assertStatus(t, response.Code, http.StatusAccepted)
+
+		request, _ := http.NewRequest(http.MethodGet, "/me/blocked", nil)
+		request.Header.Set("Cookie", "Authorization="+lukeToken)
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+		assertUsernames(t, getUsersFromResponse(t, response.Body), []string{"Vader"})
+
+		following, _ := store.GetFollowing("Vader")
+		assertEqual(t, len(following), 0)
+	})
+	t.Run("the blocked account cannot follow, reply, like or message", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newFollowRequest(http.MethodPost, "Luke", vaderToken))
+		assertStatus(t, response.Code, http.StatusForbidden)
+
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, newReplyRequest(lukeID, []byte(`{"text": "Search your feelings"}`), vaderToken))
+		assertStatus(t, response.Code, http.StatusForbidden)
+
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, newLikeRequest(http.MethodPut, lukeID, vaderToken))
+		assertStatus(t, response.Code, http.StatusForbidden)
+
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, newConversationRequest(http.MethodPost, "", []byte(`{"participants": ["Luke"]}`), vaderToken))
+		assertStatus(t, response.Code, http.StatusForbidden)
+	})
+	t.Run("the blocked account cannot mention", func(t *testing.T) {
+		store.PostSqueak("Vader", "Join me @Luke")
+
+		got, err := store.GetMentioningSqueaks("Luke", 0, 10)
+		assertNoError(t, err)
+		assertEqual(t, len(got), 0)
+	})
+	t.Run("hides content both ways", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		request := newGetSqueakRequest("Vader")
+		request.Header.Set("Cookie", "Authorization="+lukeToken)
+		server.ServeHTTP(response, request)
+		assertEqual(t, len(getUserSqueaksFromResponse(t, response.Body)), 0)
+
+		response = httptest.NewRecorder()
+		request = newGetSqueakRequest("Luke")
+		request.Header.Set("Cookie", "Authorization="+vaderToken)
+		server.ServeHTTP(response, request)
+		assertEqual(t, len(getUserSqueaksFromResponse(t, response.Body)), 0)
+
+		response = httptest.NewRecorder()
+		request = newUserbaseRequest()
+		request.Header.Set("Cookie", "Authorization="+vaderToken)
+		server.ServeHTTP(response, request)
+		for _, user := range getUserbaseFromResponse(t, response.Body) {
+			if user.Username == "Luke" {
+				t.Error("userbase shows Luke to Vader")
+			}
+		}
+
+		response = httptest.NewRecorder()
+		request, _ = http.NewRequest(http.MethodGet, "/squeaks/1/thread", nil)
+		request.Header.Set("Cookie", "Authorization="+vaderToken)
+		server.ServeHTTP(response, request)
+		assertStatus(t, response.Code, http.StatusNotFound)
+	})
+	t.Run("unblocking shows content again", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newRelationRequest(http.MethodDelete, "Vader", "block", lukeToken))
+		assertStatus(t, response.Code, http.StatusAccepted)
+
+		response = httptest.NewRecorder()
+		request := newGetSqueakRequest("Vader")
+		request.Header.Set("Cookie", "Authorization="+lukeToken)
+		server.ServeHTTP(response, request)
+		assertEqual(t, len(getUserSqueaksFromResponse(t, response.Body)), 2)
+	})
+}
+
+func TestMutes(t *testing.T) {
+	store := NewInMemoryUserStore()
+	server := NewUserServer(store)
+
+	store.CreateUser("Luke", "luke@test", "")
+	store.CreateUser("Threepio", "threepio@test", "")
+	store.PostSqueak("Luke", "I'll never join you")
+	store.PostSqueak("Threepio", "We're doomed")
+	store.FollowUser("Luke", "Threepio")
+	store.FollowUser("Threepio", "Luke")
+
+	lukeToken, _ := generateJWTToken("Luke")
+	threepioToken, _ := generateJWTToken("Threepio")
+
+	response := httptest.NewRecorder()
+	server.ServeHTTP(response, newRelationRequest(http.MethodPost, "Threepio", "mute", lukeToken))
+	assertStatus(t, response.Code, http.StatusAccepted)
+
+	t.Run("hides the muted account from the muter", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newTimelineRequest("", lukeToken))
+
+		page := getSqueakPageFromResponse(t, response.Body)
+		assertSqueaks(t, page.Squeaks, []SqueakPost{{Text: "I'll never join you"}})
+	})
+	t.Run("does not hide the muter from the muted account", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newTimelineRequest("", threepioToken))
+
+		page := getSqueakPageFromResponse(t, response.Body)
+		assertEqual(t, len(page.Squeaks), 2)
+	})
+	t.Run("keeps the next cursor when squeaks are hidden", func(t *testing.T) {
+		store.PostSqueak("Threepio", "Sir, the odds")
+		store.PostSqueak("Threepio", "are approximately")
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newTimelineRequest("", lukeToken))
+
+		page := getSqueakPageFromResponse(t, response.Body)
+		assertEqual(t, len(page.Squeaks), 0)
+		if page.NextCursor == "" {
+			t.Fatal("expected a next cursor")
+		}
+
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, newTimelineRequest(page.NextCursor, lukeToken))
+
+		page = getSqueakPageFromResponse(t, response.Body)
+		assertSqueaks(t, page.Squeaks, []SqueakPost{{Text: "I'll never join you"}})
+	})
+	t.Run("unmuting shows the account again", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newRelationRequest(http.MethodDelete, "Threepio", "mute", lukeToken))
+		assertStatus(t, response.Code, http.StatusAccepted)
+
+		muted, err := store.GetMutedUsers("Luke")
+		assertNoError(t, err)
+		assertEqual(t, len(muted), 0)
+	})
+}
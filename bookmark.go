@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Bookmark is a squeak a user saved for later. Bookmarks are private to the
+// user who saved them. A squeak deleted after it was saved is shown as a
+// tombstone.
+type Bookmark struct {
+	ID        int        `json:"id"`
+	CreatedAt time.Time  `json:"createdAt"`
+	Squeak    SqueakPost `json:"squeak"`
+}
+
+// BookmarkPage is one page of bookmarks, most recently saved first, paged
+// by bookmark ID like SqueakPage.
+type BookmarkPage struct {
+	Bookmarks  []Bookmark `json:"bookmarks"`
+	NextCursor string     `json:"nextCursor,omitempty"`
+}
+
+func newBookmarkPage(bookmarks []Bookmark, limit int) BookmarkPage {
+	page := BookmarkPage{Bookmarks: bookmarks}
+	if page.Bookmarks == nil {
+		page.Bookmarks = []Bookmark{}
+	}
+
+	if len(bookmarks) > limit {
+		page.Bookmarks = bookmarks[:limit]
+		page.NextCursor = strconv.Itoa(bookmarks[limit-1].ID)
+	}
+
+	return page
+}
+
+func (u *UserServer) bookmarkSqueak(w http.ResponseWriter, r *http.Request) {
+	user := userFromContext(r.Context())
+
+	id, err := squeakIDFromPath(r)
+	if err != nil {
+		http.Error(w, fmt.Sprint(err), http.StatusBadRequest)
+		return
+	}
+
+	squeak, err := u.store.GetSqueak(id)
+	if err != nil {
+		if errors.Is(err, ErrSqueakNotFound) {
+			http.Error(w, fmt.Sprint(err), http.StatusNotFound)
+			return
+		}
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if !u.visibleTo(w, user.Username, squeak) || !u.allowedToInteract(w, user.Username, squeak.Author) {
+		return
+	}
+
+	if err := u.store.BookmarkSqueak(user.Username, id); err != nil {
+		if errors.Is(err, ErrSqueakNotFound) {
+			http.Error(w, fmt.Sprint(err), http.StatusNotFound)
+			return
+		}
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// unbookmarkSqueak removes a bookmark, also when its squeak has been deleted
+// in the meantime.
+func (u *UserServer) unbookmarkSqueak(w http.ResponseWriter, r *http.Request) {
+	user := userFromContext(r.Context())
+
+	id, err := squeakIDFromPath(r)
+	if err != nil {
+		http.Error(w, fmt.Sprint(err), http.StatusBadRequest)
+		return
+	}
+
+	if err := u.store.UnbookmarkSqueak(user.Username, id); err != nil {
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (u *UserServer) showBookmarks(w http.ResponseWriter, r *http.Request) {
+	user := userFromContext(r.Context())
+
+	cursor, limit, err := parsePagination(r)
+	if err != nil {
+		http.Error(w, fmt.Sprint(err), http.StatusBadRequest)
+		return
+	}
+
+	bookmarks, err := u.store.GetBookmarks(user.Username, cursor, limit+1)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	page := newBookmarkPage(bookmarks, limit)
+
+	squeaks := make([]SqueakPost, len(page.Bookmarks))
+	for i, bookmark := range page.Bookmarks {
+		squeaks[i] = bookmark.Squeak
+	}
+
+	squeaks, err = u.prepareSqueaks(user, squeaks)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	prepared := make(map[int]SqueakPost, len(squeaks))
+	for _, squeak := range squeaks {
+		prepared[squeak.ID] = squeak
+	}
+
+	visible := page.Bookmarks[:0]
+	for _, bookmark := range page.Bookmarks {
+		if squeak, ok := prepared[bookmark.Squeak.ID]; ok {
+			bookmark.Squeak = squeak
+			visible = append(visible, bookmark)
+		}
+	}
+	page.Bookmarks = visible
+
+	w.Header().Set("Content-Type", jsonContentType)
+
+	if err := json.NewEncoder(w).Encode(page); err != nil {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+}
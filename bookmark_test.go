@@ -0,0 +1,106 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBookmarks(t *testing.T) {
+	store := NewInMemoryUserStore()
+	server := NewUserServer(store)
+
+	store.CreateUser("Luke", "luke@test", "")
+	store.CreateUser("Han", "han@test", "")
+	store.CreateUser("Leia", "leia@test", "")
+	store.CreateUser("Jabba", "jabba@test", "")
+	firstID, _ := store.PostSqueak("Han", "Never tell me the odds")
+	secondID, _ := store.PostSqueak("Han", "I know")
+	thirdID, _ := store.PostSqueak("Han", "Laugh it up, fuzzball")
+	protectedID, _ := store.PostSqueak("Leia", "Help me, Obi-Wan Kenobi")
+	store.UpdateProfile("Leia", User{Protected: true})
+	blockingID, _ := store.PostSqueak("Jabba", "Bring me Solo")
+	store.BlockUser("Jabba", "Luke")
+
+	lukeToken, _ := generateJWTToken("Luke")
+	hanToken, _ := generateJWTToken("Han")
+
+	t.Run("it requires authentication", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newBookmarkRequest(http.MethodPut, firstID, ""))
+		assertStatus(t, response.Code, http.StatusUnauthorized)
+
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, newBookmarksRequest("", ""))
+		assertStatus(t, response.Code, http.StatusUnauthorized)
+	})
+	t.Run("returns 404 for an unknown squeak", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newBookmarkRequest(http.MethodPut, 99, lukeToken))
+		assertStatus(t, response.Code, http.StatusNotFound)
+	})
+	t.Run("only bookmarks squeaks the user may see", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newBookmarkRequest(http.MethodPut, protectedID, lukeToken))
+		assertStatus(t, response.Code, http.StatusNotFound)
+
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, newBookmarkRequest(http.MethodPut, blockingID, lukeToken))
+		assertStatus(t, response.Code, http.StatusForbidden)
+	})
+	t.Run("lists bookmarks most recently saved first", func(t *testing.T) {
+		for _, id := range []int{secondID, firstID, thirdID, firstID} {
+			response := httptest.NewRecorder()
+			server.ServeHTTP(response, newBookmarkRequest(http.MethodPut, id, lukeToken))
+			assertStatus(t, response.Code, http.StatusAccepted)
+		}
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newBookmarksRequest("", lukeToken))
+		assertStatus(t, response.Code, http.StatusOK)
+
+		page := getBookmarkPageFromResponse(t, response.Body)
+		assertEqual(t, len(page.Bookmarks), 2)
+		assertEqual(t, page.Bookmarks[0].Squeak.ID, thirdID)
+		assertEqual(t, page.Bookmarks[1].Squeak.ID, firstID)
+
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, newBookmarksRequest(page.NextCursor, lukeToken))
+
+		page = getBookmarkPageFromResponse(t, response.Body)
+		assertEqual(t, len(page.Bookmarks), 1)
+		assertEqual(t, page.Bookmarks[0].Squeak.ID, secondID)
+		assertEqual(t, page.NextCursor, "")
+	})
+	t.Run("bookmarks are private", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newBookmarksRequest("", hanToken))
+
+		page := getBookmarkPageFromResponse(t, response.Body)
+		assertEqual(t, len(page.Bookmarks), 0)
+	})
+	t.Run("deleted squeaks show up as tombstones", func(t *testing.T) {
+		assertNoError(t, store.DeleteSqueak(thirdID))
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newBookmarksRequest("", lukeToken))
+
+		page := getBookmarkPageFromResponse(t, response.Body)
+		assertEqual(t, page.Bookmarks[0].Squeak.ID, thirdID)
+		assertEqual(t, page.Bookmarks[0].Squeak.Unavailable, true)
+	})
+	t.Run("removes bookmarks, also of deleted squeaks", func(t *testing.T) {
+		for _, id := range []int{thirdID, firstID} {
+			response := httptest.NewRecorder()
+			server.ServeHTTP(response, newBookmarkRequest(http.MethodDelete, id, lukeToken))
+			assertStatus(t, response.Code, http.StatusAccepted)
+		}
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newBookmarksRequest("", lukeToken))
+
+		page := getBookmarkPageFromResponse(t, response.Body)
+		assertEqual(t, len(page.Bookmarks), 1)
+		assertEqual(t, page.Bookmarks[0].Squeak.ID, secondID)
+	})
+}
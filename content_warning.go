@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"unicode/utf8"
+)
+
+const maxContentWarningLength = 100
+
+// Preferences are per-account settings of how squeaks are shown.
+type Preferences struct {
+	// ExpandContentWarnings shows squeaks behind a content warning and
+	// sensitive media in full instead of collapsing them.
+	ExpandContentWarnings bool `json:"expandContentWarnings"`
+}
+
+// validateContentFlags checks the content warning of a squeak and that only
+// squeaks carrying media mark it as sensitive.
+func validateContentFlags(contentWarning string, sensitive, hasMedia bool) error {
+	if utf8.RuneCountInString(contentWarning) > maxContentWarningLength {
+		return fmt.Errorf("content warning must not be longer than %d characters", maxContentWarningLength)
+	}
+	if sensitive && !hasMedia {
+		return fmt.Errorf("only squeaks with media can be marked sensitive")
+	}
+	return nil
+}
+
+// collapseRequested reports whether the request asks the server to apply
+// the viewer's preferences, by passing applyPreferences=true, and whether
+// those want flagged squeaks collapsed. Anonymous viewers get them
+// collapsed.
+func (u *UserServer) collapseRequested(r *http.Request) (bool, error) {
+	apply, _ := strconv.ParseBool(r.URL.Query().Get("applyPreferences"))
+	if !apply {
+		return false, nil
+	}
+
+	viewer := userFromContext(r.Context())
+	if viewer == nil {
+		return true, nil
+	}
+
+	preferences, err := u.store.GetPreferences(viewer.Username)
+	if err != nil {
+		return false, err
+	}
+
+	return !preferences.ExpandContentWarnings, nil
+}
+
+// collapseFlagged hides what squeaks and their originals put behind a
+// content warning, everything but the warning itself, and their media when
+// it is sensitive.
+func collapseFlagged(squeaks []SqueakPost) {
+	for i := range squeaks {
+		collapse(&squeaks[i])
+		if original := squeaks[i].Original; original != nil && (original.ContentWarning != "" || original.Sensitive) {
+			copied := *original
+			collapse(&copied)
+			squeaks[i].Original = &copied
+		}
+	}
+}
+
+func collapse(squeak *SqueakPost) {
+	if squeak.ContentWarning != "" {
+		squeak.Text, squeak.Mentions, squeak.Poll, squeak.Media = "", nil, nil, nil
+		squeak.Collapsed = true
+	}
+	if squeak.Sensitive && len(squeak.Media) > 0 {
+		squeak.Media = nil
+		squeak.Collapsed = true
+	}
+}
+
+func (u *UserServer) showPreferences(w http.ResponseWriter, r *http.Request) {
+	preferences, err := u.store.GetPreferences(userFromContext(r.Context()).Username)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", jsonContentType)
+
+	if err := json.NewEncoder(w).Encode(preferences); err != nil {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (u *UserServer) updatePreferences(w http.ResponseWriter, r *http.Request) {
+	var preferences Preferences
+
+	if err := json.NewDecoder(r.Body).Decode(&preferences); err != nil {
+		http.Error(w, "failed to decode JSON payload", http.StatusBadRequest)
+		return
+	}
+
+	if err := u.store.UpdatePreferences(userFromContext(r.Context()).Username, preferences); err != nil {
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", jsonContentType)
+	w.WriteHeader(http.StatusAccepted)
+
+	if err := json.NewEncoder(w).Encode(preferences); err != nil {
+		log.Println(err)
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestContentWarnings(t *testing.T) {
+	store := NewInMemoryUserStore()
+	server := NewUserServer(store)
+
+	store.CreateUser("Ripley", "ripley@test", "")
+	store.CreateUser("Dallas", "dallas@test", "")
+
+	ripleyToken, _ := generateJWTToken("Ripley")
+	dallasToken, _ := generateJWTToken("Dallas")
+
+	showSqueaks := func(t testing.TB, query, token string) []SqueakPost {
+		t.Helper()
+
+		request, _ := http.NewRequest(http.MethodGet, "/users/Ripley"+query, nil)
+		if token != "" {
+			request.Header.Set("Cookie", "Authorization="+token)
+		}
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+		assertStatus(t, response.Code, http.StatusOK)
+
+		return getUserSqueaksFromResponse(t, response.Body)
+	}
+
+	t.Run("rejects long warnings and sensitive squeaks without media", func(t *testing.T) {
+		for _, body := range []string{
+			`{"text": "Chestburster", "contentWarning": "` + strings.Repeat("x", maxContentWarningLength+1) + `"}`,
+			`{"text": "Chestburster", "sensitive": true}`,
+		} {
+			response := httptest.NewRecorder()
+			server.ServeHTTP(response, newPostSqueakRequestWithJWT("Ripley", []byte(body), ripleyToken))
+			assertStatus(t, response.Code, http.StatusBadRequest)
+		}
+	})
+	t.Run("stores and returns content warnings", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newPostSqueakRequestWithJWT("Ripley", []byte(`{"text": "Kane did not make it", "contentWarning": "spoilers"}`), ripleyToken))
+		assertStatus(t, response.Code, http.StatusAccepted)
+		store.PostSqueak("Ripley", "Last survivor of the Nostromo")
+
+		squeaks := showSqueaks(t, "", "")
+		assertEqual(t, squeaks[0].ContentWarning, "spoilers")
+		assertEqual(t, squeaks[0].Text, "Kane did not make it")
+		assertEqual(t, squeaks[0].Collapsed, false)
+
+		var userbase []User
+		request := newUserbaseRequest()
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+		assertNoError(t, json.NewDecoder(response.Body).Decode(&userbase))
+		assertEqual(t, userbase[0].Squeaks[0].ContentWarning, "spoilers")
+	})
+	t.Run("collapses flagged squeaks for clients asking to apply preferences", func(t *testing.T) {
+		for _, token := range []string{"", dallasToken} {
+			squeaks := showSqueaks(t, "?applyPreferences=true", token)
+			assertEqual(t, squeaks[0].Collapsed, true)
+			assertEqual(t, squeaks[0].Text, "")
+			assertEqual(t, squeaks[0].ContentWarning, "spoilers")
+			assertEqual(t, squeaks[1].Collapsed, false)
+			assertEqual(t, squeaks[1].Text, "Last survivor of the Nostromo")
+		}
+
+		request, _ := http.NewRequest(http.MethodGet, "/userbase?applyPreferences=true", nil)
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+
+		var userbase []User
+		assertNoError(t, json.NewDecoder(response.Body).Decode(&userbase))
+		assertEqual(t, userbase[0].Squeaks[0].Collapsed, true)
+	})
+	t.Run("expands them for viewers preferring that", func(t *testing.T) {
+		request, _ := http.NewRequest(http.MethodPut, "/me/preferences", strings.NewReader(`{"expandContentWarnings": true}`))
+		request.Header.Set("Cookie", "Authorization="+dallasToken)
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+		assertStatus(t, response.Code, http.StatusAccepted)
+
+		request, _ = http.NewRequest(http.MethodGet, "/me/preferences", nil)
+		request.Header.Set("Cookie", "Authorization="+dallasToken)
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+
+		var preferences Preferences
+		assertNoError(t, json.NewDecoder(response.Body).Decode(&preferences))
+		assertEqual(t, preferences.ExpandContentWarnings, true)
+
+		squeaks := showSqueaks(t, "?applyPreferences=true", dallasToken)
+		assertEqual(t, squeaks[0].Collapsed, false)
+		assertEqual(t, squeaks[0].Text, "Kane did not make it")
+	})
+	t.Run("edits change the warning only when given", func(t *testing.T) {
+		id := showSqueaks(t, "", "")[0].ID
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newEditSqueakRequest(http.MethodPatch, id, []byte(`{"text": "Kane did not make it."}`), ripleyToken))
+		assertStatus(t, response.Code, http.StatusAccepted)
+		assertEqual(t, showSqueaks(t, "", "")[0].ContentWarning, "spoilers")
+
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, newEditSqueakRequest(http.MethodPatch, id, []byte(`{"text": "Kane did not make it.", "contentWarning": ""}`), ripleyToken))
+		assertStatus(t, response.Code, http.StatusAccepted)
+		assertEqual(t, showSqueaks(t, "", "")[0].ContentWarning, "")
+	})
+}
+
+func TestCollapseFlagged(t *testing.T) {
+	media := []Media{{ID: 1}}
+	squeaks := []SqueakPost{
+		{Text: "Facehugger close-up", Sensitive: true, Media: media},
+		{Text: "Quoting", Kind: KindQuote, Original: &SqueakPost{Text: "Spoiler", ContentWarning: "spoilers"}},
+	}
+	original := squeaks[1].Original
+
+	collapseFlagged(squeaks)
+
+	assertEqual(t, squeaks[0].Text, "Facehugger close-up")
+	assertEqual(t, len(squeaks[0].Media), 0)
+	assertEqual(t, squeaks[0].Collapsed, true)
+	assertEqual(t, squeaks[1].Collapsed, false)
+	assertEqual(t, squeaks[1].Original.Text, "")
+	assertEqual(t, squeaks[1].Original.Collapsed, true)
+	assertEqual(t, original.Text, "Spoiler")
+}
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+)
+
+const (
+	maxMessageLength = 1000
+	// maxConversationParticipants limits group conversations, the creator
+	// included.
+	maxConversationParticipants = 10
+)
+
+var ErrConversationNotFound = errors.New("conversation not found")
+
+// Participant is a member of a direct conversation. LastReadID is the ID of
+// the last message they have read, 0 when they have read none.
+type Participant struct {
+	UserID     int    `json:"userId"`
+	Username   string `json:"username"`
+	LastReadID int    `json:"lastReadId"`
+}
+
+// DirectMessage is a private message in a conversation. ReadBy lists the
+// other participants who have read it.
+type DirectMessage struct {
+	ID             int       `json:"id"`
+	ConversationID int       `json:"conversationId"`
+	SenderID       int       `json:"senderId"`
+	Sender         string    `json:"sender"`
+	Text           string    `json:"text"`
+	CreatedAt      time.Time `json:"createdAt"`
+	ReadBy         []string  `json:"readBy,omitempty"`
+}
+
+// DirectConversation is a private conversation between two or more users,
+// kept apart from public squeaks. UnreadCount is filled in for the user
+// listing their conversations.
+type DirectConversation struct {
+	ID           int            `json:"id"`
+	Participants []Participant  `json:"participants"`
+	LastMessage  *DirectMessage `json:"lastMessage,omitempty"`
+	UnreadCount  int            `json:"unreadCount"`
+	CreatedAt    time.Time      `json:"createdAt"`
+}
+
+// participant returns the participant with userID, or nil.
+func (c *DirectConversation) participant(userID int) *Participant {
+	for i := range c.Participants {
+		if c.Participants[i].UserID == userID {
+			return &c.Participants[i]
+		}
+	}
+	return nil
+}
+
+// MessagePage is one page of a conversation, newest message first,
+// paginated like SqueakPage.
+type MessagePage struct {
+	Messages   []DirectMessage `json:"messages"`
+	NextCursor string          `json:"nextCursor,omitempty"`
+}
+
+func newMessagePage(messages []DirectMessage, limit int) MessagePage {
+	page := MessagePage{Messages: messages}
+	if page.Messages == nil {
+		page.Messages = []DirectMessage{}
+	}
+
+	if len(messages) > limit {
+		page.Messages = messages[:limit]
+		page.NextCursor = strconv.Itoa(messages[limit-1].ID)
+	}
+
+	return page
+}
+
+const conversationContextKey contextKey = "conversation"
+
+// conversationFromContext returns the conversation that
+// requiresConversationParticipant stored in the request context.
+func conversationFromContext(ctx context.Context) *DirectConversation {
+	conversation, _ := ctx.Value(conversationContextKey).(*DirectConversation)
+	return conversation
+}
+
+// requiresConversationParticipant only lets participants of conversation
+// {id} through and stores the conversation in the request context. Others
+// are told the conversation does not exist, so its existence is not leaked.
+// It has to be wrapped in requiresAuthentication, which supplies the acting
+// user.
+func (u *UserServer) requiresConversationParticipant(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil || id < 1 {
+			http.Error(w, "invalid conversation id", http.StatusBadRequest)
+			return
+		}
+
+		conversation, err := u.store.GetDirectConversation(id)
+		if err != nil {
+			if errors.Is(err, ErrConversationNotFound) {
+				http.Error(w, fmt.Sprint(err), http.StatusNotFound)
+				return
+			}
+			log.Println(err)
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		if conversation.participant(userFromContext(r.Context()).ID) == nil {
+			http.Error(w, fmt.Sprint(ErrConversationNotFound), http.StatusNotFound)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), conversationContextKey, conversation)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func validateMessageText(text string) error {
+	if text == "" {
+		return errors.New("message text must not be empty")
+	}
+	if len([]rune(text)) > maxMessageLength {
+		return fmt.Errorf("message text must not be longer than %d characters", maxMessageLength)
+	}
+	return nil
+}
+
+// openConversation starts a conversation between the acting user and the
+// users listed in the request body. A one-to-one conversation that already
+// exists is returned instead of starting another.
+func (u *UserServer) openConversation(w http.ResponseWriter, r *http.Request) {
+	user := userFromContext(r.Context())
+
+	var body struct {
+		Participants []string `json:"participants"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "failed to decode JSON payload", http.StatusBadRequest)
+		return
+	}
+
+	var participants []string
+	for _, name := range body.Participants {
+		if name != user.Username && !slices.Contains(participants, name) {
+			participants = append(participants, name)
+		}
+	}
+
+	if len(participants) == 0 || len(participants)+1 > maxConversationParticipants {
+		http.Error(w, fmt.Sprintf("a conversation needs between 2 and %d participants", maxConversationParticipants), http.StatusBadRequest)
+		return
+	}
+
+	for _, name := range participants {
+		if _, err := u.store.GetUserByUsername(name); err != nil {
+			http.Error(w, fmt.Sprint(err), http.StatusNotFound)
+			return
+		}
+
+		if !u.allowedToInteract(w, user.Username, name) {
+			return
+		}
+	}
+
+	id, err := u.store.CreateDirectConversation(user.Username, participants)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	conversation, err := u.store.GetDirectConversation(id)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", jsonContentType)
+	w.WriteHeader(http.StatusAccepted)
+
+	if err := json.NewEncoder(w).Encode(conversation); err != nil {
+		log.Println(err)
+	}
+}
+
+func (u *UserServer) showConversations(w http.ResponseWriter, r *http.Request) {
+	user := userFromContext(r.Context())
+
+	conversations, err := u.store.GetDirectConversations(user.Username)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", jsonContentType)
+
+	if err := json.NewEncoder(w).Encode(conversations); err != nil {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (u *UserServer) showMessages(w http.ResponseWriter, r *http.Request) {
+	conversation := conversationFromContext(r.Context())
+
+	cursor, limit, err := parsePagination(r)
+	if err != nil {
+		http.Error(w, fmt.Sprint(err), http.StatusBadRequest)
+		return
+	}
+
+	messages, err := u.store.GetDirectMessages(conversation.ID, cursor, limit+1)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	for i, message := range messages {
+		for _, participant := range conversation.Participants {
+			if participant.UserID != message.SenderID && participant.LastReadID >= message.ID {
+				messages[i].ReadBy = append(messages[i].ReadBy, participant.Username)
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", jsonContentType)
+
+	if err := json.NewEncoder(w).Encode(newMessagePage(messages, limit)); err != nil {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (u *UserServer) sendMessage(w http.ResponseWriter, r *http.Request) {
+	user := userFromContext(r.Context())
+	conversation := conversationFromContext(r.Context())
+
+	var message DirectMessage
+
+	if err := json.NewDecoder(r.Body).Decode(&message); err != nil {
+		http.Error(w, "failed to decode JSON payload", http.StatusBadRequest)
+		return
+	}
+
+	if err := validateMessageText(message.Text); err != nil {
+		http.Error(w, fmt.Sprint(err), http.StatusBadRequest)
+		return
+	}
+
+	for _, participant := range conversation.Participants {
+		if participant.UserID != user.ID && !u.allowedToInteract(w, user.Username, participant.Username) {
+			return
+		}
+	}
+
+	id, err := u.store.PostDirectMessage(user.Username, conversation.ID, message.Text)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// The page before cursor id+1 starts with the new message.
+	messages, err := u.store.GetDirectMessages(conversation.ID, id+1, 1)
+	if err != nil || len(messages) == 0 {
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", jsonContentType)
+	w.WriteHeader(http.StatusAccepted)
+
+	if err := json.NewEncoder(w).Encode(messages[0]); err != nil {
+		log.Println(err)
+	}
+}
+
+// markConversationRead records that the acting user has read the
+// conversation up to the message with the ID in the request body, or up to
+// its latest message when the body names none.
+func (u *UserServer) markConversationRead(w http.ResponseWriter, r *http.Request) {
+	user := userFromContext(r.Context())
+	conversation := conversationFromContext(r.Context())
+
+	var body struct {
+		MessageID int `json:"messageId"`
+	}
+
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, "failed to decode JSON payload", http.StatusBadRequest)
+			return
+		}
+	}
+
+	messageID := body.MessageID
+	if messageID == 0 && conversation.LastMessage != nil {
+		messageID = conversation.LastMessage.ID
+	}
+
+	if err := u.store.MarkDirectMessagesRead(user.Username, conversation.ID, messageID); err != nil {
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
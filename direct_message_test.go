@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestDirectMessages(t *testing.T) {
+	store := NewInMemoryUserStore()
+	server := NewUserServer(store)
+
+	for _, name := range []string{"Mark", "Carrie", "Harrison", "Vader"} {
+		store.CreateUser(name, name+"@test", "")
+	}
+	store.BlockUser("Vader", "Mark")
+
+	markToken, _ := generateJWTToken("Mark")
+	carrieToken, _ := generateJWTToken("Carrie")
+	harrisonToken, _ := generateJWTToken("Harrison")
+
+	open := func(t *testing.T, token string, participants ...string) (int, DirectConversation) {
+		t.Helper()
+		body, _ := json.Marshal(map[string][]string{"participants": participants})
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newConversationRequest(http.MethodPost, "", body, token))
+
+		var conversation DirectConversation
+		if response.Code == http.StatusAccepted {
+			json.NewDecoder(response.Body).Decode(&conversation)
+		}
+		return response.Code, conversation
+	}
+
+	send := func(t *testing.T, id int, text, token string) int {
+		t.Helper()
+		body := []byte(fmt.Sprintf(`{"text": %q}`, text))
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newConversationRequest(http.MethodPost, fmt.Sprintf("/%d/messages", id), body, token))
+		return response.Code
+	}
+
+	t.Run("it requires authentication", func(t *testing.T) {
+		status, _ := open(t, "", "Carrie")
+		assertStatus(t, status, http.StatusUnauthorized)
+	})
+	t.Run("opens one conversation per pair", func(t *testing.T) {
+		status, first := open(t, markToken, "Carrie")
+		assertStatus(t, status, http.StatusAccepted)
+		assertEqual(t, len(first.Participants), 2)
+
+		_, second := open(t, carrieToken, "Mark")
+		assertEqual(t, second.ID, first.ID)
+
+		_, group := open(t, markToken, "Carrie", "Harrison")
+		if group.ID == first.ID {
+			t.Error("group conversation reused the one-to-one conversation")
+		}
+	})
+	t.Run("rejects invalid participants", func(t *testing.T) {
+		status, _ := open(t, markToken, "Mark")
+		assertStatus(t, status, http.StatusBadRequest)
+
+		status, _ = open(t, markToken, "Nobody")
+		assertStatus(t, status, http.StatusNotFound)
+	})
+	t.Run("blocked users cannot open a conversation", func(t *testing.T) {
+		status, _ := open(t, markToken, "Vader")
+		assertStatus(t, status, http.StatusForbidden)
+
+		status, _ = open(t, markToken, "Carrie", "Vader")
+		assertStatus(t, status, http.StatusForbidden)
+	})
+	t.Run("only participants can read and send messages", func(t *testing.T) {
+		_, conversation := open(t, markToken, "Carrie")
+
+		assertStatus(t, send(t, conversation.ID, "Help me, Obi-Wan", carrieToken), http.StatusAccepted)
+		assertStatus(t, send(t, conversation.ID, "I'm listening", harrisonToken), http.StatusNotFound)
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newConversationRequest(http.MethodGet, fmt.Sprintf("/%d/messages", conversation.ID), nil, harrisonToken))
+		assertStatus(t, response.Code, http.StatusNotFound)
+
+		assertStatus(t, send(t, 999, "Anyone?", markToken), http.StatusNotFound)
+		assertStatus(t, send(t, conversation.ID, "", markToken), http.StatusBadRequest)
+	})
+	t.Run("tracks unread messages and read receipts", func(t *testing.T) {
+		_, conversation := open(t, markToken, "Carrie")
+		send(t, conversation.ID, "You're my only hope", carrieToken)
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newConversationRequest(http.MethodGet, "", nil, markToken))
+		assertStatus(t, response.Code, http.StatusOK)
+
+		var conversations []DirectConversation
+		json.NewDecoder(response.Body).Decode(&conversations)
+		assertEqual(t, conversations[0].ID, conversation.ID)
+		assertEqual(t, conversations[0].UnreadCount, 2)
+		assertEqual(t, conversations[0].LastMessage.Text, "You're my only hope")
+
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, newConversationRequest(http.MethodPost, fmt.Sprintf("/%d/read", conversation.ID), nil, markToken))
+		assertStatus(t, response.Code, http.StatusAccepted)
+
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, newConversationRequest(http.MethodGet, fmt.Sprintf("/%d/messages?limit=1", conversation.ID), nil, carrieToken))
+		assertStatus(t, response.Code, http.StatusOK)
+
+		var page MessagePage
+		json.NewDecoder(response.Body).Decode(&page)
+		assertEqual(t, len(page.Messages), 1)
+		if !reflect.DeepEqual(page.Messages[0].ReadBy, []string{"Mark"}) {
+			t.Errorf("got read by %v, want Mark", page.Messages[0].ReadBy)
+		}
+		if page.NextCursor == "" {
+			t.Error("expected a next cursor")
+		}
+	})
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// maxScheduleAhead is how far in the future a squeak can be scheduled.
+	maxScheduleAhead = 365 * 24 * time.Hour
+	// schedulerInterval is how often RunScheduler looks for due squeaks, and
+	// so roughly how late they may be published.
+	schedulerInterval = 10 * time.Second
+	// schedulerBatch is how many due squeaks are published per transaction.
+	schedulerBatch = 50
+)
+
+var ErrDraftNotFound = errors.New("draft not found")
+
+// Draft is a squeak saved for later. It is scheduled when PublishAt is set,
+// and posted by the scheduler once that time has come. Drafts are private
+// to their author.
+type Draft struct {
+	ID        int        `json:"id"`
+	UserID    int        `json:"userId"`
+	Text      string     `json:"text"`
+	PublishAt *time.Time `json:"publishAt,omitempty"`
+	CreatedAt time.Time  `json:"createdAt"`
+	UpdatedAt time.Time  `json:"updatedAt"`
+}
+
+// validateDraft checks the text of a draft and that publishAt, when set,
+// lies between now and maxScheduleAhead from now.
+func validateDraft(text string, publishAt *time.Time, now time.Time) error {
+	if err := validateSqueakText(text); err != nil {
+		return err
+	}
+	if publishAt != nil && (!publishAt.After(now) || publishAt.Sub(now) > maxScheduleAhead) {
+		return fmt.Errorf("publishAt must be in the future, at most %s from now", maxScheduleAhead)
+	}
+	return nil
+}
+
+const draftContextKey contextKey = "draft"
+
+// draftFromContext returns the draft that requiresDraftAuthor stored in the
+// request context.
+func draftFromContext(ctx context.Context) *Draft {
+	draft, _ := ctx.Value(draftContextKey).(*Draft)
+	return draft
+}
+
+// requiresDraftAuthor only lets the author of draft {id} through and stores
+// the draft in the request context. Others are told the draft does not
+// exist. It has to be wrapped in requiresAuthentication.
+func (u *UserServer) requiresDraftAuthor(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil || id < 1 {
+			http.Error(w, "invalid draft id", http.StatusBadRequest)
+			return
+		}
+
+		draft, err := u.store.GetDraft(id)
+		if err != nil {
+			if errors.Is(err, ErrDraftNotFound) {
+				http.Error(w, fmt.Sprint(err), http.StatusNotFound)
+				return
+			}
+			log.Println(err)
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		if draft.UserID != userFromContext(r.Context()).ID {
+			http.Error(w, fmt.Sprint(ErrDraftNotFound), http.StatusNotFound)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), draftContextKey, draft)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// decodeDraft reads the text and publishAt of a draft from the request body,
+// answering with 400 and returning false when they are invalid.
+func decodeDraft(w http.ResponseWriter, r *http.Request) (string, *time.Time, bool) {
+	var body struct {
+		Text      string     `json:"text"`
+		PublishAt *time.Time `json:"publishAt"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "failed to decode JSON payload", http.StatusBadRequest)
+		return "", nil, false
+	}
+
+	if err := validateDraft(body.Text, body.PublishAt, time.Now()); err != nil {
+		http.Error(w, fmt.Sprint(err), http.StatusBadRequest)
+		return "", nil, false
+	}
+
+	return body.Text, body.PublishAt, true
+}
+
+func (u *UserServer) saveDraft(w http.ResponseWriter, r *http.Request) {
+	text, publishAt, ok := decodeDraft(w, r)
+	if !ok {
+		return
+	}
+
+	id, err := u.store.CreateDraft(userFromContext(r.Context()).Username, text, publishAt)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	u.respondWithDraft(w, id)
+}
+
+// editDraft replaces the text and publishAt of a draft, so leaving out
+// publishAt turns a scheduled squeak back into a plain draft.
+func (u *UserServer) editDraft(w http.ResponseWriter, r *http.Request) {
+	draft := draftFromContext(r.Context())
+
+	text, publishAt, ok := decodeDraft(w, r)
+	if !ok {
+		return
+	}
+
+	if err := u.store.UpdateDraft(draft.ID, text, publishAt); err != nil {
+		// The scheduler may have published it in the meantime.
+		if errors.Is(err, ErrDraftNotFound) {
+			http.Error(w, fmt.Sprint(err), http.StatusNotFound)
+			return
+		}
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	u.respondWithDraft(w, draft.ID)
+}
+
+func (u *UserServer) respondWithDraft(w http.ResponseWriter, id int) {
+	draft, err := u.store.GetDraft(id)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", jsonContentType)
+	w.WriteHeader(http.StatusAccepted)
+
+	if err := json.NewEncoder(w).Encode(draft); err != nil {
+		log.Println(err)
+	}
+}
+
+func (u *UserServer) cancelDraft(w http.ResponseWriter, r *http.Request) {
+	if err := u.store.DeleteDraft(draftFromContext(r.Context()).ID); err != nil {
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// showDrafts lists the acting user's drafts, only the scheduled ones or
+// only the unscheduled ones when the scheduled query parameter is given.
+func (u *UserServer) showDrafts(w http.ResponseWriter, r *http.Request) {
+	var scheduled *bool
+	if value := r.URL.Query().Get("scheduled"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			http.Error(w, "scheduled must be true or false", http.StatusBadRequest)
+			return
+		}
+		scheduled = &parsed
+	}
+
+	drafts, err := u.store.GetDrafts(userFromContext(r.Context()).Username)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if scheduled != nil {
+		filtered := drafts[:0]
+		for _, draft := range drafts {
+			if (draft.PublishAt != nil) == *scheduled {
+				filtered = append(filtered, draft)
+			}
+		}
+		drafts = filtered
+	}
+
+	w.Header().Set("Content-Type", jsonContentType)
+
+	if err := json.NewEncoder(w).Encode(drafts); err != nil {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// RunScheduler publishes scheduled squeaks once they are due, until ctx is
+// done. Schedules live in the store, so squeaks that fell due while no
+// server was running are published right at startup. Stores hand every due
+// squeak to only one caller, so any number of servers may run a scheduler.
+func (u *UserServer) RunScheduler(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		u.publishDueDrafts()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// publishDueDrafts publishes every scheduled squeak that is due and runs
+// what follows posting a squeak for each.
+func (u *UserServer) publishDueDrafts() {
+	for {
+		ids, err := u.store.PublishDueDrafts(time.Now(), schedulerBatch)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+
+		for _, id := range ids {
+			squeak, err := u.store.GetSqueak(id)
+			if err != nil {
+				log.Println(err)
+				continue
+			}
+			u.afterSqueakPosted(*squeak)
+		}
+
+		if len(ids) < schedulerBatch {
+			return
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDrafts(t *testing.T) {
+	store := NewInMemoryUserStore()
+	server := NewUserServer(store)
+
+	store.CreateUser("Leia", "leia@test", "")
+	store.CreateUser("Han", "han@test", "")
+
+	leiaToken, _ := generateJWTToken("Leia")
+	hanToken, _ := generateJWTToken("Han")
+
+	inAnHour := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+
+	var draft, scheduled Draft
+
+	t.Run("it requires authentication", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newDraftRequest(http.MethodPost, "", []byte(`{"text": "Help me"}`), ""))
+		assertStatus(t, response.Code, http.StatusUnauthorized)
+	})
+	t.Run("rejects empty text and publish times in the past", func(t *testing.T) {
+		for _, body := range []string{
+			`{"text": ""}`,
+			fmt.Sprintf(`{"text": "Help me", "publishAt": %q}`, time.Now().Add(-time.Minute).Format(time.RFC3339)),
+			fmt.Sprintf(`{"text": "Help me", "publishAt": %q}`, time.Now().Add(2*maxScheduleAhead).Format(time.RFC3339)),
+		} {
+			response := httptest.NewRecorder()
+			server.ServeHTTP(response, newDraftRequest(http.MethodPost, "", []byte(body), leiaToken))
+			assertStatus(t, response.Code, http.StatusBadRequest)
+		}
+	})
+	t.Run("saves drafts and scheduled squeaks", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newDraftRequest(http.MethodPost, "", []byte(`{"text": "Help me, Obi-Wan"}`), leiaToken))
+		assertStatus(t, response.Code, http.StatusAccepted)
+		assertNoError(t, json.NewDecoder(response.Body).Decode(&draft))
+		assertEqual(t, draft.PublishAt == nil, true)
+
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, newDraftRequest(http.MethodPost, "", []byte(fmt.Sprintf(`{"text": "You're my only hope", "publishAt": %q}`, inAnHour)), leiaToken))
+		assertStatus(t, response.Code, http.StatusAccepted)
+		assertNoError(t, json.NewDecoder(response.Body).Decode(&scheduled))
+		assertEqual(t, scheduled.PublishAt.Format(time.RFC3339), inAnHour)
+
+		squeaks, _ := store.GetUserSqueaks("Leia")
+		assertEqual(t, len(squeaks), 0)
+	})
+	t.Run("lists drafts privately, filtered by whether they are scheduled", func(t *testing.T) {
+		var drafts []Draft
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newDraftRequest(http.MethodGet, "", nil, leiaToken))
+		assertNoError(t, json.NewDecoder(response.Body).Decode(&drafts))
+		assertEqual(t, len(drafts), 2)
+
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, newDraftRequest(http.MethodGet, "?scheduled=true", nil, leiaToken))
+		assertNoError(t, json.NewDecoder(response.Body).Decode(&drafts))
+		assertEqual(t, len(drafts), 1)
+		assertEqual(t, drafts[0].ID, scheduled.ID)
+
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, newDraftRequest(http.MethodGet, "", nil, hanToken))
+		assertNoError(t, json.NewDecoder(response.Body).Decode(&drafts))
+		assertEqual(t, len(drafts), 0)
+
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, newDraftRequest(http.MethodDelete, fmt.Sprintf("/%d", draft.ID), nil, hanToken))
+		assertStatus(t, response.Code, http.StatusNotFound)
+	})
+	t.Run("edits drafts", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newDraftRequest(http.MethodPatch, fmt.Sprintf("/%d", draft.ID), []byte(fmt.Sprintf(`{"text": "Help me, @Han", "publishAt": %q}`, inAnHour)), leiaToken))
+		assertStatus(t, response.Code, http.StatusAccepted)
+
+		var edited Draft
+		assertNoError(t, json.NewDecoder(response.Body).Decode(&edited))
+		assertEqual(t, edited.Text, "Help me, @Han")
+		assertEqual(t, edited.PublishAt != nil, true)
+	})
+	t.Run("cancels scheduled squeaks", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newDraftRequest(http.MethodDelete, fmt.Sprintf("/%d", scheduled.ID), nil, leiaToken))
+		assertStatus(t, response.Code, http.StatusAccepted)
+
+		_, err := store.GetDraft(scheduled.ID)
+		assertEqual(t, err != nil, true)
+	})
+	t.Run("the scheduler publishes due squeaks once", func(t *testing.T) {
+		squeaks, unsubscribe := server.broker.Subscribe([]int{1})
+		defer unsubscribe()
+
+		published, err := store.PublishDueDrafts(time.Now().Add(2*time.Hour), 10)
+		assertNoError(t, err)
+		assertEqual(t, len(published), 1)
+
+		published, err = store.PublishDueDrafts(time.Now().Add(2*time.Hour), 10)
+		assertNoError(t, err)
+		assertEqual(t, len(published), 0)
+
+		past := time.Now().Add(-time.Minute)
+		store.CreateDraft("Leia", "Published at startup", &past)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		server.RunScheduler(ctx, time.Hour)
+
+		select {
+		case squeak := <-squeaks:
+			assertEqual(t, squeak.Text, "Published at startup")
+		case <-time.After(time.Second):
+			t.Fatal("no squeak published")
+		}
+
+		userSqueaks, _ := store.GetUserSqueaks("Leia")
+		assertEqual(t, len(userSqueaks), 2)
+	})
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// SqueakEdit holds the changes to a squeak. Only the fields that are set
+// are changed.
+type SqueakEdit struct {
+	Text           *string `json:"text"`
+	ContentWarning *string `json:"contentWarning"`
+	Sensitive      *bool   `json:"sensitive"`
+	ReplySetting   *string `json:"replySetting"`
+}
+
+// requiresSqueakAuthor only lets the author of squeak {id} through. It has to
+// be wrapped in requiresAuthentication, which supplies the acting user.
+func (u *UserServer) requiresSqueakAuthor(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := squeakIDFromPath(r)
+		if err != nil {
+			http.Error(w, fmt.Sprint(err), http.StatusBadRequest)
+			return
+		}
+
+		squeak, err := u.store.GetSqueak(id)
+		if err != nil {
+			if errors.Is(err, ErrSqueakNotFound) {
+				http.Error(w, fmt.Sprint(err), http.StatusNotFound)
+				return
+			}
+			log.Println(err)
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		if squeak.UserID != userFromContext(r.Context()).ID {
+			http.Error(w, "only the author can change this squeak", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (u *UserServer) editSqueak(w http.ResponseWriter, r *http.Request) {
+	id, _ := squeakIDFromPath(r)
+
+	var edit SqueakEdit
+	if err := json.NewDecoder(r.Body).Decode(&edit); err != nil {
+		http.Error(w, "failed to decode JSON payload", http.StatusBadRequest)
+		return
+	}
+
+	squeak, err := u.store.GetSqueak(id)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if edit.Text != nil {
+		if squeak.Kind == KindResqueak {
+			http.Error(w, "a resqueak has no text to edit", http.StatusBadRequest)
+			return
+		}
+
+		if err := validateSqueakText(*edit.Text); err != nil {
+			http.Error(w, fmt.Sprint(err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	contentWarning, sensitive := squeak.ContentWarning, squeak.Sensitive
+	if edit.ContentWarning != nil {
+		contentWarning = *edit.ContentWarning
+	}
+	if edit.Sensitive != nil {
+		sensitive = *edit.Sensitive
+	}
+
+	if err := validateContentFlags(contentWarning, sensitive, len(squeak.Media) > 0); err != nil {
+		http.Error(w, fmt.Sprint(err), http.StatusBadRequest)
+		return
+	}
+
+	if edit.ReplySetting != nil {
+		if err := validateReplySetting(*edit.ReplySetting); err != nil {
+			http.Error(w, fmt.Sprint(err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := u.store.EditSqueak(id, edit); err != nil {
+		if errors.Is(err, ErrSqueakNotFound) {
+			http.Error(w, fmt.Sprint(err), http.StatusNotFound)
+			return
+		}
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	u.respondWithSqueak(w, id)
+}
+
+func (u *UserServer) deleteSqueak(w http.ResponseWriter, r *http.Request) {
+	id, _ := squeakIDFromPath(r)
+
+	if err := u.store.DeleteSqueak(id); err != nil {
+		if errors.Is(err, ErrSqueakNotFound) {
+			http.Error(w, fmt.Sprint(err), http.StatusNotFound)
+			return
+		}
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (u *UserServer) showSqueakHistory(w http.ResponseWriter, r *http.Request) {
+	id, err := squeakIDFromPath(r)
+	if err != nil {
+		http.Error(w, fmt.Sprint(err), http.StatusBadRequest)
+		return
+	}
+
+	squeak, err := u.store.GetSqueak(id)
+	if err != nil {
+		if errors.Is(err, ErrSqueakNotFound) {
+			http.Error(w, fmt.Sprint(err), http.StatusNotFound)
+			return
+		}
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if !u.visibleTo(w, viewerName(userFromContext(r.Context())), squeak) {
+		return
+	}
+
+	history, err := u.store.GetSqueakHistory(id)
+	if err != nil {
+		if errors.Is(err, ErrSqueakNotFound) {
+			http.Error(w, fmt.Sprint(err), http.StatusNotFound)
+			return
+		}
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", jsonContentType)
+
+	if err := json.NewEncoder(w).Encode(history); err != nil {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+}
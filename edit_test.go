@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestEditAndDeleteSqueaks(t *testing.T) {
+	store := NewInMemoryUserStore()
+	server := NewUserServer(store)
+
+	store.CreateUser("Mark", "mark@test", "")
+	store.CreateUser("Harrison", "harrison@test", "")
+	id, _ := store.PostSqueak("Mark", "I have a bad fealing about this.")
+	replyID, _ := store.PostReply("Harrison", id, "Don't get cocky.")
+	resqueakID, _ := store.PostResqueak("Harrison", id, "")
+
+	token, _ := generateJWTToken("Mark")
+	harrisonToken, _ := generateJWTToken("Harrison")
+
+	t.Run("it requires authentication to edit", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newEditSqueakRequest(http.MethodPatch, id, []byte(`{"text": "Fixed."}`), ""))
+
+		assertStatus(t, response.Code, http.StatusUnauthorized)
+	})
+	t.Run("only the author can edit", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newEditSqueakRequest(http.MethodPatch, id, []byte(`{"text": "Fixed."}`), harrisonToken))
+
+		assertStatus(t, response.Code, http.StatusForbidden)
+	})
+	t.Run("Mark edits his squeak", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newEditSqueakRequest(http.MethodPatch, id, []byte(`{"text": "I have a bad feeling about this."}`), token))
+
+		assertStatus(t, response.Code, http.StatusAccepted)
+
+		var squeak SqueakPost
+		if err := json.NewDecoder(response.Body).Decode(&squeak); err != nil {
+			t.Fatal(err)
+		}
+		assertEqual(t, squeak.Text, "I have a bad feeling about this.")
+		if squeak.EditedAt == nil {
+			t.Error("edited squeak has no editedAt")
+		}
+	})
+	t.Run("returns the edit history", func(t *testing.T) {
+		request, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("/squeaks/%d/history", id), nil)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertContentType(t, response, jsonContentType)
+
+		var history []SqueakRevision
+		if err := json.NewDecoder(response.Body).Decode(&history); err != nil {
+			t.Fatal(err)
+		}
+		assertEqual(t, len(history), 2)
+		assertEqual(t, history[0].Text, "I have a bad fealing about this.")
+		assertEqual(t, history[1].Text, "I have a bad feeling about this.")
+	})
+	t.Run("rejects editing a resqueak", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newEditSqueakRequest(http.MethodPatch, resqueakID, []byte(`{"text": "Hmm."}`), harrisonToken))
+
+		assertStatus(t, response.Code, http.StatusBadRequest)
+	})
+	t.Run("only the author can delete", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newEditSqueakRequest(http.MethodDelete, id, nil, harrisonToken))
+
+		assertStatus(t, response.Code, http.StatusForbidden)
+	})
+	t.Run("Mark deletes his squeak", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newEditSqueakRequest(http.MethodDelete, id, nil, token))
+
+		assertStatus(t, response.Code, http.StatusAccepted)
+
+		_, err := store.GetUserSqueaks("Mark")
+		assertError(t, err.Error(), "no squeaks found for Mark")
+
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, newEditSqueakRequest(http.MethodDelete, id, nil, token))
+
+		assertStatus(t, response.Code, http.StatusNotFound)
+	})
+	t.Run("the thread keeps the deleted squeak as a tombstone", func(t *testing.T) {
+		request, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("/squeaks/%d/thread", replyID), nil)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		var thread Thread
+		if err := json.NewDecoder(response.Body).Decode(&thread); err != nil {
+			t.Fatal(err)
+		}
+		assertEqual(t, len(thread.Ancestors), 1)
+		assertEqual(t, thread.Ancestors[0].Unavailable, true)
+		assertEqual(t, thread.Ancestors[0].Text, unavailableSqueakText)
+	})
+	t.Run("resqueaks of the deleted squeak show a tombstone", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newGetSqueakRequest("Harrison"))
+
+		got := getUserSqueaksFromResponse(t, response.Body)
+		assertEqual(t, got[1].Original.Unavailable, true)
+	})
+	t.Run("the deleted squeak cannot be liked or inspected", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newLikeRequest(http.MethodPut, id, harrisonToken))
+
+		assertStatus(t, response.Code, http.StatusNotFound)
+
+		request, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("/squeaks/%d/history", id), nil)
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusNotFound)
+	})
+}
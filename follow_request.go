@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+var ErrFollowRequestNotFound = errors.New("follow request not found")
+
+const (
+	FollowStatusFollowing = "following"
+	FollowStatusPending   = "pending"
+)
+
+// FollowStatus answers a follow, which is pending until the followee
+// accepts it when their account is protected.
+type FollowStatus struct {
+	Status string `json:"status"`
+}
+
+func respondWithFollowStatus(w http.ResponseWriter, status string) {
+	w.Header().Set("Content-Type", jsonContentType)
+	w.WriteHeader(http.StatusAccepted)
+
+	if err := json.NewEncoder(w).Encode(FollowStatus{Status: status}); err != nil {
+		log.Println(err)
+	}
+}
+
+// requestFollow asks the owner of a protected account to accept follower.
+func (u *UserServer) requestFollow(w http.ResponseWriter, follower *User, followee string) {
+	following, err := u.store.RequestFollow(follower.Username, followee)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if following {
+		respondWithFollowStatus(w, FollowStatusFollowing)
+		return
+	}
+
+	u.notify(followee, follower.Username, NotificationFollowRequest, nil)
+
+	respondWithFollowStatus(w, FollowStatusPending)
+}
+
+func (u *UserServer) showFollowRequests(w http.ResponseWriter, r *http.Request) {
+	requests, err := u.store.GetFollowRequests(userFromContext(r.Context()).Username)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", jsonContentType)
+
+	if err := json.NewEncoder(w).Encode(newPublicUsers(requests)); err != nil {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// answerFollowRequest serves the owner accepting or rejecting the request
+// of the user named in the path with answer.
+func (u *UserServer) answerFollowRequest(answer func(name, follower string) error, accepted bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := userFromContext(r.Context())
+		follower := r.PathValue("name")
+
+		if err := answer(user.Username, follower); err != nil {
+			if errors.Is(err, ErrFollowRequestNotFound) {
+				http.Error(w, fmt.Sprint(err), http.StatusNotFound)
+				return
+			}
+			log.Println(err)
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		if accepted {
+			u.notify(follower, user.Username, NotificationFollowAccept, nil)
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+	})
+}
+
+// visibleTo answers the request with 404 and returns false when squeak is
+// by a protected user that viewer, empty when anonymous, may not see, as if
+// the squeak did not exist.
+func (u *UserServer) visibleTo(w http.ResponseWriter, viewer string, squeak *SqueakPost) bool {
+	protected, err := u.store.GetProtectedUsers(viewer, []int{squeak.UserID})
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return false
+	}
+
+	if protected[squeak.UserID] {
+		http.Error(w, fmt.Sprint(ErrSqueakNotFound), http.StatusNotFound)
+		return false
+	}
+
+	return true
+}
+
+// viewerName is the name of viewer, or empty for anonymous requests.
+func viewerName(viewer *User) string {
+	if viewer == nil {
+		return ""
+	}
+	return viewer.Username
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestProtectedAccounts(t *testing.T) {
+	store := NewInMemoryUserStore()
+	server := NewUserServer(store)
+
+	store.CreateUser("Ellen", "ellen@test", "")
+	store.CreateUser("Dallas", "dallas@test", "")
+	store.CreateUser("Kane", "kane@test", "")
+
+	ellenToken, _ := generateJWTToken("Ellen")
+	dallasToken, _ := generateJWTToken("Dallas")
+	kaneToken, _ := generateJWTToken("Kane")
+
+	secret, _ := store.PostSqueak("Ellen", "Special Order 937")
+	store.UpdateProfile("Ellen", User{Protected: true})
+	quote, _ := store.PostResqueak("Kane", secret, "Look at this")
+
+	follow := func(t testing.TB, token string) string {
+		t.Helper()
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newFollowRequest(http.MethodPost, "Ellen", token))
+		assertStatus(t, response.Code, http.StatusAccepted)
+
+		var status FollowStatus
+		assertNoError(t, json.NewDecoder(response.Body).Decode(&status))
+		return status.Status
+	}
+
+	showSqueaks := func(t testing.TB, token string) []SqueakPost {
+		t.Helper()
+
+		request := newAuthenticatedRequest(http.MethodGet, "/users/Ellen", nil, token)
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+		assertStatus(t, response.Code, http.StatusOK)
+
+		return getUserSqueaksFromResponse(t, response.Body)
+	}
+
+	t.Run("hides squeaks from anonymous viewers and other users", func(t *testing.T) {
+		for _, token := range []string{"", dallasToken} {
+			assertEqual(t, len(showSqueaks(t, token)), 0)
+
+			request := newAuthenticatedRequest(http.MethodGet, "/userbase", nil, token)
+			response := httptest.NewRecorder()
+			server.ServeHTTP(response, request)
+
+			userbase := getUserbaseFromResponse(t, response.Body)
+			assertEqual(t, userbase[0].Username, "Ellen")
+			assertEqual(t, len(userbase[0].Squeaks), 0)
+			assertEqual(t, userbase[len(userbase)-1].Username, "Kane")
+			assertEqual(t, userbase[len(userbase)-1].Squeaks[0].Original.Unavailable, true)
+		}
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newLikeRequest(http.MethodPut, secret, dallasToken))
+		assertStatus(t, response.Code, http.StatusNotFound)
+
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, newReplyRequest(secret, []byte(`{"text": "What is it?"}`), dallasToken))
+		assertStatus(t, response.Code, http.StatusNotFound)
+
+		request, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("/squeaks/%d/history", secret), nil)
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+		assertStatus(t, response.Code, http.StatusNotFound)
+	})
+	t.Run("shows squeaks to the owner", func(t *testing.T) {
+		assertEqual(t, len(showSqueaks(t, ellenToken)), 1)
+	})
+	t.Run("turns follows into requests", func(t *testing.T) {
+		assertEqual(t, follow(t, dallasToken), FollowStatusPending)
+		assertEqual(t, follow(t, kaneToken), FollowStatusPending)
+		assertEqual(t, follow(t, dallasToken), FollowStatusPending)
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newFollowRequestsRequest(http.MethodGet, "", ellenToken))
+		assertStatus(t, response.Code, http.StatusOK)
+		assertUsernames(t, getUsersFromResponse(t, response.Body), []string{"Kane", "Dallas"})
+
+		following, _ := store.GetFollowing("Dallas")
+		assertEqual(t, len(following), 0)
+		assertEqual(t, len(showSqueaks(t, dallasToken)), 0)
+
+		notifications, _ := store.GetNotifications("Ellen", false, 0, 10)
+		assertEqual(t, notifications[0].Kind, NotificationFollowRequest)
+		assertEqual(t, summarise(notifications[0]), "Dallas and Kane asked to follow you")
+	})
+	t.Run("shows squeaks to accepted followers", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newFollowRequestsRequest(http.MethodPost, "/Dallas/accept", ellenToken))
+		assertStatus(t, response.Code, http.StatusAccepted)
+
+		squeaks := showSqueaks(t, dallasToken)
+		assertEqual(t, len(squeaks), 1)
+		assertEqual(t, squeaks[0].ID, secret)
+		assertEqual(t, follow(t, dallasToken), FollowStatusFollowing)
+
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, newTimelineRequest("", dallasToken))
+		assertEqual(t, getSqueakPageFromResponse(t, response.Body).Squeaks[0].ID, secret)
+
+		notifications, _ := store.GetNotifications("Dallas", false, 0, 10)
+		assertEqual(t, notifications[0].Kind, NotificationFollowAccept)
+
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, newFollowRequestsRequest(http.MethodPost, "/Dallas/accept", ellenToken))
+		assertStatus(t, response.Code, http.StatusNotFound)
+	})
+	t.Run("rejects requests", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newFollowRequestsRequest(http.MethodPost, "/Kane/reject", ellenToken))
+		assertStatus(t, response.Code, http.StatusAccepted)
+
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, newFollowRequestsRequest(http.MethodPost, "/Kane/reject", ellenToken))
+		assertStatus(t, response.Code, http.StatusNotFound)
+
+		requests, _ := store.GetFollowRequests("Ellen")
+		assertEqual(t, len(requests), 0)
+		assertEqual(t, len(showSqueaks(t, kaneToken)), 0)
+	})
+	t.Run("withdraws requests on unfollow", func(t *testing.T) {
+		assertEqual(t, follow(t, kaneToken), FollowStatusPending)
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newFollowRequest(http.MethodDelete, "Ellen", kaneToken))
+		assertStatus(t, response.Code, http.StatusAccepted)
+
+		requests, _ := store.GetFollowRequests("Ellen")
+		assertEqual(t, len(requests), 0)
+	})
+	t.Run("shows everything once the account is public again", func(t *testing.T) {
+		assertEqual(t, follow(t, kaneToken), FollowStatusPending)
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newProfileRequest(http.MethodPatch, "/me/profile", []byte(`{"protected": false}`), ellenToken))
+		assertStatus(t, response.Code, http.StatusAccepted)
+
+		assertEqual(t, len(showSqueaks(t, "")), 1)
+
+		requests, _ := store.GetFollowRequests("Ellen")
+		assertEqual(t, len(requests), 0)
+		following, _ := store.IsFollowing("Kane", "Ellen")
+		assertEqual(t, following, true)
+
+		squeak, _ := store.GetSqueak(quote)
+		assertEqual(t, *squeak.OriginalID, secret)
+	})
+}
@@ -6,5 +6,6 @@ require github.com/lib/pq v1.10.9
 
 require (
 	github.com/golang-jwt/jwt/v5 v5.2.1
+	github.com/gorilla/websocket v1.5.3
 	golang.org/x/crypto v0.21.0
 )
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	maxTagLength         = 100
+	defaultTrendingLimit = 10
+	defaultTrendingRange = 24 * time.Hour
+	maxTrendingRange     = 7 * 24 * time.Hour
+)
+
+// TagCount is how many squeaks used a tag.
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+func isTagRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r)
+}
+
+// extractHashtags returns the normalised #tags of text, each once and in
+// order of appearance. A tag starts after a # that does not follow a tag
+// character and needs at least one character that is not a digit.
+func extractHashtags(text string) []string {
+	var tags []string
+	seen := map[string]bool{}
+
+	runes := []rune(text)
+	for i := 0; i < len(runes); i++ {
+		if runes[i] != '#' || (i > 0 && isTagRune(runes[i-1])) {
+			continue
+		}
+
+		end := i + 1
+		for end < len(runes) && isTagRune(runes[end]) {
+			end++
+		}
+
+		tag := string(runes[i+1 : end])
+		i = end - 1
+
+		if strings.TrimFunc(tag, unicode.IsDigit) == "" || len([]rune(tag)) > maxTagLength {
+			continue
+		}
+
+		tag = normaliseTag(tag)
+		if !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+
+	return tags
+}
+
+// normaliseTag case folds tag so that every spelling that only differs in
+// case maps to the same tag: each rune is replaced by the lower case of the
+// smallest rune it folds to, so "Go", "GO" and "go" all become "go".
+func normaliseTag(tag string) string {
+	return strings.Map(func(r rune) rune {
+		smallest := r
+		for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+			smallest = min(smallest, f)
+		}
+		return unicode.ToLower(smallest)
+	}, strings.TrimPrefix(tag, "#"))
+}
+
+func (u *UserServer) showTagFeed(w http.ResponseWriter, r *http.Request) {
+	cursor, limit, err := parsePagination(r)
+	if err != nil {
+		http.Error(w, fmt.Sprint(err), http.StatusBadRequest)
+		return
+	}
+
+	squeaks, err := u.store.GetTaggedSqueaks(normaliseTag(r.PathValue("tag")), cursor, limit+1)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	page := newSqueakPage(squeaks, limit)
+	page.Squeaks, err = u.prepareSqueaks(userFromContext(r.Context()), page.Squeaks)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", jsonContentType)
+
+	if err := json.NewEncoder(w).Encode(page); err != nil {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// showTrendingTags counts tag usage in the window before now, a duration
+// like 1h or 24h given in the window query parameter.
+func (u *UserServer) showTrendingTags(w http.ResponseWriter, r *http.Request) {
+	window := defaultTrendingRange
+	if value := r.URL.Query().Get("window"); value != "" {
+		var err error
+		window, err = time.ParseDuration(value)
+		if err != nil || window <= 0 || window > maxTrendingRange {
+			http.Error(w, fmt.Sprintf("window must be a duration up to %s", maxTrendingRange), http.StatusBadRequest)
+			return
+		}
+	}
+
+	limit := defaultTrendingLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		var err error
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxPageSize {
+			http.Error(w, fmt.Sprintf("limit must be between 1 and %d", maxPageSize), http.StatusBadRequest)
+			return
+		}
+	}
+
+	trending, err := u.store.GetTrendingTags(time.Now().Add(-window), limit)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", jsonContentType)
+
+	if err := json.NewEncoder(w).Encode(trending); err != nil {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestExtractHashtags(t *testing.T) {
+	cases := []struct {
+		text string
+		want []string
+	}{
+		{"no tags here", nil},
+		{"#golang is #fun", []string{"golang", "fun"}},
+		{"#Go, #GO and #go.", []string{"go"}},
+		{"ends with #", nil},
+		{"issue#42 and #42", nil},
+		{"#2024goals", []string{"2024goals"}},
+		{"#Straße #ΣΊΣΥΦΟΣ", []string{"straße", "σίσυφοσ"}},
+		{"#snake_case#joined", []string{"snake_case"}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.text, func(t *testing.T) {
+			got := extractHashtags(c.text)
+
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("got %q want %q", got, c.want)
+			}
+		})
+	}
+}
+
+func TestHashtags(t *testing.T) {
+	store := NewInMemoryUserStore()
+	server := NewUserServer(store)
+
+	store.CreateUser("Mark", "mark@test", "")
+	store.CreateUser("Harrison", "harrison@test", "")
+	store.PostSqueak("Mark", "Learning the #Force")
+	store.PostSqueak("Harrison", "Hokey religions are no match for a good blaster. #force #blasters")
+	id, _ := store.PostSqueak("Mark", "Just a #typo")
+	store.PostSqueak("Harrison", "#FORCE? Nonsense.")
+
+	t.Run("returns the tag feed newest first", func(t *testing.T) {
+		request, _ := http.NewRequest(http.MethodGet, "/tags/Force?limit=2", nil)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertContentType(t, response, jsonContentType)
+
+		page := getSqueakPageFromResponse(t, response.Body)
+		assertSqueaks(t, page.Squeaks, []SqueakPost{
+			{Text: "#FORCE? Nonsense."},
+			{Text: "Hokey religions are no match for a good blaster. #force #blasters"},
+		})
+
+		request, _ = http.NewRequest(http.MethodGet, "/tags/force?limit=2&cursor="+page.NextCursor, nil)
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+
+		page = getSqueakPageFromResponse(t, response.Body)
+		assertSqueaks(t, page.Squeaks, []SqueakPost{{Text: "Learning the #Force"}})
+	})
+	t.Run("reindexes edited squeaks", func(t *testing.T) {
+		assertNoError(t, store.EditSqueak(id, textEdit("Just a #fix")))
+
+		got, err := store.GetTaggedSqueaks("typo", 0, 10)
+		assertNoError(t, err)
+		assertEqual(t, len(got), 0)
+
+		got, err = store.GetTaggedSqueaks("fix", 0, 10)
+		assertNoError(t, err)
+		assertEqual(t, len(got), 1)
+	})
+	t.Run("returns trending tags", func(t *testing.T) {
+		request, _ := http.NewRequest(http.MethodGet, "/trending/tags?window=1h&limit=2", nil)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusOK)
+
+		var got []TagCount
+		if err := json.NewDecoder(response.Body).Decode(&got); err != nil {
+			t.Fatal(err)
+		}
+		want := []TagCount{{"force", 3}, {"blasters", 1}}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got %v want %v", got, want)
+		}
+	})
+	t.Run("rejects an invalid window", func(t *testing.T) {
+		request, _ := http.NewRequest(http.MethodGet, "/trending/tags?window=1y", nil)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusBadRequest)
+	})
+}
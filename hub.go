@@ -0,0 +1,79 @@
+package main
+
+import (
+	"slices"
+	"sync"
+)
+
+// subscriptionBuffer is how many squeaks a subscriber may fall behind before
+// the broker gives up on it.
+const subscriptionBuffer = 64
+
+// Broker passes newly posted squeaks to whoever is subscribed to their
+// authors. MemoryBroker does so within one process; running several
+// instances needs a Broker shared between them, for example one publishing
+// through Postgres NOTIFY and subscribing with LISTEN.
+type Broker interface {
+	// Publish hands squeak to the subscribers of its author without
+	// blocking on any of them.
+	Publish(squeak SqueakPost)
+	// Subscribe returns a channel receiving the squeaks of the users with
+	// the given IDs and a function ending the subscription. The channel is
+	// closed when the subscription ends, including when the subscriber
+	// falls too far behind, in which case it should catch up from the
+	// store and subscribe again.
+	Subscribe(userIDs []int) (<-chan SqueakPost, func())
+}
+
+type subscription struct {
+	userIDs []int
+	squeaks chan SqueakPost
+}
+
+// MemoryBroker is a Broker for a single instance of the server.
+type MemoryBroker struct {
+	mu            sync.Mutex
+	subscriptions map[*subscription]struct{}
+}
+
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{subscriptions: map[*subscription]struct{}{}}
+}
+
+func (b *MemoryBroker) Publish(squeak SqueakPost) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for s := range b.subscriptions {
+		if !slices.Contains(s.userIDs, squeak.UserID) {
+			continue
+		}
+		select {
+		case s.squeaks <- squeak:
+		default:
+			b.unsubscribe(s)
+		}
+	}
+}
+
+func (b *MemoryBroker) Subscribe(userIDs []int) (<-chan SqueakPost, func()) {
+	s := &subscription{userIDs: slices.Clone(userIDs), squeaks: make(chan SqueakPost, subscriptionBuffer)}
+
+	b.mu.Lock()
+	b.subscriptions[s] = struct{}{}
+	b.mu.Unlock()
+
+	return s.squeaks, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.unsubscribe(s)
+	}
+}
+
+// unsubscribe ends s unless it already ended. b.mu must be held.
+func (b *MemoryBroker) unsubscribe(s *subscription) {
+	if _, ok := b.subscriptions[s]; ok {
+		delete(b.subscriptions, s)
+		close(s.squeaks)
+	}
+}
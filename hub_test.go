@@ -0,0 +1,43 @@
+package main
+
+import "testing"
+
+func TestMemoryBroker(t *testing.T) {
+	t.Run("delivers squeaks of subscribed users", func(t *testing.T) {
+		broker := NewMemoryBroker()
+		squeaks, cancel := broker.Subscribe([]int{1})
+		defer cancel()
+
+		broker.Publish(SqueakPost{ID: 1, UserID: 2})
+		broker.Publish(SqueakPost{ID: 2, UserID: 1})
+
+		assertEqual(t, (<-squeaks).ID, 2)
+		assertEqual(t, len(squeaks), 0)
+	})
+	t.Run("closes the channel on cancel", func(t *testing.T) {
+		broker := NewMemoryBroker()
+		squeaks, cancel := broker.Subscribe([]int{1})
+
+		cancel()
+		cancel()
+
+		if _, ok := <-squeaks; ok {
+			t.Error("got a squeak after cancelling")
+		}
+	})
+	t.Run("drops subscribers that fall behind", func(t *testing.T) {
+		broker := NewMemoryBroker()
+		squeaks, cancel := broker.Subscribe([]int{1})
+		defer cancel()
+
+		for id := 1; id <= subscriptionBuffer+1; id++ {
+			broker.Publish(SqueakPost{ID: id, UserID: 1})
+		}
+
+		received := 0
+		for range squeaks {
+			received++
+		}
+		assertEqual(t, received, subscriptionBuffer)
+	})
+}
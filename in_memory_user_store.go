@@ -2,20 +2,118 @@ package main
 
 import (
 	"fmt"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 )
 
 func NewInMemoryUserStore() *InMemoryUserStore {
-	return &InMemoryUserStore{map[string][]SqueakPost{}}
+	return &InMemoryUserStore{
+		following:     map[int][]int{},
+		timelines:     map[int][]int{},
+		likes:         map[int][]int{},
+		revisions:     map[int][]SqueakRevision{},
+		tags:          map[string][]int{},
+		notifications: map[int][]Notification{},
+		blocks:        map[int][]int{},
+		mutes:         map[int][]int{},
+		searchIndex:   map[string]map[int]int{},
+		listMembers:   map[int][]int{},
+		pollVotes:     map[int]map[int]int{},
+		preferences:   map[int]Preferences{},
+		profiles:      map[int]User{},
+		requests:      map[int][]int{},
+		refreshTokens: map[string]refreshToken{},
+	}
 }
 
+// InMemoryUserStore keeps everything in memory, users and squeaks are kept
+// in slices indexed by their ID minus one.
 type InMemoryUserStore struct {
-	store map[string][]SqueakPost
+	mu           sync.RWMutex
+	users        []User
+	squeaks      []SqueakPost
+	following    map[int][]int
+	timelineMode TimelineMode
+	timelines    map[int][]int
+	likes        map[int][]int
+	revisions    map[int][]SqueakRevision
+	tags         map[string][]int
+	// notifications holds each user's notifications, oldest first, with
+	// every actor listed newest first.
+	notifications  map[int][]Notification
+	notificationID int
+	blocks         map[int][]int
+	mutes          map[int][]int
+	// searchIndex maps each search term to the squeaks containing it and
+	// how often they do.
+	searchIndex   map[string]map[int]int
+	conversations []DirectConversation
+	messages      []DirectMessage
+	bookmarks     []bookmark
+	// lists are indexed by their ID minus one, deleted ones left as nil.
+	lists       []*List
+	listMembers map[int][]int
+	// pollVotes maps each squeak with a poll to the option every voter
+	// chose, keyed by user ID.
+	pollVotes map[int]map[int]int
+	media     []Media
+	// drafts are indexed by their ID minus one, published and cancelled
+	// ones left as nil.
+	drafts      []*Draft
+	preferences map[int]Preferences
+	// profiles holds the profile fields each user has set, the counts are
+	// worked out when a profile is asked for.
+	profiles map[int]User
+	// requests maps each user to those asking to follow them, oldest first.
+	requests map[int][]int
+	// refreshTokens are keyed by their hash.
+	refreshTokens map[string]refreshToken
+}
+
+type refreshToken struct {
+	userID    int
+	family    string
+	expiresAt time.Time
+	used      bool
+	revoked   bool
+}
+
+// SetTimelineMode switches how timelines are assembled, rebuilding the
+// precomputed timelines when switching to FanOutOnWrite.
+func (i *InMemoryUserStore) SetTimelineMode(mode TimelineMode) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if mode == FanOutOnWrite {
+		i.timelines = map[int][]int{}
+		for _, squeak := range i.squeaks {
+			i.fanOut(squeak)
+		}
+	}
+
+	i.timelineMode = mode
+	return nil
 }
 
 func (i *InMemoryUserStore) GetUserSqueaks(name string) ([]SqueakPost, error) {
-	squeaks, ok := i.store[name]
-	if !ok {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	user, err := i.userByUsername(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var squeaks []SqueakPost
+	for _, squeak := range i.squeaks {
+		if squeak.UserID == user.ID && !squeak.Unavailable {
+			squeaks = append(squeaks, squeak)
+		}
+	}
+
+	if len(squeaks) == 0 {
 		return nil, fmt.Errorf("no squeaks found for %s", name)
 	}
 
@@ -23,22 +121,1878 @@ func (i *InMemoryUserStore) GetUserSqueaks(name string) ([]SqueakPost, error) {
 }
 
 func (i *InMemoryUserStore) PostSqueak(name, squeak string) (int, error) {
-	_, ok := i.store[name]
-	if !ok {
-		i.store[name] = []SqueakPost{{squeak, time.Now()}}
-		return 0, nil
-	} else {
-		i.store[name] = append(i.store[name], SqueakPost{squeak, time.Now()})
-		return 1, nil
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	user, err := i.userByUsername(name)
+	if err != nil {
+		return 0, fmt.Errorf("error trying to post new squeak: %s", err)
+	}
+
+	return i.insertSqueak(SqueakPost{UserID: user.ID, Author: user.Username, Text: squeak, Kind: KindSqueak}), nil
+}
+
+func (i *InMemoryUserStore) CreateSqueak(author string, squeak SqueakPost) (int, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	user, err := i.userByUsername(author)
+	if err != nil {
+		return 0, fmt.Errorf("error trying to post new squeak: %s", err)
+	}
+
+	mediaIDs := squeak.MediaIDs
+	for _, id := range mediaIDs {
+		if id < 1 || id > len(i.media) || i.media[id-1].SqueakID != nil {
+			return 0, fmt.Errorf("CreateSqueak: media %d is missing or attached already", id)
+		}
+	}
+
+	squeak.MediaIDs = nil
+	squeak.UserID, squeak.Author, squeak.Kind = user.ID, user.Username, KindSqueak
+	if squeak.Poll != nil {
+		squeak.Poll = newPoll(squeak.Poll.optionTexts(), squeak.Poll.ClosesAt)
+	}
+
+	id := i.insertSqueak(squeak)
+
+	var attached []Media
+	for _, mediaID := range mediaIDs {
+		i.media[mediaID-1].SqueakID = &id
+		attached = append(attached, i.media[mediaID-1])
+	}
+	i.squeaks[id-1].Media = attached
+
+	return id, nil
+}
+
+func (i *InMemoryUserStore) PostReply(name string, parentID int, squeak string) (int, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	user, err := i.userByUsername(name)
+	if err != nil {
+		return 0, fmt.Errorf("error trying to post new reply: %s", err)
+	}
+
+	parent, err := i.squeak(parentID)
+	if err != nil {
+		return 0, fmt.Errorf("PostReply: %w", err)
+	}
+
+	rootID := parent.ID
+	if parent.RootID != nil {
+		rootID = *parent.RootID
+	}
+
+	reply := SqueakPost{UserID: user.ID, Author: user.Username, Text: squeak, Kind: KindSqueak, ParentID: &parent.ID, RootID: &rootID}
+	return i.insertSqueak(reply), nil
+}
+
+func (i *InMemoryUserStore) PostResqueak(name string, originalID int, quote string) (int, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	user, err := i.userByUsername(name)
+	if err != nil {
+		return 0, fmt.Errorf("error trying to post new resqueak: %s", err)
+	}
+
+	original, err := i.squeak(originalID)
+	if err != nil {
+		return 0, fmt.Errorf("PostResqueak: %w", err)
+	}
+
+	resqueak := newResqueak(user.ID, original, quote)
+	resqueak.Author = user.Username
+	return i.insertSqueak(resqueak), nil
+}
+
+// insertSqueak assigns the squeak an ID and creation time and stores it,
+// letting everyone reply unless it has a reply setting.
+func (i *InMemoryUserStore) insertSqueak(squeak SqueakPost) int {
+	squeak.ID = len(i.squeaks) + 1
+	squeak.CreatedAt = time.Now()
+	if squeak.ReplySetting == "" {
+		squeak.ReplySetting = ReplyEveryone
+	}
+	i.squeaks = append(i.squeaks, squeak)
+
+	if i.timelineMode == FanOutOnWrite {
+		i.fanOut(squeak)
+	}
+
+	i.indexTags(squeak.ID, squeak.Text)
+	i.indexSearch(squeak.ID, squeak.Text)
+	i.squeaks[squeak.ID-1].Mentions = resolveMentions(squeak.Text, i.mentionLookup(squeak.UserID))
+
+	return squeak.ID
+}
+
+// indexTags adds squeak id to the index of every hashtag in text, keeping
+// each index sorted by ID.
+func (i *InMemoryUserStore) indexTags(id int, text string) {
+	for _, tag := range extractHashtags(text) {
+		index, _ := slices.BinarySearch(i.tags[tag], id)
+		i.tags[tag] = slices.Insert(i.tags[tag], index, id)
+	}
+}
+
+func (i *InMemoryUserStore) unindexTags(id int, text string) {
+	for _, tag := range extractHashtags(text) {
+		i.tags[tag] = slices.DeleteFunc(i.tags[tag], func(tagged int) bool { return tagged == id })
+	}
+}
+
+func (i *InMemoryUserStore) indexSearch(id int, text string) {
+	for _, term := range searchTerms(text) {
+		if i.searchIndex[term] == nil {
+			i.searchIndex[term] = map[int]int{}
+		}
+		i.searchIndex[term][id]++
+	}
+}
+
+func (i *InMemoryUserStore) unindexSearch(id int, text string) {
+	for _, term := range searchTerms(text) {
+		delete(i.searchIndex[term], id)
+	}
+}
+
+func (i *InMemoryUserStore) GetSqueak(id int) (*SqueakPost, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	return i.squeak(id)
+}
+
+func (i *InMemoryUserStore) squeak(id int) (*SqueakPost, error) {
+	if id < 1 || id > len(i.squeaks) || i.squeaks[id-1].Unavailable {
+		return nil, ErrSqueakNotFound
+	}
+
+	squeak := i.squeaks[id-1]
+	return &squeak, nil
+}
+
+func (i *InMemoryUserStore) GetSqueaksByIDs(ids []int) (map[int]SqueakPost, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	squeaks := map[int]SqueakPost{}
+	for _, id := range ids {
+		if squeak, err := i.squeak(id); err == nil {
+			squeaks[id] = *squeak
+		}
+	}
+
+	return squeaks, nil
+}
+
+func (i *InMemoryUserStore) EditSqueak(id int, edit SqueakEdit) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	squeak, err := i.squeak(id)
+	if err != nil {
+		return err
+	}
+
+	if edit.ContentWarning != nil {
+		i.squeaks[id-1].ContentWarning = *edit.ContentWarning
+	}
+	if edit.Sensitive != nil {
+		i.squeaks[id-1].Sensitive = *edit.Sensitive
+	}
+	if edit.ReplySetting != nil {
+		i.squeaks[id-1].ReplySetting = *edit.ReplySetting
+	}
+
+	if edit.Text == nil {
+		return nil
+	}
+	text := *edit.Text
+
+	written := squeak.CreatedAt
+	if squeak.EditedAt != nil {
+		written = *squeak.EditedAt
+	}
+	i.revisions[id] = append(i.revisions[id], SqueakRevision{Text: squeak.Text, CreatedAt: written})
+
+	i.unindexTags(id, squeak.Text)
+	i.indexTags(id, text)
+	i.unindexSearch(id, squeak.Text)
+	i.indexSearch(id, text)
+
+	now := time.Now()
+	i.squeaks[id-1].Text = text
+	i.squeaks[id-1].EditedAt = &now
+	i.squeaks[id-1].Mentions = resolveMentions(text, i.mentionLookup(squeak.UserID))
+
+	return nil
+}
+
+func (i *InMemoryUserStore) DeleteSqueak(id int) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	squeak, err := i.squeak(id)
+	if err != nil {
+		return err
+	}
+
+	i.unindexSearch(id, squeak.Text)
+	i.squeaks[id-1].Text = ""
+	i.squeaks[id-1].Mentions = nil
+	i.squeaks[id-1].Unavailable = true
+
+	if profile := i.profiles[squeak.UserID]; profile.PinnedSqueakID != nil && *profile.PinnedSqueakID == id {
+		profile.PinnedSqueakID = nil
+		i.profiles[squeak.UserID] = profile
+	}
+
+	return nil
+}
+
+func (i *InMemoryUserStore) GetSqueakHistory(id int) ([]SqueakRevision, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	squeak, err := i.squeak(id)
+	if err != nil {
+		return nil, err
+	}
+
+	current := SqueakRevision{Text: squeak.Text, CreatedAt: squeak.CreatedAt}
+	if squeak.EditedAt != nil {
+		current.CreatedAt = *squeak.EditedAt
+	}
+
+	return append(slices.Clone(i.revisions[id]), current), nil
+}
+
+func (i *InMemoryUserStore) GetConversation(rootID int) ([]SqueakPost, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	var conversation []SqueakPost
+	for _, squeak := range i.squeaks {
+		if squeak.ID == rootID || (squeak.RootID != nil && *squeak.RootID == rootID) {
+			conversation = append(conversation, squeak)
+		}
+	}
+
+	return conversation, nil
+}
+
+// fanOut appends squeak to the precomputed timelines of its author and
+// their followers.
+func (i *InMemoryUserStore) fanOut(squeak SqueakPost) {
+	i.timelines[squeak.UserID] = append(i.timelines[squeak.UserID], squeak.ID)
+	for follower, followees := range i.following {
+		if slices.Contains(followees, squeak.UserID) {
+			i.timelines[follower] = append(i.timelines[follower], squeak.ID)
+		}
 	}
 }
 
 func (i *InMemoryUserStore) GetUserbase() ([]User, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
 	var userbase []User
-	for name, squeaks := range i.store {
-		userbase = append(userbase, User{1, name, "", "", squeaks, time.Now()})
+	for _, user := range i.users {
+		for _, squeak := range i.squeaks {
+			if squeak.UserID == user.ID && !squeak.Unavailable {
+				user.Squeaks = append(user.Squeaks, squeak)
+			}
+		}
+		if len(user.Squeaks) > 0 {
+			userbase = append(userbase, user)
+		}
 	}
+
 	return userbase, nil
 }
 
-func (i *InMemoryUserStore) CreateUser(name, password string) (int, error) { return 0, nil }
+func (i *InMemoryUserStore) CreateUser(name, email, password string) (int, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	for _, user := range i.users {
+		if user.Username == name || user.Email == email {
+			return 0, fmt.Errorf("CreateUser: username or email already taken")
+		}
+	}
+
+	id := len(i.users) + 1
+	i.users = append(i.users, User{ID: id, Username: name, Email: email, Password: password, CreatedAt: time.Now()})
+
+	return id, nil
+}
+
+func (i *InMemoryUserStore) GetUserByUsername(username string) (*User, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	return i.userByUsername(username)
+}
+
+func (i *InMemoryUserStore) userByUsername(username string) (*User, error) {
+	for _, user := range i.users {
+		if user.Username == username {
+			return &user, nil
+		}
+	}
+
+	return nil, fmt.Errorf("no user with that username (%s) found", username)
+}
+
+func (i *InMemoryUserStore) GetUserByID(id int) (*User, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	if id < 1 || id > len(i.users) {
+		return nil, fmt.Errorf("user with id %d not found", id)
+	}
+
+	user := i.users[id-1]
+	return &user, nil
+}
+
+func (i *InMemoryUserStore) FollowUser(follower, followee string) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	from, err := i.userByUsername(follower)
+	if err != nil {
+		return fmt.Errorf("FollowUser: %w", err)
+	}
+	to, err := i.userByUsername(followee)
+	if err != nil {
+		return fmt.Errorf("FollowUser: %w", err)
+	}
+	if from.ID == to.ID {
+		return fmt.Errorf("FollowUser: %s cannot follow themselves", follower)
+	}
+
+	i.follow(from.ID, to.ID)
+
+	return nil
+}
+
+func (i *InMemoryUserStore) follow(followerID, followeeID int) {
+	if slices.Contains(i.following[followerID], followeeID) {
+		return
+	}
+
+	i.following[followerID] = append(i.following[followerID], followeeID)
+
+	if i.timelineMode == FanOutOnWrite {
+		for _, squeak := range i.squeaks {
+			if squeak.UserID == followeeID {
+				i.timelines[followerID] = append(i.timelines[followerID], squeak.ID)
+			}
+		}
+		slices.Sort(i.timelines[followerID])
+	}
+}
+
+func (i *InMemoryUserStore) UnfollowUser(follower, followee string) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	from, err := i.userByUsername(follower)
+	if err != nil {
+		return fmt.Errorf("UnfollowUser: %w", err)
+	}
+	to, err := i.userByUsername(followee)
+	if err != nil {
+		return fmt.Errorf("UnfollowUser: %w", err)
+	}
+
+	i.unfollow(from.ID, to.ID)
+
+	return nil
+}
+
+func (i *InMemoryUserStore) unfollow(followerID, followeeID int) {
+	i.removeRequest(followerID, followeeID)
+
+	i.following[followerID] = slices.DeleteFunc(i.following[followerID], func(id int) bool {
+		return id == followeeID
+	})
+
+	if i.timelineMode == FanOutOnWrite {
+		i.timelines[followerID] = slices.DeleteFunc(i.timelines[followerID], func(id int) bool {
+			return i.squeaks[id-1].UserID == followeeID
+		})
+	}
+}
+
+func (i *InMemoryUserStore) IsFollowing(follower, followee string) (bool, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	from, err := i.userByUsername(follower)
+	if err != nil {
+		return false, fmt.Errorf("IsFollowing: %w", err)
+	}
+	to, err := i.userByUsername(followee)
+	if err != nil {
+		return false, fmt.Errorf("IsFollowing: %w", err)
+	}
+
+	return slices.Contains(i.following[from.ID], to.ID), nil
+}
+
+func (i *InMemoryUserStore) GetFollowers(name string) ([]User, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	user, err := i.userByUsername(name)
+	if err != nil {
+		return nil, err
+	}
+
+	followers := []User{}
+	for _, follower := range i.users {
+		if slices.Contains(i.following[follower.ID], user.ID) {
+			followers = append(followers, User{ID: follower.ID, Username: follower.Username, CreatedAt: follower.CreatedAt})
+		}
+	}
+
+	return followers, nil
+}
+
+func (i *InMemoryUserStore) GetFollowing(name string) ([]User, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	user, err := i.userByUsername(name)
+	if err != nil {
+		return nil, err
+	}
+
+	following := []User{}
+	for _, id := range i.following[user.ID] {
+		followee := i.users[id-1]
+		following = append(following, User{ID: followee.ID, Username: followee.Username, CreatedAt: followee.CreatedAt})
+	}
+
+	return following, nil
+}
+
+func (i *InMemoryUserStore) GetTimeline(name string, cursor, limit int) ([]SqueakPost, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	user, err := i.userByUsername(name)
+	if err != nil {
+		return nil, err
+	}
+
+	squeaks := []SqueakPost{}
+
+	if i.timelineMode == FanOutOnWrite {
+		timeline := i.timelines[user.ID]
+		for k := len(timeline) - 1; k >= 0 && len(squeaks) < limit; k-- {
+			squeak := i.squeaks[timeline[k]-1]
+			if (cursor == 0 || squeak.ID < cursor) && !squeak.Unavailable {
+				squeaks = append(squeaks, squeak)
+			}
+		}
+		return squeaks, nil
+	}
+
+	for k := len(i.squeaks) - 1; k >= 0 && len(squeaks) < limit; k-- {
+		squeak := i.squeaks[k]
+		if (cursor != 0 && squeak.ID >= cursor) || squeak.Unavailable {
+			continue
+		}
+		if squeak.UserID == user.ID || slices.Contains(i.following[user.ID], squeak.UserID) {
+			squeaks = append(squeaks, squeak)
+		}
+	}
+
+	return squeaks, nil
+}
+
+func (i *InMemoryUserStore) LikeSqueak(name string, id int) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	user, err := i.userByUsername(name)
+	if err != nil {
+		return fmt.Errorf("LikeSqueak: %w", err)
+	}
+	if _, err := i.squeak(id); err != nil {
+		return fmt.Errorf("LikeSqueak: %w", err)
+	}
+
+	if !slices.Contains(i.likes[id], user.ID) {
+		i.likes[id] = append(i.likes[id], user.ID)
+		i.squeaks[id-1].LikeCount++
+	}
+
+	return nil
+}
+
+func (i *InMemoryUserStore) UnlikeSqueak(name string, id int) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	user, err := i.userByUsername(name)
+	if err != nil {
+		return fmt.Errorf("UnlikeSqueak: %w", err)
+	}
+	if _, err := i.squeak(id); err != nil {
+		return fmt.Errorf("UnlikeSqueak: %w", err)
+	}
+
+	if index := slices.Index(i.likes[id], user.ID); index != -1 {
+		i.likes[id] = slices.Delete(i.likes[id], index, index+1)
+		i.squeaks[id-1].LikeCount--
+	}
+
+	return nil
+}
+
+func (i *InMemoryUserStore) GetSqueakLikes(id int) ([]User, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	if _, err := i.squeak(id); err != nil {
+		return nil, fmt.Errorf("GetSqueakLikes: %w", err)
+	}
+
+	users := []User{}
+	for _, userID := range i.likes[id] {
+		user := i.users[userID-1]
+		users = append(users, User{ID: user.ID, Username: user.Username, CreatedAt: user.CreatedAt})
+	}
+
+	return users, nil
+}
+
+func (i *InMemoryUserStore) GetLikedSqueaks(name string, ids []int) (map[int]bool, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	user, err := i.userByUsername(name)
+	if err != nil {
+		return nil, fmt.Errorf("GetLikedSqueaks: %w", err)
+	}
+
+	liked := map[int]bool{}
+	for _, id := range ids {
+		if slices.Contains(i.likes[id], user.ID) {
+			liked[id] = true
+		}
+	}
+
+	return liked, nil
+}
+
+func (i *InMemoryUserStore) GetTaggedSqueaks(tag string, cursor, limit int) ([]SqueakPost, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	squeaks := []SqueakPost{}
+	ids := i.tags[tag]
+	for k := len(ids) - 1; k >= 0 && len(squeaks) < limit; k-- {
+		squeak := i.squeaks[ids[k]-1]
+		if (cursor == 0 || squeak.ID < cursor) && !squeak.Unavailable {
+			squeaks = append(squeaks, squeak)
+		}
+	}
+
+	return squeaks, nil
+}
+
+func (i *InMemoryUserStore) GetTrendingTags(since time.Time, limit int) ([]TagCount, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	trending := []TagCount{}
+	for tag, ids := range i.tags {
+		count := 0
+		for _, id := range ids {
+			squeak := i.squeaks[id-1]
+			if squeak.CreatedAt.After(since) && !squeak.Unavailable {
+				count++
+			}
+		}
+		if count > 0 {
+			trending = append(trending, TagCount{Tag: tag, Count: count})
+		}
+	}
+
+	slices.SortFunc(trending, func(a, b TagCount) int {
+		if a.Count != b.Count {
+			return b.Count - a.Count
+		}
+		return strings.Compare(a.Tag, b.Tag)
+	})
+
+	return trending[:min(limit, len(trending))], nil
+}
+
+func (i *InMemoryUserStore) GetMentioningSqueaks(name string, cursor, limit int) ([]SqueakPost, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	user, err := i.userByUsername(name)
+	if err != nil {
+		return nil, err
+	}
+
+	squeaks := []SqueakPost{}
+	for k := len(i.squeaks) - 1; k >= 0 && len(squeaks) < limit; k-- {
+		squeak := i.squeaks[k]
+		if (cursor != 0 && squeak.ID >= cursor) || squeak.Unavailable {
+			continue
+		}
+		if slices.ContainsFunc(squeak.Mentions, func(m Mention) bool { return m.UserID == user.ID }) {
+			squeaks = append(squeaks, squeak)
+		}
+	}
+
+	return squeaks, nil
+}
+
+func (i *InMemoryUserStore) AddNotification(name, actor, kind string, squeakID *int) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	user, err := i.userByUsername(name)
+	if err != nil {
+		return fmt.Errorf("AddNotification: %w", err)
+	}
+	from, err := i.userByUsername(actor)
+	if err != nil {
+		return fmt.Errorf("AddNotification: %w", err)
+	}
+
+	notifications := i.notifications[user.ID]
+	k := slices.IndexFunc(notifications, func(n Notification) bool {
+		sameSqueak := n.SqueakID == squeakID || (n.SqueakID != nil && squeakID != nil && *n.SqueakID == *squeakID)
+		return !n.Read && n.Kind == kind && sameSqueak
+	})
+	if k == -1 {
+		i.notificationID++
+		notifications = append(notifications, Notification{ID: i.notificationID, Kind: kind, SqueakID: squeakID})
+		k = len(notifications) - 1
+	}
+
+	notification := &notifications[k]
+	notification.Actors = slices.DeleteFunc(notification.Actors, func(a PublicUser) bool { return a.ID == from.ID })
+	notification.Actors = slices.Insert(notification.Actors, 0, PublicUser{ID: from.ID, Username: from.Username, CreatedAt: from.CreatedAt})
+	notification.UpdatedAt = time.Now()
+
+	i.notifications[user.ID] = notifications
+
+	return nil
+}
+
+func (i *InMemoryUserStore) GetNotifications(name string, unread bool, cursor, limit int) ([]Notification, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	user, err := i.userByUsername(name)
+	if err != nil {
+		return nil, err
+	}
+
+	notifications := []Notification{}
+	all := i.notifications[user.ID]
+	for k := len(all) - 1; k >= 0 && len(notifications) < limit; k-- {
+		notification := all[k]
+		if (cursor != 0 && notification.ID >= cursor) || (unread && notification.Read) {
+			continue
+		}
+		notification.ActorCount = len(notification.Actors)
+		notification.Actors = slices.Clone(notification.Actors[:min(len(notification.Actors), maxNotificationActors)])
+		notifications = append(notifications, notification)
+	}
+
+	return notifications, nil
+}
+
+func (i *InMemoryUserStore) MarkNotificationsRead(name string, ids []int) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	user, err := i.userByUsername(name)
+	if err != nil {
+		return fmt.Errorf("MarkNotificationsRead: %w", err)
+	}
+
+	for k, notification := range i.notifications[user.ID] {
+		if len(ids) == 0 || slices.Contains(ids, notification.ID) {
+			i.notifications[user.ID][k].Read = true
+		}
+	}
+
+	return nil
+}
+
+func (i *InMemoryUserStore) GetSqueaksAfter(names []string, after, limit int) ([]SqueakPost, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	squeaks := []SqueakPost{}
+	for _, squeak := range i.squeaks[min(after, len(i.squeaks)):] {
+		if len(squeaks) == limit {
+			break
+		}
+		if !squeak.Unavailable && slices.Contains(names, squeak.Author) {
+			squeaks = append(squeaks, squeak)
+		}
+	}
+
+	return squeaks, nil
+}
+
+func (i *InMemoryUserStore) BlockUser(blocker, blocked string) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	from, err := i.userByUsername(blocker)
+	if err != nil {
+		return fmt.Errorf("BlockUser: %w", err)
+	}
+	to, err := i.userByUsername(blocked)
+	if err != nil {
+		return fmt.Errorf("BlockUser: %w", err)
+	}
+
+	if !slices.Contains(i.blocks[from.ID], to.ID) {
+		i.blocks[from.ID] = append(i.blocks[from.ID], to.ID)
+	}
+
+	i.unfollow(from.ID, to.ID)
+	i.unfollow(to.ID, from.ID)
+
+	return nil
+}
+
+func (i *InMemoryUserStore) blocked(a, b int) bool {
+	return slices.Contains(i.blocks[a], b) || slices.Contains(i.blocks[b], a)
+}
+
+// mentionLookup resolves the users a squeak by authorID can mention, leaving
+// out those in a block with the author.
+func (i *InMemoryUserStore) mentionLookup(authorID int) func(string) (*User, error) {
+	return func(username string) (*User, error) {
+		user, err := i.userByUsername(username)
+		if err != nil {
+			return nil, err
+		}
+		if i.blocked(authorID, user.ID) {
+			return nil, fmt.Errorf("%s cannot be mentioned", username)
+		}
+		return user, nil
+	}
+}
+
+func (i *InMemoryUserStore) UnblockUser(blocker, blocked string) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	from, err := i.userByUsername(blocker)
+	if err != nil {
+		return fmt.Errorf("UnblockUser: %w", err)
+	}
+	to, err := i.userByUsername(blocked)
+	if err != nil {
+		return fmt.Errorf("UnblockUser: %w", err)
+	}
+
+	i.blocks[from.ID] = slices.DeleteFunc(i.blocks[from.ID], func(id int) bool { return id == to.ID })
+
+	return nil
+}
+
+func (i *InMemoryUserStore) IsBlocked(name, other string) (bool, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	a, err := i.userByUsername(name)
+	if err != nil {
+		return false, fmt.Errorf("IsBlocked: %w", err)
+	}
+	b, err := i.userByUsername(other)
+	if err != nil {
+		return false, fmt.Errorf("IsBlocked: %w", err)
+	}
+
+	return i.blocked(a.ID, b.ID), nil
+}
+
+func (i *InMemoryUserStore) CreateDirectConversation(creator string, participants []string) (int, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	var members []Participant
+	for _, name := range append([]string{creator}, participants...) {
+		user, err := i.userByUsername(name)
+		if err != nil {
+			return 0, fmt.Errorf("CreateDirectConversation: %w", err)
+		}
+		members = append(members, Participant{UserID: user.ID, Username: user.Username})
+	}
+	slices.SortFunc(members, func(a, b Participant) int { return strings.Compare(a.Username, b.Username) })
+
+	if len(members) == 2 {
+		for _, conversation := range i.conversations {
+			if len(conversation.Participants) == 2 &&
+				conversation.participant(members[0].UserID) != nil &&
+				conversation.participant(members[1].UserID) != nil {
+				return conversation.ID, nil
+			}
+		}
+	}
+
+	id := len(i.conversations) + 1
+	i.conversations = append(i.conversations, DirectConversation{ID: id, Participants: members, CreatedAt: time.Now()})
+
+	return id, nil
+}
+
+// directConversation returns a copy of conversation id that shares nothing
+// with the store.
+func (i *InMemoryUserStore) directConversation(id int) (DirectConversation, error) {
+	if id < 1 || id > len(i.conversations) {
+		return DirectConversation{}, ErrConversationNotFound
+	}
+
+	conversation := i.conversations[id-1]
+	conversation.Participants = slices.Clone(conversation.Participants)
+	if conversation.LastMessage != nil {
+		message := *conversation.LastMessage
+		conversation.LastMessage = &message
+	}
+
+	return conversation, nil
+}
+
+func (i *InMemoryUserStore) GetDirectConversation(id int) (*DirectConversation, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	conversation, err := i.directConversation(id)
+	if err != nil {
+		return nil, fmt.Errorf("GetDirectConversation: %w", err)
+	}
+
+	return &conversation, nil
+}
+
+func (i *InMemoryUserStore) GetDirectConversations(name string) ([]DirectConversation, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	user, err := i.userByUsername(name)
+	if err != nil {
+		return nil, err
+	}
+
+	conversations := []DirectConversation{}
+	for _, c := range i.conversations {
+		member := c.participant(user.ID)
+		if member == nil {
+			continue
+		}
+
+		conversation, _ := i.directConversation(c.ID)
+		for _, message := range i.messages[member.LastReadID:] {
+			if message.ConversationID == c.ID && message.SenderID != user.ID {
+				conversation.UnreadCount++
+			}
+		}
+		conversations = append(conversations, conversation)
+	}
+
+	lastActivity := func(c DirectConversation) int {
+		if c.LastMessage == nil {
+			return 0
+		}
+		return c.LastMessage.ID
+	}
+	slices.SortStableFunc(conversations, func(a, b DirectConversation) int {
+		if lastActivity(a) != lastActivity(b) {
+			return lastActivity(b) - lastActivity(a)
+		}
+		return b.ID - a.ID
+	})
+
+	return conversations, nil
+}
+
+func (i *InMemoryUserStore) PostDirectMessage(name string, conversationID int, text string) (int, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	user, err := i.userByUsername(name)
+	if err != nil {
+		return 0, fmt.Errorf("PostDirectMessage: %w", err)
+	}
+	if conversationID < 1 || conversationID > len(i.conversations) {
+		return 0, fmt.Errorf("PostDirectMessage: %w", ErrConversationNotFound)
+	}
+
+	message := DirectMessage{
+		ID:             len(i.messages) + 1,
+		ConversationID: conversationID,
+		SenderID:       user.ID,
+		Sender:         user.Username,
+		Text:           text,
+		CreatedAt:      time.Now(),
+	}
+	i.messages = append(i.messages, message)
+
+	conversation := &i.conversations[conversationID-1]
+	conversation.LastMessage = &message
+	if member := conversation.participant(user.ID); member != nil {
+		member.LastReadID = message.ID
+	}
+
+	return message.ID, nil
+}
+
+func (i *InMemoryUserStore) GetDirectMessages(conversationID, cursor, limit int) ([]DirectMessage, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	messages := []DirectMessage{}
+	for k := len(i.messages) - 1; k >= 0 && len(messages) < limit; k-- {
+		message := i.messages[k]
+		if message.ConversationID == conversationID && (cursor == 0 || message.ID < cursor) {
+			messages = append(messages, message)
+		}
+	}
+
+	return messages, nil
+}
+
+func (i *InMemoryUserStore) MarkDirectMessagesRead(name string, conversationID, messageID int) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	user, err := i.userByUsername(name)
+	if err != nil {
+		return fmt.Errorf("MarkDirectMessagesRead: %w", err)
+	}
+	if conversationID < 1 || conversationID > len(i.conversations) {
+		return fmt.Errorf("MarkDirectMessagesRead: %w", ErrConversationNotFound)
+	}
+
+	member := i.conversations[conversationID-1].participant(user.ID)
+	if member == nil || messageID <= member.LastReadID {
+		return nil
+	}
+
+	for _, message := range i.messages[member.LastReadID:min(messageID, len(i.messages))] {
+		if message.ConversationID == conversationID {
+			member.LastReadID = message.ID
+		}
+	}
+
+	return nil
+}
+
+// bookmark is a stored Bookmark, its ID being its position in bookmarks
+// plus one.
+type bookmark struct {
+	userID, squeakID int
+	createdAt        time.Time
+	removed          bool
+}
+
+// usersByID lists the users with the given IDs in that order.
+func (i *InMemoryUserStore) usersByID(ids []int) []User {
+	users := []User{}
+	for _, id := range ids {
+		user := i.users[id-1]
+		users = append(users, User{ID: user.ID, Username: user.Username, CreatedAt: user.CreatedAt})
+	}
+	return users
+}
+
+func (i *InMemoryUserStore) GetBlockedUsers(name string) ([]User, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	user, err := i.userByUsername(name)
+	if err != nil {
+		return nil, fmt.Errorf("GetBlockedUsers: %w", err)
+	}
+
+	blocked := slices.Clone(i.blocks[user.ID])
+	slices.Reverse(blocked)
+
+	return i.usersByID(blocked), nil
+}
+
+func (i *InMemoryUserStore) MuteUser(muter, muted string) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	from, err := i.userByUsername(muter)
+	if err != nil {
+		return fmt.Errorf("MuteUser: %w", err)
+	}
+	to, err := i.userByUsername(muted)
+	if err != nil {
+		return fmt.Errorf("MuteUser: %w", err)
+	}
+
+	if !slices.Contains(i.mutes[from.ID], to.ID) {
+		i.mutes[from.ID] = append(i.mutes[from.ID], to.ID)
+	}
+
+	return nil
+}
+
+func (i *InMemoryUserStore) UnmuteUser(muter, muted string) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	from, err := i.userByUsername(muter)
+	if err != nil {
+		return fmt.Errorf("UnmuteUser: %w", err)
+	}
+	to, err := i.userByUsername(muted)
+	if err != nil {
+		return fmt.Errorf("UnmuteUser: %w", err)
+	}
+
+	i.mutes[from.ID] = slices.DeleteFunc(i.mutes[from.ID], func(id int) bool { return id == to.ID })
+
+	return nil
+}
+
+func (i *InMemoryUserStore) GetMutedUsers(name string) ([]User, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	user, err := i.userByUsername(name)
+	if err != nil {
+		return nil, fmt.Errorf("GetMutedUsers: %w", err)
+	}
+
+	muted := slices.Clone(i.mutes[user.ID])
+	slices.Reverse(muted)
+
+	return i.usersByID(muted), nil
+}
+
+func (i *InMemoryUserStore) GetHiddenUsers(name string) (map[int]bool, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	user, err := i.userByUsername(name)
+	if err != nil {
+		return nil, fmt.Errorf("GetHiddenUsers: %w", err)
+	}
+
+	hidden := map[int]bool{}
+	for _, id := range i.blocks[user.ID] {
+		hidden[id] = true
+	}
+	for blocker, blocked := range i.blocks {
+		if slices.Contains(blocked, user.ID) {
+			hidden[blocker] = true
+		}
+	}
+	for _, id := range i.mutes[user.ID] {
+		hidden[id] = true
+	}
+
+	return hidden, nil
+}
+
+// SearchSqueaks finds the squeaks containing every word of query, ranking
+// them by how often they contain those words and then newest first.
+func (i *InMemoryUserStore) SearchSqueaks(query string, offset, limit int) ([]SqueakPost, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	terms := searchTerms(query)
+	if len(terms) == 0 {
+		return []SqueakPost{}, nil
+	}
+
+	scores := map[int]int{}
+	for id, count := range i.searchIndex[terms[0]] {
+		scores[id] = count
+	}
+	for _, term := range terms[1:] {
+		for id := range scores {
+			count, ok := i.searchIndex[term][id]
+			if !ok {
+				delete(scores, id)
+				continue
+			}
+			scores[id] += count
+		}
+	}
+
+	ids := make([]int, 0, len(scores))
+	for id := range scores {
+		ids = append(ids, id)
+	}
+	slices.SortFunc(ids, func(a, b int) int {
+		if scores[a] != scores[b] {
+			return scores[b] - scores[a]
+		}
+		return b - a
+	})
+
+	squeaks := []SqueakPost{}
+	for _, id := range ids[min(offset, len(ids)):min(offset+limit, len(ids))] {
+		squeaks = append(squeaks, i.squeaks[id-1])
+	}
+
+	return squeaks, nil
+}
+
+// SearchUsers finds the users with a username starting with query, or
+// containing it further in, exact and shorter usernames first.
+func (i *InMemoryUserStore) SearchUsers(query string, offset, limit int) ([]User, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	needle := strings.ToLower(strings.Join(searchTerms(query), ""))
+	if needle == "" {
+		return []User{}, nil
+	}
+
+	rank := func(username string) int {
+		switch name := strings.ToLower(username); {
+		case name == needle:
+			return 0
+		case strings.HasPrefix(name, needle):
+			return 1
+		case strings.Contains(name, needle):
+			return 2
+		default:
+			return -1
+		}
+	}
+
+	var matches []User
+	for _, user := range i.users {
+		if rank(user.Username) >= 0 {
+			matches = append(matches, User{ID: user.ID, Username: user.Username, CreatedAt: user.CreatedAt})
+		}
+	}
+	slices.SortStableFunc(matches, func(a, b User) int {
+		if rank(a.Username) != rank(b.Username) {
+			return rank(a.Username) - rank(b.Username)
+		}
+		return len(a.Username) - len(b.Username)
+	})
+
+	users := []User{}
+	users = append(users, matches[min(offset, len(matches)):min(offset+limit, len(matches))]...)
+
+	return users, nil
+}
+
+func (i *InMemoryUserStore) BookmarkSqueak(name string, id int) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	user, err := i.userByUsername(name)
+	if err != nil {
+		return fmt.Errorf("BookmarkSqueak: %w", err)
+	}
+	if _, err := i.squeak(id); err != nil {
+		return fmt.Errorf("BookmarkSqueak: %w", err)
+	}
+
+	for _, saved := range i.bookmarks {
+		if saved.userID == user.ID && saved.squeakID == id && !saved.removed {
+			return nil
+		}
+	}
+
+	i.bookmarks = append(i.bookmarks, bookmark{userID: user.ID, squeakID: id, createdAt: time.Now()})
+
+	return nil
+}
+
+func (i *InMemoryUserStore) UnbookmarkSqueak(name string, id int) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	user, err := i.userByUsername(name)
+	if err != nil {
+		return fmt.Errorf("UnbookmarkSqueak: %w", err)
+	}
+
+	for k, saved := range i.bookmarks {
+		if saved.userID == user.ID && saved.squeakID == id {
+			i.bookmarks[k].removed = true
+		}
+	}
+
+	return nil
+}
+
+func (i *InMemoryUserStore) GetBookmarks(name string, cursor, limit int) ([]Bookmark, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	user, err := i.userByUsername(name)
+	if err != nil {
+		return nil, err
+	}
+
+	bookmarks := []Bookmark{}
+	for k := len(i.bookmarks) - 1; k >= 0 && len(bookmarks) < limit; k-- {
+		saved := i.bookmarks[k]
+		if saved.removed || saved.userID != user.ID || (cursor != 0 && k+1 >= cursor) {
+			continue
+		}
+		bookmarks = append(bookmarks, Bookmark{ID: k + 1, CreatedAt: saved.createdAt, Squeak: i.squeaks[saved.squeakID-1]})
+	}
+
+	return bookmarks, nil
+}
+
+func (i *InMemoryUserStore) CreateList(owner, name string, private bool) (int, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	user, err := i.userByUsername(owner)
+	if err != nil {
+		return 0, fmt.Errorf("CreateList: %w", err)
+	}
+
+	id := len(i.lists) + 1
+	i.lists = append(i.lists, &List{ID: id, OwnerID: user.ID, Owner: user.Username, Name: name, Private: private, CreatedAt: time.Now()})
+
+	return id, nil
+}
+
+// list returns a copy of list id with its member count filled in.
+func (i *InMemoryUserStore) list(id int) (List, error) {
+	if id < 1 || id > len(i.lists) || i.lists[id-1] == nil {
+		return List{}, ErrListNotFound
+	}
+
+	list := *i.lists[id-1]
+	list.MemberCount = len(i.listMembers[id])
+	return list, nil
+}
+
+func (i *InMemoryUserStore) GetList(id int) (*List, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	list, err := i.list(id)
+	if err != nil {
+		return nil, fmt.Errorf("GetList: %w", err)
+	}
+
+	return &list, nil
+}
+
+func (i *InMemoryUserStore) GetLists(owner string, includePrivate bool) ([]List, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	user, err := i.userByUsername(owner)
+	if err != nil {
+		return nil, err
+	}
+
+	lists := []List{}
+	for _, l := range i.lists {
+		if l == nil || l.OwnerID != user.ID || (l.Private && !includePrivate) {
+			continue
+		}
+		list, _ := i.list(l.ID)
+		lists = append(lists, list)
+	}
+
+	return lists, nil
+}
+
+func (i *InMemoryUserStore) UpdateList(id int, name string, private bool) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if _, err := i.list(id); err != nil {
+		return fmt.Errorf("UpdateList: %w", err)
+	}
+
+	i.lists[id-1].Name = name
+	i.lists[id-1].Private = private
+
+	return nil
+}
+
+func (i *InMemoryUserStore) DeleteList(id int) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if _, err := i.list(id); err != nil {
+		return nil
+	}
+
+	i.lists[id-1] = nil
+	delete(i.listMembers, id)
+
+	return nil
+}
+
+func (i *InMemoryUserStore) AddListMember(id int, name string) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	user, err := i.userByUsername(name)
+	if err != nil {
+		return fmt.Errorf("AddListMember: %w", err)
+	}
+	if _, err := i.list(id); err != nil {
+		return fmt.Errorf("AddListMember: %w", err)
+	}
+
+	if !slices.Contains(i.listMembers[id], user.ID) {
+		i.listMembers[id] = append(i.listMembers[id], user.ID)
+	}
+
+	return nil
+}
+
+func (i *InMemoryUserStore) RemoveListMember(id int, name string) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	user, err := i.userByUsername(name)
+	if err != nil {
+		return fmt.Errorf("RemoveListMember: %w", err)
+	}
+
+	i.listMembers[id] = slices.DeleteFunc(i.listMembers[id], func(memberID int) bool { return memberID == user.ID })
+
+	return nil
+}
+
+func (i *InMemoryUserStore) GetListMembers(id int) ([]User, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	members := i.usersByID(i.listMembers[id])
+	slices.SortFunc(members, func(a, b User) int { return strings.Compare(a.Username, b.Username) })
+
+	return members, nil
+}
+
+func (i *InMemoryUserStore) GetListTimeline(id, cursor, limit int) ([]SqueakPost, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	squeaks := []SqueakPost{}
+	for k := len(i.squeaks) - 1; k >= 0 && len(squeaks) < limit; k-- {
+		squeak := i.squeaks[k]
+		if (cursor != 0 && squeak.ID >= cursor) || squeak.Unavailable {
+			continue
+		}
+		if slices.Contains(i.listMembers[id], squeak.UserID) {
+			squeaks = append(squeaks, squeak)
+		}
+	}
+
+	return squeaks, nil
+}
+
+// VoteInPoll replaces the squeak's poll with an updated copy, as squeaks
+// handed out earlier share the old one.
+func (i *InMemoryUserStore) VoteInPoll(name string, id, option int) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	user, err := i.userByUsername(name)
+	if err != nil {
+		return fmt.Errorf("VoteInPoll: %w", err)
+	}
+	squeak, err := i.squeak(id)
+	if err != nil {
+		return fmt.Errorf("VoteInPoll: %w", err)
+	}
+	if squeak.Poll == nil || option < 0 || option >= len(squeak.Poll.Options) {
+		return fmt.Errorf("VoteInPoll: no option %d in a poll on squeak %d", option, id)
+	}
+
+	if _, ok := i.pollVotes[id][user.ID]; ok {
+		return fmt.Errorf("VoteInPoll: %w", ErrAlreadyVoted)
+	}
+
+	if i.pollVotes[id] == nil {
+		i.pollVotes[id] = map[int]int{}
+	}
+	i.pollVotes[id][user.ID] = option
+	i.squeaks[id-1].Poll = squeak.Poll.withVote(option)
+
+	return nil
+}
+
+func (i *InMemoryUserStore) GetPollVotes(name string, ids []int) (map[int]int, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	user, err := i.userByUsername(name)
+	if err != nil {
+		return nil, fmt.Errorf("GetPollVotes: %w", err)
+	}
+
+	votes := map[int]int{}
+	for _, id := range ids {
+		if option, ok := i.pollVotes[id][user.ID]; ok {
+			votes[id] = option
+		}
+	}
+
+	return votes, nil
+}
+
+func (i *InMemoryUserStore) CreateMedia(owner string, media Media) (int, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	user, err := i.userByUsername(owner)
+	if err != nil {
+		return 0, fmt.Errorf("CreateMedia: %w", err)
+	}
+
+	media.ID = len(i.media) + 1
+	media.OwnerID = user.ID
+	media.SqueakID = nil
+	media.CreatedAt = time.Now()
+	i.media = append(i.media, media)
+
+	return media.ID, nil
+}
+
+func (i *InMemoryUserStore) GetMedia(id int) (*Media, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	if id < 1 || id > len(i.media) {
+		return nil, fmt.Errorf("GetMedia: %w", ErrMediaNotFound)
+	}
+
+	media := i.media[id-1]
+	return &media, nil
+}
+
+func (i *InMemoryUserStore) CreateDraft(name, text string, publishAt *time.Time) (int, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	user, err := i.userByUsername(name)
+	if err != nil {
+		return 0, fmt.Errorf("CreateDraft: %w", err)
+	}
+
+	now := time.Now()
+	id := len(i.drafts) + 1
+	i.drafts = append(i.drafts, &Draft{ID: id, UserID: user.ID, Text: text, PublishAt: publishAt, CreatedAt: now, UpdatedAt: now})
+
+	return id, nil
+}
+
+func (i *InMemoryUserStore) draft(id int) (*Draft, error) {
+	if id < 1 || id > len(i.drafts) || i.drafts[id-1] == nil {
+		return nil, ErrDraftNotFound
+	}
+
+	return i.drafts[id-1], nil
+}
+
+func (i *InMemoryUserStore) GetDraft(id int) (*Draft, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	draft, err := i.draft(id)
+	if err != nil {
+		return nil, fmt.Errorf("GetDraft: %w", err)
+	}
+
+	copied := *draft
+	return &copied, nil
+}
+
+func (i *InMemoryUserStore) GetDrafts(name string) ([]Draft, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	user, err := i.userByUsername(name)
+	if err != nil {
+		return nil, err
+	}
+
+	drafts := []Draft{}
+	for _, draft := range i.drafts {
+		if draft != nil && draft.UserID == user.ID {
+			drafts = append(drafts, *draft)
+		}
+	}
+
+	return drafts, nil
+}
+
+// UpdateDraft replaces the draft rather than changing it, as copies handed
+// out earlier share its PublishAt.
+func (i *InMemoryUserStore) UpdateDraft(id int, text string, publishAt *time.Time) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	draft, err := i.draft(id)
+	if err != nil {
+		return fmt.Errorf("UpdateDraft: %w", err)
+	}
+
+	updated := *draft
+	updated.Text, updated.PublishAt, updated.UpdatedAt = text, publishAt, time.Now()
+	i.drafts[id-1] = &updated
+
+	return nil
+}
+
+func (i *InMemoryUserStore) DeleteDraft(id int) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if _, err := i.draft(id); err == nil {
+		i.drafts[id-1] = nil
+	}
+
+	return nil
+}
+
+func (i *InMemoryUserStore) PublishDueDrafts(now time.Time, limit int) ([]int, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	var due []*Draft
+	for _, draft := range i.drafts {
+		if draft != nil && draft.PublishAt != nil && !draft.PublishAt.After(now) {
+			due = append(due, draft)
+		}
+	}
+	slices.SortStableFunc(due, func(a, b *Draft) int { return a.PublishAt.Compare(*b.PublishAt) })
+
+	ids := []int{}
+	for _, draft := range due[:min(limit, len(due))] {
+		author := i.users[draft.UserID-1]
+		ids = append(ids, i.insertSqueak(SqueakPost{UserID: author.ID, Author: author.Username, Text: draft.Text, Kind: KindSqueak}))
+		i.drafts[draft.ID-1] = nil
+	}
+
+	return ids, nil
+}
+
+func (i *InMemoryUserStore) GetPreferences(name string) (*Preferences, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	user, err := i.userByUsername(name)
+	if err != nil {
+		return nil, fmt.Errorf("GetPreferences: %w", err)
+	}
+
+	preferences := i.preferences[user.ID]
+	return &preferences, nil
+}
+
+func (i *InMemoryUserStore) UpdatePreferences(name string, preferences Preferences) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	user, err := i.userByUsername(name)
+	if err != nil {
+		return fmt.Errorf("UpdatePreferences: %w", err)
+	}
+
+	i.preferences[user.ID] = preferences
+
+	return nil
+}
+
+func (i *InMemoryUserStore) GetProfile(name string) (*Profile, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	user, err := i.userByUsername(name)
+	if err != nil {
+		return nil, err
+	}
+
+	stored := i.profiles[user.ID]
+	profile := &Profile{
+		User: User{
+			ID:             user.ID,
+			Username:       user.Username,
+			CreatedAt:      user.CreatedAt,
+			DisplayName:    stored.DisplayName,
+			Bio:            stored.Bio,
+			Location:       stored.Location,
+			Website:        stored.Website,
+			AvatarID:       stored.AvatarID,
+			HeaderID:       stored.HeaderID,
+			PinnedSqueakID: stored.PinnedSqueakID,
+			Protected:      stored.Protected,
+		},
+		FollowingCount: len(i.following[user.ID]),
+	}
+
+	for _, followees := range i.following {
+		if slices.Contains(followees, user.ID) {
+			profile.FollowerCount++
+		}
+	}
+
+	for _, squeak := range i.squeaks {
+		if squeak.UserID == user.ID && !squeak.Unavailable {
+			profile.SqueakCount++
+		}
+	}
+
+	return profile, nil
+}
+
+func (i *InMemoryUserStore) UpdateProfile(name string, user User) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	stored, err := i.userByUsername(name)
+	if err != nil {
+		return fmt.Errorf("UpdateProfile: %w", err)
+	}
+
+	profile := i.profiles[stored.ID]
+	profile.DisplayName = user.DisplayName
+	profile.Bio = user.Bio
+	profile.Location = user.Location
+	profile.Website = user.Website
+	profile.AvatarID = user.AvatarID
+	profile.HeaderID = user.HeaderID
+	profile.Protected = user.Protected
+	i.profiles[stored.ID] = profile
+
+	if !user.Protected {
+		for _, follower := range i.requests[stored.ID] {
+			i.follow(follower, stored.ID)
+		}
+		delete(i.requests, stored.ID)
+	}
+
+	return nil
+}
+
+func (i *InMemoryUserStore) PinSqueak(name string, id int) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	user, err := i.userByUsername(name)
+	if err != nil {
+		return fmt.Errorf("PinSqueak: %w", err)
+	}
+
+	squeak, err := i.squeak(id)
+	if err != nil || squeak.UserID != user.ID {
+		return ErrSqueakNotFound
+	}
+
+	profile := i.profiles[user.ID]
+	profile.PinnedSqueakID = &id
+	i.profiles[user.ID] = profile
+
+	return nil
+}
+
+func (i *InMemoryUserStore) UnpinSqueak(name string, id int) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	user, err := i.userByUsername(name)
+	if err != nil {
+		return fmt.Errorf("UnpinSqueak: %w", err)
+	}
+
+	if profile := i.profiles[user.ID]; profile.PinnedSqueakID != nil && *profile.PinnedSqueakID == id {
+		profile.PinnedSqueakID = nil
+		i.profiles[user.ID] = profile
+	}
+
+	return nil
+}
+
+func (i *InMemoryUserStore) RequestFollow(follower, followee string) (bool, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	from, err := i.userByUsername(follower)
+	if err != nil {
+		return false, fmt.Errorf("RequestFollow: %w", err)
+	}
+	to, err := i.userByUsername(followee)
+	if err != nil {
+		return false, fmt.Errorf("RequestFollow: %w", err)
+	}
+	if from.ID == to.ID {
+		return false, fmt.Errorf("RequestFollow: %s cannot follow themselves", follower)
+	}
+
+	if slices.Contains(i.following[from.ID], to.ID) {
+		return true, nil
+	}
+
+	if !slices.Contains(i.requests[to.ID], from.ID) {
+		i.requests[to.ID] = append(i.requests[to.ID], from.ID)
+	}
+
+	return false, nil
+}
+
+func (i *InMemoryUserStore) GetFollowRequests(name string) ([]User, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	user, err := i.userByUsername(name)
+	if err != nil {
+		return nil, fmt.Errorf("GetFollowRequests: %w", err)
+	}
+
+	requests := slices.Clone(i.requests[user.ID])
+	slices.Reverse(requests)
+
+	return i.usersByID(requests), nil
+}
+
+func (i *InMemoryUserStore) AcceptFollowRequest(name, follower string) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	user, err := i.userByUsername(name)
+	if err != nil {
+		return fmt.Errorf("AcceptFollowRequest: %w", err)
+	}
+	from, err := i.userByUsername(follower)
+	if err != nil || !i.removeRequest(from.ID, user.ID) {
+		return ErrFollowRequestNotFound
+	}
+
+	i.follow(from.ID, user.ID)
+
+	return nil
+}
+
+func (i *InMemoryUserStore) RejectFollowRequest(name, follower string) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	user, err := i.userByUsername(name)
+	if err != nil {
+		return fmt.Errorf("RejectFollowRequest: %w", err)
+	}
+	from, err := i.userByUsername(follower)
+	if err != nil || !i.removeRequest(from.ID, user.ID) {
+		return ErrFollowRequestNotFound
+	}
+
+	return nil
+}
+
+// removeRequest drops the request of follower to follow followee, reporting
+// whether there was one.
+func (i *InMemoryUserStore) removeRequest(followerID, followeeID int) bool {
+	requests := i.requests[followeeID]
+	index := slices.Index(requests, followerID)
+	if index < 0 {
+		return false
+	}
+
+	i.requests[followeeID] = slices.Delete(slices.Clone(requests), index, index+1)
+	return true
+}
+
+func (i *InMemoryUserStore) GetProtectedUsers(name string, ids []int) (map[int]bool, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	var viewerID int
+	if user, err := i.userByUsername(name); err == nil {
+		viewerID = user.ID
+	}
+
+	protected := map[int]bool{}
+	for _, id := range ids {
+		if i.profiles[id].Protected && id != viewerID && !slices.Contains(i.following[viewerID], id) {
+			protected[id] = true
+		}
+	}
+
+	return protected, nil
+}
+
+func (i *InMemoryUserStore) CreateRefreshToken(name, family, hash string, expiresAt time.Time) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	user, err := i.userByUsername(name)
+	if err != nil {
+		return fmt.Errorf("CreateRefreshToken: %w", err)
+	}
+
+	i.refreshTokens[hash] = refreshToken{userID: user.ID, family: family, expiresAt: expiresAt}
+
+	return nil
+}
+
+func (i *InMemoryUserStore) RotateRefreshToken(hash, newHash string, now, expiresAt time.Time) (string, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	token, ok := i.refreshTokens[hash]
+	if !ok || token.revoked || !now.Before(token.expiresAt) {
+		return "", ErrRefreshTokenInvalid
+	}
+
+	if token.used {
+		i.revokeFamily(token.family)
+		return "", ErrRefreshTokenReused
+	}
+
+	token.used = true
+	i.refreshTokens[hash] = token
+	i.refreshTokens[newHash] = refreshToken{userID: token.userID, family: token.family, expiresAt: expiresAt}
+
+	return i.users[token.userID-1].Username, nil
+}
+
+func (i *InMemoryUserStore) RevokeRefreshTokens(hash string) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if token, ok := i.refreshTokens[hash]; ok {
+		i.revokeFamily(token.family)
+	}
+
+	return nil
+}
+
+func (i *InMemoryUserStore) revokeFamily(family string) {
+	for hash, token := range i.refreshTokens {
+		if token.family == family {
+			token.revoked = true
+			i.refreshTokens[hash] = token
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+var timelineModes = map[string]TimelineMode{
+	"fan-out on read":  FanOutOnRead,
+	"fan-out on write": FanOutOnWrite,
+}
+
+func TestInMemoryTimeline(t *testing.T) {
+	for name, mode := range timelineModes {
+		t.Run(name, func(t *testing.T) {
+			store := NewInMemoryUserStore()
+			assertNoError(t, store.SetTimelineMode(mode))
+
+			store.CreateUser("Mark", "mark@test", "")
+			store.CreateUser("Harrison", "harrison@test", "")
+			store.CreateUser("Carrie", "carrie@test", "")
+
+			store.PostSqueak("Harrison", "Great, kid, don't get cocky.")
+			store.PostSqueak("Carrie", "Will somebody get this big walking carpet out of my way?")
+			assertNoError(t, store.FollowUser("Mark", "Harrison"))
+			store.PostSqueak("Mark", "I don't believe it!")
+			store.PostSqueak("Harrison", "Laugh it up, fuzzball!")
+
+			got, err := store.GetTimeline("Mark", 0, 10)
+			assertNoError(t, err)
+			assertSqueaks(t, got, []SqueakPost{
+				{Text: "Laugh it up, fuzzball!"},
+				{Text: "I don't believe it!"},
+				{Text: "Great, kid, don't get cocky."},
+			})
+
+			got, err = store.GetTimeline("Mark", 3, 10)
+			assertNoError(t, err)
+			assertSqueaks(t, got, []SqueakPost{{Text: "Great, kid, don't get cocky."}})
+
+			assertNoError(t, store.UnfollowUser("Mark", "Harrison"))
+
+			got, err = store.GetTimeline("Mark", 0, 10)
+			assertNoError(t, err)
+			assertSqueaks(t, got, []SqueakPost{{Text: "I don't believe it!"}})
+		})
+	}
+}
+
+func TestInMemoryConcurrentLikes(t *testing.T) {
+	store := NewInMemoryUserStore()
+	store.CreateUser("Mark", "mark@test", "")
+	id, _ := store.PostSqueak("Mark", "I have a bad feeling about this.")
+
+	const likers = 50
+	for i := 0; i < likers; i++ {
+		store.CreateUser(fmt.Sprintf("user%d", i), fmt.Sprintf("user%d@test", i), "")
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < likers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			store.LikeSqueak(fmt.Sprintf("user%d", i), id)
+		}()
+	}
+	wg.Wait()
+
+	squeak, err := store.GetSqueak(id)
+	assertNoError(t, err)
+	assertEqual(t, squeak.LikeCount, likers)
+}
+
+// newBenchmarkStore creates users who each follow the next fifty users and
+// have posted ten squeaks each.
+func newBenchmarkStore(b *testing.B, mode TimelineMode) *InMemoryUserStore {
+	b.Helper()
+
+	const users = 500
+	store := NewInMemoryUserStore()
+	if err := store.SetTimelineMode(mode); err != nil {
+		b.Fatal(err)
+	}
+
+	for i := 0; i < users; i++ {
+		store.CreateUser(fmt.Sprintf("user%d", i), fmt.Sprintf("user%d@test", i), "")
+	}
+	for i := 0; i < users; i++ {
+		for j := 1; j <= 50; j++ {
+			store.FollowUser(fmt.Sprintf("user%d", i), fmt.Sprintf("user%d", (i+j)%users))
+		}
+	}
+	for k := 0; k < 10; k++ {
+		for i := 0; i < users; i++ {
+			store.PostSqueak(fmt.Sprintf("user%d", i), "squeak")
+		}
+	}
+
+	return store
+}
+
+func BenchmarkTimeline(b *testing.B) {
+	for name, mode := range timelineModes {
+		b.Run("read/"+name, func(b *testing.B) {
+			store := newBenchmarkStore(b, mode)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				store.GetTimeline("user0", 0, defaultPageSize)
+			}
+		})
+		b.Run("post/"+name, func(b *testing.B) {
+			store := newBenchmarkStore(b, mode)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				store.PostSqueak("user0", "squeak")
+			}
+		})
+	}
+}
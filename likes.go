@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+func (u *UserServer) likeSqueak(w http.ResponseWriter, r *http.Request) {
+	user := userFromContext(r.Context())
+
+	id, err := squeakIDFromPath(r)
+	if err != nil {
+		http.Error(w, fmt.Sprint(err), http.StatusBadRequest)
+		return
+	}
+
+	squeak, err := u.store.GetSqueak(id)
+	if err != nil {
+		if errors.Is(err, ErrSqueakNotFound) {
+			http.Error(w, fmt.Sprint(err), http.StatusNotFound)
+			return
+		}
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if !u.visibleTo(w, user.Username, squeak) || !u.allowedToInteract(w, user.Username, squeak.Author) {
+		return
+	}
+
+	if err := u.store.LikeSqueak(user.Username, id); err != nil {
+		if errors.Is(err, ErrSqueakNotFound) {
+			http.Error(w, fmt.Sprint(err), http.StatusNotFound)
+			return
+		}
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	u.notify(squeak.Author, user.Username, NotificationLike, &squeak.ID)
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (u *UserServer) unlikeSqueak(w http.ResponseWriter, r *http.Request) {
+	user := userFromContext(r.Context())
+
+	id, err := squeakIDFromPath(r)
+	if err != nil {
+		http.Error(w, fmt.Sprint(err), http.StatusBadRequest)
+		return
+	}
+
+	if err := u.store.UnlikeSqueak(user.Username, id); err != nil {
+		if errors.Is(err, ErrSqueakNotFound) {
+			http.Error(w, fmt.Sprint(err), http.StatusNotFound)
+			return
+		}
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// showLikes lists who liked a squeak the viewer may see, as if it did not
+// exist when it is protected from them or they and its author block each
+// other, and leaves out likers hidden from the viewer.
+func (u *UserServer) showLikes(w http.ResponseWriter, r *http.Request) {
+	viewer := userFromContext(r.Context())
+
+	id, err := squeakIDFromPath(r)
+	if err != nil {
+		http.Error(w, fmt.Sprint(err), http.StatusBadRequest)
+		return
+	}
+
+	squeak, err := u.store.GetSqueak(id)
+	if err != nil {
+		if errors.Is(err, ErrSqueakNotFound) {
+			http.Error(w, fmt.Sprint(err), http.StatusNotFound)
+			return
+		}
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if !u.visibleTo(w, viewerName(viewer), squeak) {
+		return
+	}
+
+	if viewer != nil {
+		blocked, err := u.store.IsBlocked(viewer.Username, squeak.Author)
+		if err != nil {
+			log.Println(err)
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+		if blocked {
+			http.Error(w, fmt.Sprint(ErrSqueakNotFound), http.StatusNotFound)
+			return
+		}
+	}
+
+	likes, err := u.store.GetSqueakLikes(id)
+	if err != nil {
+		if errors.Is(err, ErrSqueakNotFound) {
+			http.Error(w, fmt.Sprint(err), http.StatusNotFound)
+			return
+		}
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if viewer != nil {
+		hidden, err := u.store.GetHiddenUsers(viewer.Username)
+		if err != nil {
+			log.Println(err)
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		visible := likes[:0]
+		for _, user := range likes {
+			if !hidden[user.ID] {
+				visible = append(visible, user)
+			}
+		}
+		likes = visible
+	}
+
+	w.Header().Set("Content-Type", jsonContentType)
+
+	if err := json.NewEncoder(w).Encode(newPublicUsers(likes)); err != nil {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+}
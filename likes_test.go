@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLikes(t *testing.T) {
+	store := NewInMemoryUserStore()
+	server := NewUserServer(store)
+
+	store.CreateUser("Mark", "mark@test", "")
+	store.CreateUser("Harrison", "harrison@test", "")
+	id, _ := store.PostSqueak("Mark", "I have a bad feeling about this.")
+
+	token, _ := generateJWTToken("Harrison")
+
+	t.Run("it requires authentication to like", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newLikeRequest(http.MethodPut, id, ""))
+
+		assertStatus(t, response.Code, http.StatusUnauthorized)
+	})
+	t.Run("Harrison likes Mark's squeak", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newLikeRequest(http.MethodPut, id, token))
+
+		assertStatus(t, response.Code, http.StatusAccepted)
+
+		request, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("/squeaks/%d/likes", id), nil)
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertUsernames(t, getUsersFromResponse(t, response.Body), []string{"Harrison"})
+	})
+	t.Run("liking twice counts once", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newLikeRequest(http.MethodPut, id, token))
+
+		assertStatus(t, response.Code, http.StatusAccepted)
+
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, newGetSqueakRequest("Mark"))
+
+		got := getUserSqueaksFromResponse(t, response.Body)
+		assertEqual(t, got[0].LikeCount, 1)
+	})
+	t.Run("anonymous viewers get no likedByMe flag", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newGetSqueakRequest("Mark"))
+
+		got := getUserSqueaksFromResponse(t, response.Body)
+		if got[0].LikedByMe != nil {
+			t.Errorf("got likedByMe %v want it left out", *got[0].LikedByMe)
+		}
+	})
+	t.Run("authenticated viewers get the likedByMe flag", func(t *testing.T) {
+		request := newGetSqueakRequest("Mark")
+		request.Header.Set("Cookie", "Authorization="+token)
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+
+		got := getUserSqueaksFromResponse(t, response.Body)
+		assertEqual(t, *got[0].LikedByMe, true)
+
+		request = newUserbaseRequest()
+		markToken, _ := generateJWTToken("Mark")
+		request.Header.Set("Cookie", "Authorization="+markToken)
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+
+		userbase := getUserbaseFromResponse(t, response.Body)
+		assertEqual(t, userbase[0].Squeaks[0].LikeCount, 1)
+		assertEqual(t, *userbase[0].Squeaks[0].LikedByMe, false)
+	})
+	t.Run("Harrison unlikes Mark's squeak", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newLikeRequest(http.MethodDelete, id, token))
+
+		assertStatus(t, response.Code, http.StatusAccepted)
+
+		squeak, _ := store.GetSqueak(id)
+		assertEqual(t, squeak.LikeCount, 0)
+	})
+	t.Run("only lists likes of squeaks the viewer may see", func(t *testing.T) {
+		store.CreateUser("Carrie", "carrie@test", "")
+		carrieToken, _ := generateJWTToken("Carrie")
+		store.LikeSqueak("Harrison", id)
+
+		showLikes := func(t testing.TB, token string, want int) []User {
+			t.Helper()
+
+			response := httptest.NewRecorder()
+			server.ServeHTTP(response, newAuthenticatedRequest(http.MethodGet, fmt.Sprintf("/squeaks/%d/likes", id), nil, token))
+			assertStatus(t, response.Code, want)
+			if want != http.StatusOK {
+				return nil
+			}
+			return getUsersFromResponse(t, response.Body)
+		}
+
+		store.MuteUser("Carrie", "Harrison")
+		assertUsernames(t, showLikes(t, carrieToken, http.StatusOK), []string{})
+		assertUsernames(t, showLikes(t, "", http.StatusOK), []string{"Harrison"})
+
+		store.UpdateProfile("Mark", User{Protected: true})
+		showLikes(t, "", http.StatusNotFound)
+		store.UpdateProfile("Mark", User{})
+
+		store.BlockUser("Mark", "Carrie")
+		showLikes(t, carrieToken, http.StatusNotFound)
+	})
+	t.Run("returns 404 when liking a missing squeak", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newLikeRequest(http.MethodPut, 42, token))
+
+		assertStatus(t, response.Code, http.StatusNotFound)
+	})
+}
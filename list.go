@@ -0,0 +1,279 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const maxListNameLength = 50
+
+var ErrListNotFound = errors.New("list not found")
+
+// List is a named group of users curated by its owner, independent of who
+// the owner follows. Private lists are only visible to their owner.
+type List struct {
+	ID          int       `json:"id"`
+	OwnerID     int       `json:"ownerId"`
+	Owner       string    `json:"owner"`
+	Name        string    `json:"name"`
+	Private     bool      `json:"private"`
+	MemberCount int       `json:"memberCount"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+func validateListName(name string) error {
+	if name == "" {
+		return errors.New("list name must not be empty")
+	}
+	if len([]rune(name)) > maxListNameLength {
+		return fmt.Errorf("list name must not be longer than %d characters", maxListNameLength)
+	}
+	return nil
+}
+
+const listContextKey contextKey = "list"
+
+// listFromContext returns the list that requiresListAccess stored in the
+// request context.
+func listFromContext(ctx context.Context) *List {
+	list, _ := ctx.Value(listContextKey).(*List)
+	return list
+}
+
+// requiresListAccess loads list {id} into the request context. Private
+// lists are reported as not found to everyone but their owner.
+func (u *UserServer) requiresListAccess(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil || id < 1 {
+			http.Error(w, "invalid list id", http.StatusBadRequest)
+			return
+		}
+
+		list, err := u.store.GetList(id)
+		if err != nil {
+			if errors.Is(err, ErrListNotFound) {
+				http.Error(w, fmt.Sprint(err), http.StatusNotFound)
+				return
+			}
+			log.Println(err)
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		if user := userFromContext(r.Context()); list.Private && (user == nil || user.ID != list.OwnerID) {
+			http.Error(w, fmt.Sprint(ErrListNotFound), http.StatusNotFound)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), listContextKey, list)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// requiresListOwner only lets the owner of the list in the request context
+// through. It has to be wrapped in requiresAuthentication and
+// requiresListAccess.
+func (u *UserServer) requiresListOwner(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if listFromContext(r.Context()).OwnerID != userFromContext(r.Context()).ID {
+			http.Error(w, "only the owner can change this list", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (u *UserServer) createList(w http.ResponseWriter, r *http.Request) {
+	user := userFromContext(r.Context())
+
+	var body struct {
+		Name    string `json:"name"`
+		Private bool   `json:"private"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "failed to decode JSON payload", http.StatusBadRequest)
+		return
+	}
+
+	if err := validateListName(body.Name); err != nil {
+		http.Error(w, fmt.Sprint(err), http.StatusBadRequest)
+		return
+	}
+
+	id, err := u.store.CreateList(user.Username, body.Name, body.Private)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	u.respondWithList(w, id)
+}
+
+// updateList renames the list and changes its visibility, taking both from
+// the request body.
+func (u *UserServer) updateList(w http.ResponseWriter, r *http.Request) {
+	list := listFromContext(r.Context())
+
+	var body struct {
+		Name    string `json:"name"`
+		Private bool   `json:"private"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "failed to decode JSON payload", http.StatusBadRequest)
+		return
+	}
+
+	if err := validateListName(body.Name); err != nil {
+		http.Error(w, fmt.Sprint(err), http.StatusBadRequest)
+		return
+	}
+
+	if err := u.store.UpdateList(list.ID, body.Name, body.Private); err != nil {
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	u.respondWithList(w, list.ID)
+}
+
+func (u *UserServer) respondWithList(w http.ResponseWriter, id int) {
+	list, err := u.store.GetList(id)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", jsonContentType)
+	w.WriteHeader(http.StatusAccepted)
+
+	if err := json.NewEncoder(w).Encode(list); err != nil {
+		log.Println(err)
+	}
+}
+
+func (u *UserServer) deleteList(w http.ResponseWriter, r *http.Request) {
+	if err := u.store.DeleteList(listFromContext(r.Context()).ID); err != nil {
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (u *UserServer) showList(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", jsonContentType)
+
+	if err := json.NewEncoder(w).Encode(listFromContext(r.Context())); err != nil {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// showLists lists the lists owned by user {name}, including private ones
+// only when they are asking themselves.
+func (u *UserServer) showLists(w http.ResponseWriter, r *http.Request) {
+	owner, err := u.store.GetUserByUsername(r.PathValue("name"))
+	if err != nil {
+		http.Error(w, fmt.Sprint(err), http.StatusNotFound)
+		return
+	}
+
+	user := userFromContext(r.Context())
+
+	lists, err := u.store.GetLists(owner.Username, user != nil && user.ID == owner.ID)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", jsonContentType)
+
+	if err := json.NewEncoder(w).Encode(lists); err != nil {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (u *UserServer) showListMembers(w http.ResponseWriter, r *http.Request) {
+	members, err := u.store.GetListMembers(listFromContext(r.Context()).ID)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", jsonContentType)
+
+	if err := json.NewEncoder(w).Encode(newPublicUsers(members)); err != nil {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// changeListMember applies change to the list in the request context and
+// user {name}.
+func (u *UserServer) changeListMember(change func(id int, name string) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+
+		if _, err := u.store.GetUserByUsername(name); err != nil {
+			http.Error(w, fmt.Sprint(err), http.StatusNotFound)
+			return
+		}
+
+		if err := change(listFromContext(r.Context()).ID, name); err != nil {
+			log.Println(err)
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+// showListTimeline shows the squeaks of the list's members, newest first,
+// paginated like the home timeline.
+func (u *UserServer) showListTimeline(w http.ResponseWriter, r *http.Request) {
+	cursor, limit, err := parsePagination(r)
+	if err != nil {
+		http.Error(w, fmt.Sprint(err), http.StatusBadRequest)
+		return
+	}
+
+	squeaks, err := u.store.GetListTimeline(listFromContext(r.Context()).ID, cursor, limit+1)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	page := newSqueakPage(squeaks, limit)
+	page.Squeaks, err = u.prepareSqueaks(userFromContext(r.Context()), page.Squeaks)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", jsonContentType)
+
+	if err := json.NewEncoder(w).Encode(page); err != nil {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLists(t *testing.T) {
+	store := NewInMemoryUserStore()
+	server := NewUserServer(store)
+
+	store.CreateUser("Rob", "rob@test", "")
+	store.CreateUser("Russ", "russ@test", "")
+	store.CreateUser("Ian", "ian@test", "")
+	store.CreateUser("Gopher", "gopher@test", "")
+	store.PostSqueak("Russ", "Go 1.0 is out")
+	store.PostSqueak("Gopher", "Not on the list")
+	store.PostSqueak("Ian", "Generics are coming")
+	store.PostSqueak("Russ", "Module mirror is live")
+
+	robToken, _ := generateJWTToken("Rob")
+	gopherToken, _ := generateJWTToken("Gopher")
+
+	var core, friends List
+
+	t.Run("it requires authentication to create a list", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newListRequest(http.MethodPost, "/lists", []byte(`{"name": "Go core"}`), ""))
+		assertStatus(t, response.Code, http.StatusUnauthorized)
+	})
+	t.Run("rejects an empty name", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newListRequest(http.MethodPost, "/lists", []byte(`{"name": ""}`), robToken))
+		assertStatus(t, response.Code, http.StatusBadRequest)
+	})
+	t.Run("creates public and private lists", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newListRequest(http.MethodPost, "/lists", []byte(`{"name": "Go core"}`), robToken))
+		assertStatus(t, response.Code, http.StatusAccepted)
+		assertNoError(t, json.NewDecoder(response.Body).Decode(&core))
+		assertEqual(t, core.Owner, "Rob")
+		assertEqual(t, core.Private, false)
+
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, newListRequest(http.MethodPost, "/lists", []byte(`{"name": "Friends", "private": true}`), robToken))
+		assertStatus(t, response.Code, http.StatusAccepted)
+		assertNoError(t, json.NewDecoder(response.Body).Decode(&friends))
+		assertEqual(t, friends.Private, true)
+	})
+	t.Run("only the owner changes members", func(t *testing.T) {
+		for _, name := range []string{"Russ", "Ian"} {
+			response := httptest.NewRecorder()
+			server.ServeHTTP(response, newListRequest(http.MethodPut, fmt.Sprintf("/lists/%d/members/%s", core.ID, name), nil, robToken))
+			assertStatus(t, response.Code, http.StatusAccepted)
+		}
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newListRequest(http.MethodPut, fmt.Sprintf("/lists/%d/members/Gopher", core.ID), nil, gopherToken))
+		assertStatus(t, response.Code, http.StatusForbidden)
+
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, newListRequest(http.MethodPut, fmt.Sprintf("/lists/%d/members/Nobody", core.ID), nil, robToken))
+		assertStatus(t, response.Code, http.StatusNotFound)
+
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, newListRequest(http.MethodGet, fmt.Sprintf("/lists/%d/members", core.ID), nil, ""))
+		assertStatus(t, response.Code, http.StatusOK)
+		assertUsernames(t, getUsersFromResponse(t, response.Body), []string{"Ian", "Russ"})
+	})
+	t.Run("the list timeline shows members' squeaks newest first", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newListRequest(http.MethodGet, fmt.Sprintf("/lists/%d/timeline?limit=2", core.ID), nil, ""))
+		assertStatus(t, response.Code, http.StatusOK)
+
+		page := getSqueakPageFromResponse(t, response.Body)
+		assertEqual(t, len(page.Squeaks), 2)
+		assertEqual(t, page.Squeaks[0].Text, "Module mirror is live")
+		assertEqual(t, page.Squeaks[1].Text, "Generics are coming")
+
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, newListRequest(http.MethodGet, fmt.Sprintf("/lists/%d/timeline?limit=2&cursor=%s", core.ID, page.NextCursor), nil, ""))
+
+		page = getSqueakPageFromResponse(t, response.Body)
+		assertEqual(t, len(page.Squeaks), 1)
+		assertEqual(t, page.Squeaks[0].Text, "Go 1.0 is out")
+		assertEqual(t, page.NextCursor, "")
+	})
+	t.Run("private lists are hidden from everyone but the owner", func(t *testing.T) {
+		for _, path := range []string{"", "/members", "/timeline"} {
+			response := httptest.NewRecorder()
+			server.ServeHTTP(response, newListRequest(http.MethodGet, fmt.Sprintf("/lists/%d%s", friends.ID, path), nil, gopherToken))
+			assertStatus(t, response.Code, http.StatusNotFound)
+
+			response = httptest.NewRecorder()
+			server.ServeHTTP(response, newListRequest(http.MethodGet, fmt.Sprintf("/lists/%d%s", friends.ID, path), nil, robToken))
+			assertStatus(t, response.Code, http.StatusOK)
+		}
+
+		var lists []List
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newListRequest(http.MethodGet, "/users/Rob/lists", nil, gopherToken))
+		assertNoError(t, json.NewDecoder(response.Body).Decode(&lists))
+		assertEqual(t, len(lists), 1)
+		assertEqual(t, lists[0].MemberCount, 2)
+
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, newListRequest(http.MethodGet, "/users/Rob/lists", nil, robToken))
+		assertNoError(t, json.NewDecoder(response.Body).Decode(&lists))
+		assertEqual(t, len(lists), 2)
+	})
+	t.Run("updates and deletes lists", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newListRequest(http.MethodPatch, fmt.Sprintf("/lists/%d", core.ID), []byte(`{"name": "Go team", "private": true}`), gopherToken))
+		assertStatus(t, response.Code, http.StatusForbidden)
+
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, newListRequest(http.MethodPatch, fmt.Sprintf("/lists/%d", core.ID), []byte(`{"name": "Go team", "private": true}`), robToken))
+		assertStatus(t, response.Code, http.StatusAccepted)
+
+		var updated List
+		assertNoError(t, json.NewDecoder(response.Body).Decode(&updated))
+		assertEqual(t, updated.Name, "Go team")
+		assertEqual(t, updated.Private, true)
+
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, newListRequest(http.MethodDelete, fmt.Sprintf("/lists/%d/members/Ian", core.ID), nil, robToken))
+		assertStatus(t, response.Code, http.StatusAccepted)
+
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, newListRequest(http.MethodDelete, fmt.Sprintf("/lists/%d", core.ID), nil, robToken))
+		assertStatus(t, response.Code, http.StatusAccepted)
+
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, newListRequest(http.MethodGet, fmt.Sprintf("/lists/%d", core.ID), nil, robToken))
+		assertStatus(t, response.Code, http.StatusNotFound)
+	})
+}
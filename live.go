@@ -0,0 +1,302 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// livePingInterval is how often the server pings an idle connection.
+	livePingInterval = 30 * time.Second
+	// livePongWait is how long the server waits to hear anything from the
+	// client, a pong included, before it gives up on the connection.
+	livePongWait = 60 * time.Second
+	// liveSendBuffer is how many messages may queue up for a client. A
+	// client that falls further behind is disconnected.
+	liveSendBuffer = 64
+	// liveWriteWait is how long a single write to the client may take.
+	liveWriteWait = 10 * time.Second
+	// maxLiveMessage is the largest message a client may send.
+	maxLiveMessage = 4096
+)
+
+// liveUpgrader refuses cross-origin handshakes, since the connection is
+// authenticated by cookie.
+var liveUpgrader = websocket.Upgrader{}
+
+// LiveMessage is a message of the WebSocket protocol spoken at /ws, in
+// either direction. The README describes the protocol.
+type LiveMessage struct {
+	Type   string      `json:"type"`
+	ID     string      `json:"id,omitempty"`
+	Users  []string    `json:"users,omitempty"`
+	Text   string      `json:"text,omitempty"`
+	Squeak *SqueakPost `json:"squeak,omitempty"`
+	Error  string      `json:"error,omitempty"`
+}
+
+// liveSubscription is a session's subscription to one user's squeaks.
+// cancelled tells an end the session asked for from one the broker forced.
+type liveSubscription struct {
+	cancel    func()
+	cancelled bool
+}
+
+// liveSession is one client connected at /ws.
+type liveSession struct {
+	u      *UserServer
+	viewer *User
+	conn   *websocket.Conn
+	send   chan []byte
+	done   chan struct{}
+
+	mu            sync.Mutex
+	subscriptions map[int]*liveSubscription
+	closeOnce     sync.Once
+}
+
+func (u *UserServer) serveLive(w http.ResponseWriter, r *http.Request) {
+	conn, err := liveUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+
+	s := &liveSession{
+		u:             u,
+		viewer:        userFromContext(r.Context()),
+		conn:          conn,
+		send:          make(chan []byte, liveSendBuffer),
+		done:          make(chan struct{}),
+		subscriptions: map[int]*liveSubscription{},
+	}
+	defer s.end()
+
+	go s.writeLoop()
+	s.readLoop()
+}
+
+// end cancels the subscriptions of the session and closes the connection.
+func (s *liveSession) end() {
+	s.closeOnce.Do(func() {
+		close(s.done)
+		s.conn.Close()
+	})
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for userID := range s.subscriptions {
+		s.cancelSubscription(userID)
+	}
+}
+
+// cancelSubscription ends the subscription to userID. s.mu must be held.
+func (s *liveSession) cancelSubscription(userID int) {
+	if subscription, ok := s.subscriptions[userID]; ok {
+		delete(s.subscriptions, userID)
+		subscription.cancelled = true
+		subscription.cancel()
+	}
+}
+
+// closeSlow disconnects a client that does not keep up with its messages.
+func (s *liveSession) closeSlow() {
+	s.closeOnce.Do(func() {
+		close(s.done)
+		go s.close(websocket.ClosePolicyViolation, "client too slow")
+	})
+}
+
+// close sends a close message with code and reason and closes the
+// connection without waiting for the client to answer.
+func (s *liveSession) close(code int, reason string) {
+	message := websocket.FormatCloseMessage(code, reason)
+	s.conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(liveWriteWait))
+	s.conn.Close()
+}
+
+// reply queues message for the client without ever blocking.
+func (s *liveSession) reply(message LiveMessage) {
+	data, err := json.Marshal(message)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	select {
+	case s.send <- data:
+	case <-s.done:
+	default:
+		s.closeSlow()
+	}
+}
+
+func (s *liveSession) writeLoop() {
+	ping := time.NewTicker(livePingInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case data := <-s.send:
+			s.conn.SetWriteDeadline(time.Now().Add(liveWriteWait))
+			if err := s.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+				s.end()
+				return
+			}
+		case <-ping.C:
+			if err := s.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(liveWriteWait)); err != nil {
+				s.end()
+				return
+			}
+		}
+	}
+}
+
+func (s *liveSession) readLoop() {
+	alive := func(string) error {
+		return s.conn.SetReadDeadline(time.Now().Add(livePongWait))
+	}
+	alive("")
+	s.conn.SetPongHandler(alive)
+	s.conn.SetReadLimit(maxLiveMessage)
+
+	for {
+		messageType, data, err := s.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		alive("")
+
+		if messageType != websocket.TextMessage {
+			s.close(websocket.CloseUnsupportedData, "only text messages are supported")
+			return
+		}
+		if !utf8.Valid(data) {
+			s.close(websocket.CloseInvalidFramePayloadData, "invalid UTF-8")
+			return
+		}
+
+		var message LiveMessage
+		if err := json.Unmarshal(data, &message); err != nil {
+			s.reply(LiveMessage{Type: "error", Error: "failed to decode JSON message"})
+			continue
+		}
+
+		switch message.Type {
+		case "subscribe":
+			s.subscribe(message)
+		case "unsubscribe":
+			s.unsubscribe(message)
+		case "squeak":
+			s.postSqueak(message)
+		case "ping":
+			s.reply(LiveMessage{Type: "pong", ID: message.ID})
+		default:
+			s.reply(LiveMessage{Type: "error", ID: message.ID, Error: fmt.Sprintf("unknown message type %q", message.Type)})
+		}
+	}
+}
+
+func (s *liveSession) subscribe(message LiveMessage) {
+	users := make([]*User, 0, len(message.Users))
+	for _, name := range message.Users {
+		user, err := s.u.store.GetUserByUsername(name)
+		if err != nil {
+			s.reply(LiveMessage{Type: "error", ID: message.ID, Error: fmt.Sprint(err)})
+			return
+		}
+		users = append(users, user)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, user := range users {
+		if _, ok := s.subscriptions[user.ID]; ok {
+			continue
+		}
+		if len(s.subscriptions) == maxStreamUsers {
+			s.reply(LiveMessage{Type: "error", ID: message.ID, Error: fmt.Sprintf("cannot subscribe to more than %d users", maxStreamUsers)})
+			return
+		}
+
+		squeaks, cancel := s.u.broker.Subscribe([]int{user.ID})
+		subscription := &liveSubscription{cancel: cancel}
+		s.subscriptions[user.ID] = subscription
+		go s.forward(subscription, squeaks)
+	}
+
+	s.reply(LiveMessage{Type: "ack", ID: message.ID})
+}
+
+func (s *liveSession) unsubscribe(message LiveMessage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, name := range message.Users {
+		user, err := s.u.store.GetUserByUsername(name)
+		if err != nil {
+			continue
+		}
+		s.cancelSubscription(user.ID)
+	}
+
+	s.reply(LiveMessage{Type: "ack", ID: message.ID})
+}
+
+// forward pushes the squeaks of one subscription to the client. When the
+// broker ends the subscription on its own, the client fell behind.
+func (s *liveSession) forward(subscription *liveSubscription, squeaks <-chan SqueakPost) {
+	for squeak := range squeaks {
+		prepared, err := s.u.prepareSqueaks(s.viewer, []SqueakPost{squeak})
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		if len(prepared) == 0 {
+			continue
+		}
+		s.reply(LiveMessage{Type: "squeak", Squeak: &prepared[0]})
+	}
+
+	s.mu.Lock()
+	cancelled := subscription.cancelled
+	s.mu.Unlock()
+
+	if !cancelled {
+		s.closeSlow()
+	}
+}
+
+func (s *liveSession) postSqueak(message LiveMessage) {
+	if err := validateSqueakText(message.Text); err != nil {
+		s.reply(LiveMessage{Type: "error", ID: message.ID, Error: fmt.Sprint(err)})
+		return
+	}
+
+	id, err := s.u.store.PostSqueak(s.viewer.Username, message.Text)
+	if err != nil {
+		log.Println(err)
+		s.reply(LiveMessage{Type: "error", ID: message.ID, Error: "internal server error"})
+		return
+	}
+
+	squeak, err := s.u.store.GetSqueak(id)
+	if err != nil {
+		log.Println(err)
+		s.reply(LiveMessage{Type: "error", ID: message.ID, Error: "internal server error"})
+		return
+	}
+
+	s.reply(LiveMessage{Type: "ack", ID: message.ID, Squeak: squeak})
+	s.u.afterSqueakPosted(*squeak)
+}
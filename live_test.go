@@ -0,0 +1,185 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func dialLive(t testing.TB, server *httptest.Server, token string) (*websocket.Conn, *http.Response) {
+	t.Helper()
+
+	header := http.Header{}
+	if token != "" {
+		header.Set("Cookie", "Authorization="+token)
+	}
+
+	conn, response, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws", header)
+	if err != nil && err != websocket.ErrBadHandshake {
+		t.Fatal(err)
+	}
+	if conn != nil {
+		t.Cleanup(func() { conn.Close() })
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	}
+
+	return conn, response
+}
+
+func receive(t testing.TB, conn *websocket.Conn) (message LiveMessage) {
+	t.Helper()
+
+	if err := conn.ReadJSON(&message); err != nil {
+		t.Fatal(err)
+	}
+
+	return
+}
+
+func assertClosedWith(t testing.TB, conn *websocket.Conn, code int) {
+	t.Helper()
+
+	_, _, err := conn.ReadMessage()
+	if !websocket.IsCloseError(err, code) {
+		t.Errorf("got %v, want close code %d", err, code)
+	}
+}
+
+func TestLive(t *testing.T) {
+	store := NewInMemoryUserStore()
+	server := NewUserServer(store)
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+
+	store.CreateUser("Mark", "mark@test", "")
+	store.CreateUser("Carrie", "carrie@test", "")
+
+	carrieToken, _ := generateJWTToken("Carrie")
+	markToken, _ := generateJWTToken("Mark")
+
+	t.Run("it requires authentication", func(t *testing.T) {
+		_, response := dialLive(t, httpServer, "")
+
+		assertStatus(t, response.StatusCode, http.StatusUnauthorized)
+	})
+	t.Run("completes the handshake", func(t *testing.T) {
+		_, response := dialLive(t, httpServer, carrieToken)
+
+		assertStatus(t, response.StatusCode, http.StatusSwitchingProtocols)
+	})
+	t.Run("refuses cross-origin handshakes", func(t *testing.T) {
+		header := http.Header{}
+		header.Set("Cookie", "Authorization="+carrieToken)
+		header.Set("Origin", "http://evil.test")
+
+		_, response, _ := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(httpServer.URL, "http")+"/ws", header)
+
+		assertStatus(t, response.StatusCode, http.StatusForbidden)
+	})
+	t.Run("pushes squeaks of subscribed users", func(t *testing.T) {
+		carrie, _ := dialLive(t, httpServer, carrieToken)
+		carrie.WriteJSON(LiveMessage{Type: "subscribe", ID: "1", Users: []string{"Mark"}})
+		ack := receive(t, carrie)
+		assertEqual(t, ack.Type, "ack")
+		assertEqual(t, ack.ID, "1")
+
+		mark, _ := dialLive(t, httpServer, markToken)
+		mark.WriteJSON(LiveMessage{Type: "squeak", ID: "2", Text: "Live from the Falcon"})
+
+		ack = receive(t, mark)
+		assertEqual(t, ack.Type, "ack")
+		assertEqual(t, ack.Squeak.Text, "Live from the Falcon")
+
+		pushed := receive(t, carrie)
+		assertEqual(t, pushed.Type, "squeak")
+		assertEqual(t, pushed.Squeak.Text, "Live from the Falcon")
+	})
+	t.Run("reports invalid messages", func(t *testing.T) {
+		carrie, _ := dialLive(t, httpServer, carrieToken)
+
+		carrie.WriteJSON(LiveMessage{Type: "subscribe", ID: "1", Users: []string{"Nobody"}})
+		assertEqual(t, receive(t, carrie).Type, "error")
+
+		carrie.WriteJSON(LiveMessage{Type: "squeak", ID: "2", Text: ""})
+		assertEqual(t, receive(t, carrie).Type, "error")
+
+		carrie.WriteJSON(LiveMessage{Type: "dance", ID: "3"})
+		assertEqual(t, receive(t, carrie).Error, `unknown message type "dance"`)
+	})
+	t.Run("answers pings", func(t *testing.T) {
+		carrie, _ := dialLive(t, httpServer, carrieToken)
+
+		pongs := make(chan string, 1)
+		carrie.SetPongHandler(func(data string) error {
+			pongs <- data
+			return nil
+		})
+
+		carrie.WriteControl(websocket.PingMessage, []byte("hello"), time.Now().Add(time.Second))
+		carrie.WriteJSON(LiveMessage{Type: "ping", ID: "1"})
+		pong := receive(t, carrie)
+		assertEqual(t, pong.Type, "pong")
+		assertEqual(t, pong.ID, "1")
+
+		select {
+		case data := <-pongs:
+			assertEqual(t, data, "hello")
+		default:
+			t.Error("got no pong")
+		}
+	})
+	t.Run("rejects binary messages", func(t *testing.T) {
+		carrie, _ := dialLive(t, httpServer, carrieToken)
+
+		carrie.WriteMessage(websocket.BinaryMessage, []byte("{}"))
+		assertClosedWith(t, carrie, websocket.CloseUnsupportedData)
+	})
+	t.Run("rejects invalid UTF-8", func(t *testing.T) {
+		carrie, _ := dialLive(t, httpServer, carrieToken)
+
+		carrie.WriteMessage(websocket.TextMessage, []byte{'"', 0xff, '"'})
+		assertClosedWith(t, carrie, websocket.CloseInvalidFramePayloadData)
+	})
+	t.Run("rejects messages that are too big", func(t *testing.T) {
+		carrie, _ := dialLive(t, httpServer, carrieToken)
+
+		carrie.WriteMessage(websocket.TextMessage, make([]byte, maxLiveMessage+1))
+		assertClosedWith(t, carrie, websocket.CloseMessageTooBig)
+	})
+}
+
+func TestLiveDisconnectsSlowClients(t *testing.T) {
+	sessions := make(chan *liveSession, 1)
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := liveUpgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		sessions <- &liveSession{
+			conn:          conn,
+			send:          make(chan []byte, liveSendBuffer),
+			done:          make(chan struct{}),
+			subscriptions: map[int]*liveSubscription{},
+		}
+	}))
+	defer httpServer.Close()
+
+	client, _ := dialLive(t, httpServer, "")
+	s := <-sessions
+
+	for i := 0; i <= liveSendBuffer; i++ {
+		s.reply(LiveMessage{Type: "pong"})
+	}
+
+	select {
+	case <-s.done:
+	case <-time.After(time.Second):
+		t.Fatal("slow client was not disconnected")
+	}
+
+	assertClosedWith(t, client, websocket.ClosePolicyViolation)
+}
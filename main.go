@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
 	"os"
@@ -13,6 +14,26 @@ func main() {
 	}
 
 	initializeDatabase(db)
-	server := NewUserServer(NewPostgreSQLUserStore(db))
+	store := NewPostgreSQLUserStore(db)
+
+	timelineMode, err := parseTimelineMode(os.Getenv("TIMELINE_MODE"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := store.SetTimelineMode(timelineMode); err != nil {
+		log.Fatalf("problem setting timeline mode: %v", err)
+	}
+
+	mediaDir := os.Getenv("MEDIA_DIR")
+	if mediaDir == "" {
+		mediaDir = "media"
+	}
+	blobs, err := NewLocalBlobStore(mediaDir)
+	if err != nil {
+		log.Fatalf("problem opening media storage: %v", err)
+	}
+
+	server := NewUserServer(store, WithBlobStore(blobs))
+	go server.RunScheduler(context.Background(), schedulerInterval)
 	log.Fatal(http.ListenAndServe(":8000", server))
 }
@@ -0,0 +1,481 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+)
+
+const (
+	maxMediaSize = 5 << 20
+	// maxMediaFormOverhead allows for the multipart boundaries and headers
+	// around an upload of maxMediaSize.
+	maxMediaFormOverhead = 64 << 10
+	// maxMediaDimension keeps small files from decoding into huge images.
+	maxMediaDimension = 4096
+	maxSqueakMedia    = 4
+	thumbnailSize     = 320
+	jpegQuality       = 85
+	// maxGIFFrames and maxGIFPixels, the pixels of all frames together,
+	// bound the memory decoding an animation takes.
+	maxGIFFrames = 100
+	maxGIFPixels = 64 << 20
+)
+
+var ErrMediaNotFound = errors.New("media not found")
+
+// Media is an image uploaded by OwnerID, attached to at most one squeak.
+// The image is served at /media/{id} and a thumbnail of it at
+// /media/{id}/thumbnail.
+type Media struct {
+	ID          int       `json:"id"`
+	OwnerID     int       `json:"ownerId"`
+	SqueakID    *int      `json:"squeakId,omitempty"`
+	ContentType string    `json:"contentType"`
+	Width       int       `json:"width"`
+	Height      int       `json:"height"`
+	Size        int       `json:"size"`
+	CreatedAt   time.Time `json:"createdAt"`
+	// Key names the image in the BlobStore, its thumbnail being stored
+	// under thumbnailKey(Key).
+	Key string `json:"-"`
+}
+
+func thumbnailKey(key string) string {
+	return key + "-thumbnail"
+}
+
+// thumbnailContentType is the type of the thumbnails made for images of
+// contentType: photos stay JPEG, everything else becomes PNG to keep
+// transparency.
+func thumbnailContentType(contentType string) string {
+	if contentType == "image/jpeg" {
+		return "image/jpeg"
+	}
+	return "image/png"
+}
+
+func newBlobKey() (string, error) {
+	key := make([]byte, 16)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(key), nil
+}
+
+// processedImage is an upload ready to be stored.
+type processedImage struct {
+	contentType   string
+	width, height int
+	data          []byte
+	thumbnail     []byte
+}
+
+// processImage checks that data is a JPEG, PNG or GIF image by sniffing its
+// content rather than trusting the client, then decodes and encodes it
+// again. Only pixels survive that, so EXIF and other metadata are dropped.
+func processImage(data []byte) (*processedImage, error) {
+	contentType := http.DetectContentType(data)
+
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || "image/"+format != contentType {
+		return nil, errors.New("only JPEG, PNG and GIF images can be uploaded")
+	}
+	if config.Width > maxMediaDimension || config.Height > maxMediaDimension {
+		return nil, fmt.Errorf("images must not be larger than %dx%d pixels", maxMediaDimension, maxMediaDimension)
+	}
+
+	processed := &processedImage{contentType: contentType, width: config.Width, height: config.Height}
+
+	var first image.Image
+	var encoded bytes.Buffer
+	switch contentType {
+	case "image/gif":
+		if err := checkGIFFrames(data); err != nil {
+			return nil, err
+		}
+		animation, err := gif.DecodeAll(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("invalid image: %w", err)
+		}
+		first = animation.Image[0]
+		// Keep the animation but none of the extensions holding comments.
+		err = gif.EncodeAll(&encoded, &gif.GIF{
+			Image: animation.Image, Delay: animation.Delay, LoopCount: animation.LoopCount,
+			Disposal: animation.Disposal, Config: animation.Config, BackgroundIndex: animation.BackgroundIndex,
+		})
+		if err != nil {
+			return nil, err
+		}
+	default:
+		first, _, err = image.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("invalid image: %w", err)
+		}
+		if err := encodeImage(&encoded, first, contentType); err != nil {
+			return nil, err
+		}
+	}
+	processed.data = encoded.Bytes()
+
+	var thumb bytes.Buffer
+	if err := encodeImage(&thumb, thumbnail(first, thumbnailSize), thumbnailContentType(contentType)); err != nil {
+		return nil, err
+	}
+	processed.thumbnail = thumb.Bytes()
+
+	return processed, nil
+}
+
+// checkGIFFrames walks the blocks of a GIF without decoding any pixels and
+// rejects animations with more than maxGIFFrames frames or maxGIFPixels
+// pixels across all of them.
+func checkGIFFrames(data []byte) error {
+	invalid := errors.New("invalid image: malformed GIF")
+
+	// The header and logical screen descriptor take 13 bytes, followed by
+	// the global color table if the descriptor says there is one.
+	if len(data) < 13 {
+		return invalid
+	}
+	pos := 13
+	if data[10]&0x80 != 0 {
+		pos += 3 << (data[10]&0x07 + 1)
+	}
+
+	skipSubBlocks := func() bool {
+		for pos < len(data) {
+			size := int(data[pos])
+			pos += 1 + size
+			if size == 0 {
+				return pos <= len(data)
+			}
+		}
+		return false
+	}
+
+	frames, pixels := 0, 0
+	for pos < len(data) {
+		switch data[pos] {
+		case 0x21: // extension: introducer, label and sub-blocks
+			pos += 2
+			if !skipSubBlocks() {
+				return invalid
+			}
+		case 0x2c: // image descriptor, color table, LZW code size and sub-blocks
+			if pos+10 > len(data) {
+				return invalid
+			}
+			width := int(data[pos+5]) | int(data[pos+6])<<8
+			height := int(data[pos+7]) | int(data[pos+8])<<8
+			packed := data[pos+9]
+			pos += 10
+			if packed&0x80 != 0 {
+				pos += 3 << (packed&0x07 + 1)
+			}
+			pos++
+			if !skipSubBlocks() {
+				return invalid
+			}
+
+			frames++
+			pixels += width * height
+			if frames > maxGIFFrames {
+				return fmt.Errorf("animations must not have more than %d frames", maxGIFFrames)
+			}
+			if pixels > maxGIFPixels {
+				return fmt.Errorf("animations must not have more than %d pixels across all frames", maxGIFPixels)
+			}
+		case 0x3b: // trailer
+			return nil
+		default:
+			return invalid
+		}
+	}
+
+	return invalid
+}
+
+func encodeImage(w io.Writer, img image.Image, contentType string) error {
+	if contentType == "image/jpeg" {
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: jpegQuality})
+	}
+	return png.Encode(w, img)
+}
+
+// thumbnail scales img down to fit within size by size pixels, averaging
+// the source pixels behind every pixel of the thumbnail. Images that fit
+// already are copied as they are.
+func thumbnail(img image.Image, size int) image.Image {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	thumbWidth, thumbHeight := width, height
+	if width > size || height > size {
+		if width >= height {
+			thumbWidth, thumbHeight = size, max(1, height*size/width)
+		} else {
+			thumbWidth, thumbHeight = max(1, width*size/height), size
+		}
+	}
+
+	thumb := image.NewRGBA64(image.Rect(0, 0, thumbWidth, thumbHeight))
+	for y := 0; y < thumbHeight; y++ {
+		y0 := bounds.Min.Y + y*height/thumbHeight
+		y1 := max(y0+1, bounds.Min.Y+(y+1)*height/thumbHeight)
+
+		for x := 0; x < thumbWidth; x++ {
+			x0 := bounds.Min.X + x*width/thumbWidth
+			x1 := max(x0+1, bounds.Min.X+(x+1)*width/thumbWidth)
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					pr, pg, pb, pa := img.At(sx, sy).RGBA()
+					r, g, b, a = r+uint64(pr), g+uint64(pg), b+uint64(pb), a+uint64(pa)
+					n++
+				}
+			}
+
+			thumb.SetRGBA64(x, y, color.RGBA64{R: uint16(r / n), G: uint16(g / n), B: uint16(b / n), A: uint16(a / n)})
+		}
+	}
+
+	return thumb
+}
+
+// uploadMedia stores the image sent as the file field of a multipart form
+// and answers with its Media, ready to be attached to a squeak.
+func (u *UserServer) uploadMedia(w http.ResponseWriter, r *http.Request) {
+	user := userFromContext(r.Context())
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxMediaSize+maxMediaFormOverhead)
+
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, fmt.Sprintf("uploads must not be larger than %d bytes", maxMediaSize), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "expected an image in the file field of a multipart form", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxMediaSize+1))
+	if err != nil {
+		http.Error(w, "failed to read upload", http.StatusBadRequest)
+		return
+	}
+	if len(data) > maxMediaSize {
+		http.Error(w, fmt.Sprintf("uploads must not be larger than %d bytes", maxMediaSize), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	processed, err := processImage(data)
+	if err != nil {
+		http.Error(w, fmt.Sprint(err), http.StatusBadRequest)
+		return
+	}
+
+	key, err := newBlobKey()
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := u.blobs.Put(key, processed.data); err != nil {
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	if err := u.blobs.Put(thumbnailKey(key), processed.thumbnail); err != nil {
+		log.Println(err)
+		u.deleteBlobs(key)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	id, err := u.store.CreateMedia(user.Username, Media{
+		ContentType: processed.contentType,
+		Width:       processed.width,
+		Height:      processed.height,
+		Size:        len(processed.data),
+		Key:         key,
+	})
+	if err != nil {
+		log.Println(err)
+		u.deleteBlobs(key)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	media, err := u.store.GetMedia(id)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", jsonContentType)
+	w.WriteHeader(http.StatusAccepted)
+
+	if err := json.NewEncoder(w).Encode(media); err != nil {
+		log.Println(err)
+	}
+}
+
+// deleteBlobs removes the image stored under key and its thumbnail after a
+// failed upload.
+func (u *UserServer) deleteBlobs(key string) {
+	for _, key := range []string{key, thumbnailKey(key)} {
+		if err := u.blobs.Delete(key); err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+// serveMedia answers with image {id}, or its thumbnail when thumbnail is set.
+func (u *UserServer) serveMedia(thumbnail bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil || id < 1 {
+			http.Error(w, "invalid media id", http.StatusBadRequest)
+			return
+		}
+
+		media, err := u.store.GetMedia(id)
+		if err != nil {
+			if errors.Is(err, ErrMediaNotFound) {
+				http.Error(w, fmt.Sprint(err), http.StatusNotFound)
+				return
+			}
+			log.Println(err)
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		viewer := userFromContext(r.Context())
+		if media.SqueakID == nil {
+			// Until it is attached, only the uploader may see it.
+			if viewer == nil || viewer.ID != media.OwnerID {
+				http.Error(w, fmt.Sprint(ErrMediaNotFound), http.StatusNotFound)
+				return
+			}
+		} else if !u.mediaVisibleTo(w, viewer, *media.SqueakID) {
+			return
+		}
+
+		key, contentType := media.Key, media.ContentType
+		if thumbnail {
+			key, contentType = thumbnailKey(key), thumbnailContentType(contentType)
+		}
+
+		data, err := u.blobs.Get(key)
+		if err != nil {
+			if errors.Is(err, ErrBlobNotFound) {
+				http.Error(w, fmt.Sprint(ErrMediaNotFound), http.StatusNotFound)
+				return
+			}
+			log.Println(err)
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		// Who may see it changes with the squeak it is attached to, so shared
+		// caches must not keep it and browsers have to check again.
+		w.Header().Set("Cache-Control", "private, no-cache")
+
+		if _, err := w.Write(data); err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+// mediaVisibleTo answers the request with 404 and returns false unless
+// viewer, nil when anonymous, may see squeak squeakID the media is attached
+// to: it must not be deleted, protected from viewer or by a user viewer
+// blocks or is blocked by.
+func (u *UserServer) mediaVisibleTo(w http.ResponseWriter, viewer *User, squeakID int) bool {
+	squeak, err := u.store.GetSqueak(squeakID)
+	if err != nil {
+		if errors.Is(err, ErrSqueakNotFound) {
+			http.Error(w, fmt.Sprint(ErrMediaNotFound), http.StatusNotFound)
+			return false
+		}
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return false
+	}
+
+	if !u.visibleTo(w, viewerName(viewer), squeak) {
+		return false
+	}
+
+	if viewer == nil {
+		return true
+	}
+
+	blocked, err := u.store.IsBlocked(viewer.Username, squeak.Author)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return false
+	}
+
+	if blocked {
+		http.Error(w, fmt.Sprint(ErrMediaNotFound), http.StatusNotFound)
+		return false
+	}
+
+	return true
+}
+
+// mediaAttachable answers the request with 400 and returns false unless ids
+// name at most maxSqueakMedia distinct uploads of user not attached to any
+// squeak yet.
+func (u *UserServer) mediaAttachable(w http.ResponseWriter, user *User, ids []int) bool {
+	if len(ids) > maxSqueakMedia {
+		http.Error(w, fmt.Sprintf("a squeak can carry at most %d media", maxSqueakMedia), http.StatusBadRequest)
+		return false
+	}
+
+	for i, id := range ids {
+		if slices.Contains(ids[:i], id) {
+			http.Error(w, fmt.Sprintf("media %d is attached twice", id), http.StatusBadRequest)
+			return false
+		}
+
+		media, err := u.store.GetMedia(id)
+		if err != nil && !errors.Is(err, ErrMediaNotFound) {
+			log.Println(err)
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return false
+		}
+
+		if media == nil || media.OwnerID != user.ID || media.SqueakID != nil {
+			http.Error(w, fmt.Sprintf("media %d cannot be attached", id), http.StatusBadRequest)
+			return false
+		}
+	}
+
+	return true
+}
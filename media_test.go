@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// testImage encodes a width by height image as PNG, or as JPEG carrying
+// an EXIF segment with a location.
+func testImage(t testing.TB, format string, width, height int) []byte {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 200, A: 255})
+		}
+	}
+
+	var buf bytes.Buffer
+	if format == "png" {
+		assertNoError(t, png.Encode(&buf, img))
+		return buf.Bytes()
+	}
+
+	assertNoError(t, jpeg.Encode(&buf, img, nil))
+	exif := append([]byte("Exif\x00\x00"), "GPS 50.08N 14.42E"...)
+	segment := append([]byte{0xFF, 0xE1, byte((len(exif) + 2) >> 8), byte(len(exif) + 2)}, exif...)
+
+	data := buf.Bytes()
+	return append(append(append([]byte{}, data[:2]...), segment...), data[2:]...)
+}
+
+// testAnimation encodes an animated GIF of frames 16 by 16 pixel frames.
+func testAnimation(t testing.TB, frames int) []byte {
+	t.Helper()
+
+	animation := &gif.GIF{}
+	for i := 0; i < frames; i++ {
+		frame := image.NewPaletted(image.Rect(0, 0, 16, 16), palette.Plan9)
+		frame.SetColorIndex(i%16, i%16, uint8(i))
+		animation.Image = append(animation.Image, frame)
+		animation.Delay = append(animation.Delay, 10)
+	}
+
+	var buf bytes.Buffer
+	assertNoError(t, gif.EncodeAll(&buf, animation))
+	return buf.Bytes()
+}
+
+func TestMedia(t *testing.T) {
+	store := NewInMemoryUserStore()
+	server := NewUserServer(store, WithBlobStore(NewMemoryBlobStore()))
+
+	store.CreateUser("Ansel", "ansel@test", "")
+	store.CreateUser("Dorothea", "dorothea@test", "")
+
+	anselToken, _ := generateJWTToken("Ansel")
+	dorotheaToken, _ := generateJWTToken("Dorothea")
+
+	upload := func(t testing.TB, data []byte, token string) Media {
+		t.Helper()
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newUploadRequest(data, token))
+		assertStatus(t, response.Code, http.StatusAccepted)
+
+		var media Media
+		assertNoError(t, json.NewDecoder(response.Body).Decode(&media))
+		return media
+	}
+
+	t.Run("it requires authentication", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newUploadRequest(testImage(t, "png", 10, 10), ""))
+		assertStatus(t, response.Code, http.StatusUnauthorized)
+	})
+	t.Run("rejects what is not an image", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newUploadRequest([]byte("<html><script>alert(1)</script></html>"), anselToken))
+		assertStatus(t, response.Code, http.StatusBadRequest)
+	})
+	t.Run("rejects uploads over the size limit", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newUploadRequest(make([]byte, maxMediaSize+1), anselToken))
+		assertStatus(t, response.Code, http.StatusRequestEntityTooLarge)
+	})
+	t.Run("keeps animations", func(t *testing.T) {
+		media := upload(t, testAnimation(t, 3), anselToken)
+		assertEqual(t, media.ContentType, "image/gif")
+
+		response := httptest.NewRecorder()
+		request := newAuthenticatedRequest(http.MethodGet, fmt.Sprintf("/media/%d", media.ID), nil, anselToken)
+		server.ServeHTTP(response, request)
+
+		animation, err := gif.DecodeAll(response.Body)
+		assertNoError(t, err)
+		assertEqual(t, len(animation.Image), 3)
+	})
+	t.Run("rejects animations over the frame limit", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newUploadRequest(testAnimation(t, maxGIFFrames+1), anselToken))
+		assertStatus(t, response.Code, http.StatusBadRequest)
+	})
+	t.Run("strips EXIF metadata", func(t *testing.T) {
+		original := testImage(t, "jpeg", 64, 48)
+		media := upload(t, original, anselToken)
+		assertEqual(t, media.ContentType, "image/jpeg")
+		assertEqual(t, media.Width, 64)
+
+		response := httptest.NewRecorder()
+		request := newAuthenticatedRequest(http.MethodGet, fmt.Sprintf("/media/%d", media.ID), nil, anselToken)
+		server.ServeHTTP(response, request)
+		assertStatus(t, response.Code, http.StatusOK)
+		assertEqual(t, response.Header().Get("Content-Type"), "image/jpeg")
+		assertEqual(t, response.Header().Get("X-Content-Type-Options"), "nosniff")
+
+		assertEqual(t, bytes.Contains(original, []byte("GPS")), true)
+		assertEqual(t, bytes.Contains(response.Body.Bytes(), []byte("GPS")), false)
+		assertEqual(t, bytes.Contains(response.Body.Bytes(), []byte("Exif")), false)
+	})
+	t.Run("generates thumbnails", func(t *testing.T) {
+		media := upload(t, testImage(t, "png", 640, 480), anselToken)
+
+		response := httptest.NewRecorder()
+		request := newAuthenticatedRequest(http.MethodGet, fmt.Sprintf("/media/%d/thumbnail", media.ID), nil, anselToken)
+		server.ServeHTTP(response, request)
+		assertStatus(t, response.Code, http.StatusOK)
+		assertEqual(t, response.Header().Get("Content-Type"), "image/png")
+
+		config, err := png.DecodeConfig(response.Body)
+		assertNoError(t, err)
+		assertEqual(t, config.Width, thumbnailSize)
+		assertEqual(t, config.Height, 240)
+	})
+	t.Run("attaches up to four uploads to a squeak", func(t *testing.T) {
+		var ids []int
+		for range maxSqueakMedia + 1 {
+			ids = append(ids, upload(t, testImage(t, "png", 8, 8), anselToken).ID)
+		}
+
+		body, _ := json.Marshal(map[string]any{"text": "Moonrise", "mediaIds": ids})
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newPostSqueakRequestWithJWT("Ansel", body, anselToken))
+		assertStatus(t, response.Code, http.StatusBadRequest)
+
+		body, _ = json.Marshal(map[string]any{"mediaIds": ids[:maxSqueakMedia]})
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, newPostSqueakRequestWithJWT("Ansel", body, anselToken))
+		assertStatus(t, response.Code, http.StatusAccepted)
+
+		var squeak SqueakPost
+		assertNoError(t, json.NewDecoder(response.Body).Decode(&squeak))
+		assertEqual(t, len(squeak.Media), maxSqueakMedia)
+		assertEqual(t, squeak.Media[0].ID, ids[0])
+		assertEqual(t, *squeak.Media[3].SqueakID, squeak.ID)
+
+		body, _ = json.Marshal(map[string]any{"text": "Again", "mediaIds": ids[:1]})
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, newPostSqueakRequestWithJWT("Ansel", body, anselToken))
+		assertStatus(t, response.Code, http.StatusBadRequest)
+	})
+	t.Run("only attaches the uploader's media", func(t *testing.T) {
+		media := upload(t, testImage(t, "png", 8, 8), anselToken)
+
+		body, _ := json.Marshal(map[string]any{"text": "Not mine", "mediaIds": []int{media.ID}})
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newPostSqueakRequestWithJWT("Dorothea", body, dorotheaToken))
+		assertStatus(t, response.Code, http.StatusBadRequest)
+	})
+	t.Run("only serves unattached uploads to their owner", func(t *testing.T) {
+		media := upload(t, testImage(t, "png", 8, 8), anselToken)
+
+		for _, token := range []string{"", dorotheaToken} {
+			response := httptest.NewRecorder()
+			server.ServeHTTP(response, newAuthenticatedRequest(http.MethodGet, fmt.Sprintf("/media/%d", media.ID), nil, token))
+			assertStatus(t, response.Code, http.StatusNotFound)
+		}
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newAuthenticatedRequest(http.MethodGet, fmt.Sprintf("/media/%d", media.ID), nil, anselToken))
+		assertStatus(t, response.Code, http.StatusOK)
+		assertEqual(t, response.Header().Get("Cache-Control"), "private, no-cache")
+	})
+	t.Run("only serves media of squeaks the viewer may see", func(t *testing.T) {
+		media := upload(t, testImage(t, "png", 8, 8), anselToken)
+		id, _ := store.CreateSqueak("Ansel", SqueakPost{Text: "Moonrise", MediaIDs: []int{media.ID}})
+
+		status := func(t testing.TB, token string) int {
+			t.Helper()
+
+			request := newAuthenticatedRequest(http.MethodGet, fmt.Sprintf("/media/%d", media.ID), nil, token)
+			response := httptest.NewRecorder()
+			server.ServeHTTP(response, request)
+			return response.Code
+		}
+
+		assertStatus(t, status(t, dorotheaToken), http.StatusOK)
+
+		store.UpdateProfile("Ansel", User{Protected: true})
+		assertStatus(t, status(t, ""), http.StatusNotFound)
+		assertStatus(t, status(t, dorotheaToken), http.StatusNotFound)
+		assertStatus(t, status(t, anselToken), http.StatusOK)
+		store.UpdateProfile("Ansel", User{})
+
+		store.BlockUser("Ansel", "Dorothea")
+		assertStatus(t, status(t, dorotheaToken), http.StatusNotFound)
+		assertStatus(t, status(t, ""), http.StatusOK)
+		store.UnblockUser("Ansel", "Dorothea")
+
+		store.DeleteSqueak(id)
+		assertStatus(t, status(t, ""), http.StatusNotFound)
+	})
+	t.Run("returns 404 for unknown media", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		request, _ := http.NewRequest(http.MethodGet, "/media/99", nil)
+		server.ServeHTTP(response, request)
+		assertStatus(t, response.Code, http.StatusNotFound)
+	})
+}
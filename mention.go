@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// Mention links an @username in a squeak's text to the user's ID, so it
+// keeps pointing at the same account when the user is renamed. Start and End
+// are offsets in Unicode code points into the text, End exclusive, covering
+// the @ and the username.
+type Mention struct {
+	UserID   int    `json:"userId"`
+	Username string `json:"username"`
+	Start    int    `json:"start"`
+	End      int    `json:"end"`
+}
+
+// resolveMentions finds the @usernames in text and keeps the ones lookup
+// resolves to a user. An @ following a username character does not start a
+// mention, so email addresses are left alone.
+func resolveMentions(text string, lookup func(username string) (*User, error)) []Mention {
+	var mentions []Mention
+
+	runes := []rune(text)
+	for i := 0; i < len(runes); i++ {
+		if runes[i] != '@' || (i > 0 && isTagRune(runes[i-1])) {
+			continue
+		}
+
+		end := i + 1
+		for end < len(runes) && isTagRune(runes[end]) {
+			end++
+		}
+
+		if end > i+1 {
+			if user, err := lookup(string(runes[i+1 : end])); err == nil {
+				mentions = append(mentions, Mention{UserID: user.ID, Username: user.Username, Start: i, End: end})
+			}
+		}
+		i = end - 1
+	}
+
+	return mentions
+}
+
+func (u *UserServer) showMentions(w http.ResponseWriter, r *http.Request) {
+	user := userFromContext(r.Context())
+
+	cursor, limit, err := parsePagination(r)
+	if err != nil {
+		http.Error(w, fmt.Sprint(err), http.StatusBadRequest)
+		return
+	}
+
+	squeaks, err := u.store.GetMentioningSqueaks(user.Username, cursor, limit+1)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	page := newSqueakPage(squeaks, limit)
+	page.Squeaks, err = u.prepareSqueaks(user, page.Squeaks)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", jsonContentType)
+
+	if err := json.NewEncoder(w).Encode(page); err != nil {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+}
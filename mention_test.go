@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestResolveMentions(t *testing.T) {
+	users := map[string]int{"Mark": 1, "Carrie": 2}
+	lookup := func(username string) (*User, error) {
+		id, ok := users[username]
+		if !ok {
+			return nil, errors.New("user not found")
+		}
+		return &User{ID: id, Username: username}, nil
+	}
+
+	cases := []struct {
+		text string
+		want []Mention
+	}{
+		{"no mentions here", nil},
+		{"@Mark hi", []Mention{{1, "Mark", 0, 5}}},
+		{"hi @Carrie and @Mark!", []Mention{{2, "Carrie", 3, 10}, {1, "Mark", 15, 20}}},
+		{"@Nobody and @", nil},
+		{"mark@Mark.com", nil},
+		{"Čau @Mark", []Mention{{1, "Mark", 4, 9}}},
+		{"@Markus", nil},
+	}
+
+	for _, c := range cases {
+		t.Run(c.text, func(t *testing.T) {
+			got := resolveMentions(c.text, lookup)
+
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("got %v want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestMentions(t *testing.T) {
+	store := NewInMemoryUserStore()
+	server := NewUserServer(store)
+
+	store.CreateUser("Mark", "mark@test", "")
+	store.CreateUser("Carrie", "carrie@test", "")
+	store.PostSqueak("Carrie", "@Mark where is the Falcon?")
+	store.PostSqueak("Carrie", "Nobody mentioned here")
+	store.PostSqueak("Carrie", "Hey @Mark, @Carrie here")
+	id, _ := store.PostSqueak("Carrie", "@Mark again")
+
+	token, _ := generateJWTToken("Mark")
+
+	t.Run("it requires authentication", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newMentionsRequest("", ""))
+
+		assertStatus(t, response.Code, http.StatusUnauthorized)
+	})
+	t.Run("lists squeaks mentioning the user with entities", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newMentionsRequest("", token))
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertContentType(t, response, jsonContentType)
+
+		page := getSqueakPageFromResponse(t, response.Body)
+		assertSqueaks(t, page.Squeaks, []SqueakPost{{Text: "@Mark again"}, {Text: "Hey @Mark, @Carrie here"}})
+
+		want := []Mention{{1, "Mark", 4, 9}, {2, "Carrie", 11, 18}}
+		if !reflect.DeepEqual(page.Squeaks[1].Mentions, want) {
+			t.Errorf("got mentions %v want %v", page.Squeaks[1].Mentions, want)
+		}
+
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, newMentionsRequest(page.NextCursor, token))
+
+		page = getSqueakPageFromResponse(t, response.Body)
+		assertSqueaks(t, page.Squeaks, []SqueakPost{{Text: "@Mark where is the Falcon?"}})
+	})
+	t.Run("re-resolves mentions on edit", func(t *testing.T) {
+		assertNoError(t, store.EditSqueak(id, textEdit("@Carrie again")))
+
+		got, err := store.GetMentioningSqueaks("Mark", 0, 10)
+		assertNoError(t, err)
+		assertEqual(t, len(got), 2)
+
+		got, err = store.GetMentioningSqueaks("Carrie", 0, 10)
+		assertNoError(t, err)
+		assertSqueaks(t, got, []SqueakPost{{Text: "@Carrie again"}, {Text: "Hey @Mark, @Carrie here"}})
+	})
+}
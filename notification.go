@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	NotificationFollow  = "follow"
+	NotificationLike    = "like"
+	NotificationReply   = "reply"
+	NotificationMention = "mention"
+
+	NotificationFollowRequest = "follow_request"
+	NotificationFollowAccept  = "follow_accept"
+)
+
+// maxNotificationActors caps how many of a notification's actors are listed,
+// the rest are only counted.
+const maxNotificationActors = 3
+
+// Notification tells a user that others acted on them or their squeak.
+// Unread events of the same kind about the same squeak are grouped into one
+// notification, Actors holds the most recent of them, newest first, and
+// ActorCount all of them. SqueakID is the squeak that was liked or replied
+// to, or the squeak with the mention, and is absent for follows.
+type Notification struct {
+	ID         int          `json:"id"`
+	Kind       string       `json:"kind"`
+	SqueakID   *int         `json:"squeakId,omitempty"`
+	Actors     []PublicUser `json:"actors"`
+	ActorCount int          `json:"actorCount"`
+	Summary    string       `json:"summary"`
+	Read       bool         `json:"read"`
+	UpdatedAt  time.Time    `json:"updatedAt"`
+}
+
+// NotificationPage is one page of notifications, newest first, paginated
+// like SqueakPage.
+type NotificationPage struct {
+	Notifications []Notification `json:"notifications"`
+	NextCursor    string         `json:"nextCursor,omitempty"`
+}
+
+func newNotificationPage(notifications []Notification, limit int) NotificationPage {
+	page := NotificationPage{Notifications: notifications}
+	if page.Notifications == nil {
+		page.Notifications = []Notification{}
+	}
+
+	if len(notifications) > limit {
+		page.Notifications = notifications[:limit]
+		page.NextCursor = strconv.Itoa(notifications[limit-1].ID)
+	}
+
+	return page
+}
+
+// summarise describes a notification the way it is shown to the user, such
+// as "Alice and 3 others liked your squeak".
+func summarise(notification Notification) string {
+	var action string
+	switch notification.Kind {
+	case NotificationFollow:
+		action = "followed you"
+	case NotificationLike:
+		action = "liked your squeak"
+	case NotificationReply:
+		action = "replied to your squeak"
+	case NotificationMention:
+		action = "mentioned you"
+	case NotificationFollowRequest:
+		action = "asked to follow you"
+	case NotificationFollowAccept:
+		action = "accepted your follow request"
+	}
+
+	if len(notification.Actors) == 0 {
+		return fmt.Sprintf("%d people %s", notification.ActorCount, action)
+	}
+
+	first := notification.Actors[0].Username
+	switch others := notification.ActorCount - 1; {
+	case others == 0:
+		return fmt.Sprintf("%s %s", first, action)
+	case others == 1 && len(notification.Actors) > 1:
+		return fmt.Sprintf("%s and %s %s", first, notification.Actors[1].Username, action)
+	case others == 1:
+		return fmt.Sprintf("%s and 1 other %s", first, action)
+	default:
+		return fmt.Sprintf("%s and %d others %s", first, others, action)
+	}
+}
+
+// notify records that actor did something of kind to recipient, unless
+// actor is hidden from recipient by a block or mute. The action itself has
+// already succeeded, so a failure is only logged.
+func (u *UserServer) notify(recipient, actor, kind string, squeakID *int) {
+	if recipient == actor {
+		return
+	}
+
+	from, err := u.store.GetUserByUsername(actor)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	hidden, err := u.store.GetHiddenUsers(recipient)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	if hidden[from.ID] {
+		return
+	}
+
+	if err := u.store.AddNotification(recipient, actor, kind, squeakID); err != nil {
+		log.Println(err)
+	}
+}
+
+func (u *UserServer) showNotifications(w http.ResponseWriter, r *http.Request) {
+	user := userFromContext(r.Context())
+
+	cursor, limit, err := parsePagination(r)
+	if err != nil {
+		http.Error(w, fmt.Sprint(err), http.StatusBadRequest)
+		return
+	}
+
+	unread := false
+	if value := r.URL.Query().Get("unread"); value != "" {
+		unread, err = strconv.ParseBool(value)
+		if err != nil {
+			http.Error(w, "unread must be true or false", http.StatusBadRequest)
+			return
+		}
+	}
+
+	notifications, err := u.store.GetNotifications(user.Username, unread, cursor, limit+1)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	for i := range notifications {
+		notifications[i].Summary = summarise(notifications[i])
+	}
+
+	w.Header().Set("Content-Type", jsonContentType)
+
+	if err := json.NewEncoder(w).Encode(newNotificationPage(notifications, limit)); err != nil {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// markNotificationsRead marks the notifications listed in the ids field of
+// the request body as read, or all of them when the list is empty.
+func (u *UserServer) markNotificationsRead(w http.ResponseWriter, r *http.Request) {
+	user := userFromContext(r.Context())
+
+	var body struct {
+		IDs []int `json:"ids"`
+	}
+
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, "failed to decode JSON payload", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := u.store.MarkNotificationsRead(user.Username, body.IDs); err != nil {
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
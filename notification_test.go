@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSummarise(t *testing.T) {
+	alice, bob := PublicUser{Username: "Alice"}, PublicUser{Username: "Bob"}
+
+	cases := []struct {
+		notification Notification
+		want         string
+	}{
+		{Notification{Kind: NotificationFollow, Actors: []PublicUser{alice}, ActorCount: 1}, "Alice followed you"},
+		{Notification{Kind: NotificationLike, Actors: []PublicUser{alice, bob}, ActorCount: 2}, "Alice and Bob liked your squeak"},
+		{Notification{Kind: NotificationReply, Actors: []PublicUser{alice, bob}, ActorCount: 4}, "Alice and 3 others replied to your squeak"},
+		{Notification{Kind: NotificationMention, Actors: []PublicUser{alice}, ActorCount: 2}, "Alice and 1 other mentioned you"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.want, func(t *testing.T) {
+			assertEqual(t, summarise(c.notification), c.want)
+		})
+	}
+}
+
+func TestNotifications(t *testing.T) {
+	store := NewInMemoryUserStore()
+	server := NewUserServer(store)
+
+	store.CreateUser("Mark", "mark@test", "")
+	for _, name := range []string{"Alice", "Bob", "Carol", "Dave"} {
+		store.CreateUser(name, name+"@test", "")
+	}
+	id, _ := store.PostSqueak("Mark", "I have a bad feeling about this.")
+
+	markToken, _ := generateJWTToken("Mark")
+
+	for _, name := range []string{"Alice", "Bob", "Carol", "Dave"} {
+		token, _ := generateJWTToken(name)
+		server.ServeHTTP(httptest.NewRecorder(), newLikeRequest(http.MethodPut, id, token))
+	}
+	aliceToken, _ := generateJWTToken("Alice")
+	server.ServeHTTP(httptest.NewRecorder(), newFollowRequest(http.MethodPost, "Mark", aliceToken))
+	server.ServeHTTP(httptest.NewRecorder(), newReplyRequest(id, []byte(`{"text": "@Mark it's a trap"}`), aliceToken))
+
+	t.Run("it requires authentication", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newNotificationsRequest("", ""))
+
+		assertStatus(t, response.Code, http.StatusUnauthorized)
+	})
+	t.Run("groups similar events newest first", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newNotificationsRequest("", markToken))
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertContentType(t, response, jsonContentType)
+
+		page := getNotificationPageFromResponse(t, response.Body)
+		var got []string
+		for _, notification := range page.Notifications {
+			got = append(got, notification.Summary)
+		}
+		assertEqual(t, fmt.Sprint(got), fmt.Sprint([]string{
+			"Alice mentioned you",
+			"Alice replied to your squeak",
+			"Alice followed you",
+			"Dave and 3 others liked your squeak",
+		}))
+		assertEqual(t, len(page.Notifications[3].Actors), maxNotificationActors)
+		assertEqual(t, *page.Notifications[3].SqueakID, id)
+	})
+	t.Run("marks notifications read", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newNotificationsRequest("unread=true&limit=1", markToken))
+
+		page := getNotificationPageFromResponse(t, response.Body)
+		assertEqual(t, len(page.Notifications), 1)
+
+		body := []byte(fmt.Sprintf(`{"ids": [%d]}`, page.Notifications[0].ID))
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, newMarkReadRequest(body, markToken))
+
+		assertStatus(t, response.Code, http.StatusAccepted)
+
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, newNotificationsRequest("unread=true", markToken))
+		assertEqual(t, len(getNotificationPageFromResponse(t, response.Body).Notifications), 3)
+
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, newMarkReadRequest(nil, markToken))
+
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, newNotificationsRequest("unread=true", markToken))
+		assertEqual(t, len(getNotificationPageFromResponse(t, response.Body).Notifications), 0)
+	})
+	t.Run("starts a new group once the old one is read", func(t *testing.T) {
+		bobToken, _ := generateJWTToken("Bob")
+		server.ServeHTTP(httptest.NewRecorder(), newFollowRequest(http.MethodPost, "Mark", bobToken))
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newNotificationsRequest("unread=true", markToken))
+
+		page := getNotificationPageFromResponse(t, response.Body)
+		assertEqual(t, len(page.Notifications), 1)
+		assertEqual(t, page.Notifications[0].Summary, "Bob followed you")
+	})
+	t.Run("rejects an invalid unread filter", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newNotificationsRequest("unread=maybe", markToken))
+
+		assertStatus(t, response.Code, http.StatusBadRequest)
+	})
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// pinSqueak pins a squeak to the top of its author's squeaks, replacing the
+// one pinned before. Only the author may pin it, which requiresSqueakAuthor
+// checks.
+func (u *UserServer) pinSqueak(w http.ResponseWriter, r *http.Request) {
+	user := userFromContext(r.Context())
+	id, _ := squeakIDFromPath(r)
+
+	if err := u.store.PinSqueak(user.Username, id); err != nil {
+		if errors.Is(err, ErrSqueakNotFound) {
+			http.Error(w, fmt.Sprint(err), http.StatusNotFound)
+			return
+		}
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// unpinSqueak clears the pin if it is on squeak id and does nothing
+// otherwise.
+func (u *UserServer) unpinSqueak(w http.ResponseWriter, r *http.Request) {
+	user := userFromContext(r.Context())
+
+	id, err := squeakIDFromPath(r)
+	if err != nil {
+		http.Error(w, fmt.Sprint(err), http.StatusBadRequest)
+		return
+	}
+
+	if err := u.store.UnpinSqueak(user.Username, id); err != nil {
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// pinFirst moves the squeak pinned, if it is among squeaks, to the front and
+// marks it as pinned. The others keep their order.
+func pinFirst(squeaks []SqueakPost, pinned *int) []SqueakPost {
+	if pinned == nil {
+		return squeaks
+	}
+
+	for i, squeak := range squeaks {
+		if squeak.ID == *pinned {
+			squeak.Pinned = true
+			ordered := append([]SqueakPost{squeak}, squeaks[:i]...)
+			return append(ordered, squeaks[i+1:]...)
+		}
+	}
+
+	return squeaks
+}
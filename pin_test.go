@@ -0,0 +1,112 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPinnedSqueaks(t *testing.T) {
+	store := NewInMemoryUserStore()
+	server := NewUserServer(store)
+
+	store.CreateUser("Ellen", "ellen@test", "")
+	store.CreateUser("Dallas", "dallas@test", "")
+
+	ellenToken, _ := generateJWTToken("Ellen")
+	dallasToken, _ := generateJWTToken("Dallas")
+
+	first, _ := store.PostSqueak("Ellen", "Final report of the commercial starship Nostromo")
+	second, _ := store.PostSqueak("Ellen", "Third officer reporting")
+	third, _ := store.PostSqueak("Ellen", "Signing off")
+	dallas, _ := store.PostSqueak("Dallas", "Ash, what's the story?")
+
+	showSqueaks := func(t testing.TB) []SqueakPost {
+		t.Helper()
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newGetSqueakRequest("Ellen"))
+		assertStatus(t, response.Code, http.StatusOK)
+
+		return getUserSqueaksFromResponse(t, response.Body)
+	}
+
+	assertOrder := func(t testing.TB, squeaks []SqueakPost, want ...int) {
+		t.Helper()
+
+		if len(squeaks) != len(want) {
+			t.Fatalf("got %d squeaks, want %d", len(squeaks), len(want))
+		}
+		for i, id := range want {
+			assertEqual(t, squeaks[i].ID, id)
+		}
+	}
+
+	t.Run("requires authentication", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newPinRequest(http.MethodPut, second, ""))
+		assertStatus(t, response.Code, http.StatusUnauthorized)
+	})
+	t.Run("rejects pinning another user's squeak", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newPinRequest(http.MethodPut, dallas, ellenToken))
+		assertStatus(t, response.Code, http.StatusForbidden)
+
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, newPinRequest(http.MethodPut, 42, ellenToken))
+		assertStatus(t, response.Code, http.StatusNotFound)
+	})
+	t.Run("shows the pinned squeak first", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newPinRequest(http.MethodPut, second, ellenToken))
+		assertStatus(t, response.Code, http.StatusAccepted)
+
+		squeaks := showSqueaks(t)
+		assertOrder(t, squeaks, second, first, third)
+		assertEqual(t, squeaks[0].Pinned, true)
+		assertEqual(t, squeaks[1].Pinned, false)
+
+		profile, _ := store.GetProfile("Ellen")
+		assertEqual(t, *profile.PinnedSqueakID, second)
+	})
+	t.Run("replaces the previous pin", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newPinRequest(http.MethodPut, third, ellenToken))
+		assertStatus(t, response.Code, http.StatusAccepted)
+
+		assertOrder(t, showSqueaks(t), third, first, second)
+	})
+	t.Run("unpins only the pinned squeak", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newPinRequest(http.MethodDelete, first, ellenToken))
+		assertStatus(t, response.Code, http.StatusAccepted)
+		assertOrder(t, showSqueaks(t), third, first, second)
+
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, newPinRequest(http.MethodDelete, dallas, dallasToken))
+		assertStatus(t, response.Code, http.StatusAccepted)
+		assertOrder(t, showSqueaks(t), third, first, second)
+
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, newPinRequest(http.MethodDelete, third, ellenToken))
+		assertStatus(t, response.Code, http.StatusAccepted)
+		assertOrder(t, showSqueaks(t), first, second, third)
+	})
+	t.Run("clears the pin when the squeak is deleted", func(t *testing.T) {
+		assertNoError(t, store.PinSqueak("Ellen", second))
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newEditSqueakRequest(http.MethodDelete, second, nil, ellenToken))
+		assertStatus(t, response.Code, http.StatusAccepted)
+
+		profile, _ := store.GetProfile("Ellen")
+		if profile.PinnedSqueakID != nil {
+			t.Errorf("got pinned squeak %d, want none", *profile.PinnedSqueakID)
+		}
+		assertOrder(t, showSqueaks(t), first, third)
+
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, newPinRequest(http.MethodPut, second, ellenToken))
+		assertStatus(t, response.Code, http.StatusNotFound)
+	})
+}
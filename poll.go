@@ -0,0 +1,230 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	minPollOptions      = 2
+	maxPollOptions      = 4
+	maxPollOptionLength = 25
+	minPollDuration     = 5 * time.Minute
+	maxPollDuration     = 7 * 24 * time.Hour
+)
+
+var ErrAlreadyVoted = errors.New("you have already voted in this poll")
+
+// Poll is a question attached to a squeak. Everyone gets one vote, and the
+// vote counts stay nil until the viewer has voted or the poll has closed.
+// Who voted for what is never shown.
+type Poll struct {
+	Options   []PollOption `json:"options"`
+	ClosesAt  time.Time    `json:"closesAt"`
+	Closed    bool         `json:"closed"`
+	VoteCount *int         `json:"voteCount,omitempty"`
+	// VotedFor is the index of the option the viewer voted for.
+	VotedFor *int `json:"votedFor,omitempty"`
+}
+
+type PollOption struct {
+	Text  string `json:"text"`
+	Votes *int   `json:"votes,omitempty"`
+}
+
+// newPoll builds a poll with every count at zero, as stores return it
+// before anyone has voted.
+func newPoll(options []string, closesAt time.Time) *Poll {
+	poll := &Poll{ClosesAt: closesAt, VoteCount: new(int)}
+	for _, text := range options {
+		poll.Options = append(poll.Options, PollOption{Text: text, Votes: new(int)})
+	}
+	return poll
+}
+
+// withVote returns a copy of the poll with one more vote for option,
+// leaving the poll itself untouched for whoever else holds it.
+func (p *Poll) withVote(option int) *Poll {
+	poll := *p
+	poll.Options = append([]PollOption(nil), p.Options...)
+
+	votes := *poll.Options[option].Votes + 1
+	poll.Options[option].Votes = &votes
+	count := *poll.VoteCount + 1
+	poll.VoteCount = &count
+
+	return &poll
+}
+
+// optionTexts lists the text of every option of the poll.
+func (p *Poll) optionTexts() []string {
+	texts := make([]string, len(p.Options))
+	for i, option := range p.Options {
+		texts[i] = option.Text
+	}
+	return texts
+}
+
+// validatePoll checks the poll of a new squeak posted at now.
+func validatePoll(poll *Poll, now time.Time) error {
+	if len(poll.Options) < minPollOptions || len(poll.Options) > maxPollOptions {
+		return fmt.Errorf("a poll needs between %d and %d options", minPollOptions, maxPollOptions)
+	}
+	for _, option := range poll.Options {
+		if strings.TrimSpace(option.Text) == "" {
+			return errors.New("poll options must not be empty")
+		}
+		if utf8.RuneCountInString(option.Text) > maxPollOptionLength {
+			return fmt.Errorf("poll options must not be longer than %d characters", maxPollOptionLength)
+		}
+	}
+	if duration := poll.ClosesAt.Sub(now); duration < minPollDuration || duration > maxPollDuration {
+		return fmt.Errorf("a poll must close between %s and %s from now", minPollDuration, maxPollDuration)
+	}
+	return nil
+}
+
+// preparePolls fills in what the polls of squeaks and their originals look
+// like to viewer, who is nil for anonymous requests. The counts of open
+// polls the viewer has not voted in are hidden.
+func (u *UserServer) preparePolls(viewer *User, squeaks []SqueakPost) error {
+	var polled []*SqueakPost
+	for i := range squeaks {
+		if squeaks[i].Poll != nil {
+			polled = append(polled, &squeaks[i])
+		}
+		if original := squeaks[i].Original; original != nil && original.Poll != nil {
+			copied := *original
+			squeaks[i].Original = &copied
+			polled = append(polled, squeaks[i].Original)
+		}
+	}
+
+	if len(polled) == 0 {
+		return nil
+	}
+
+	votes := map[int]int{}
+	if viewer != nil {
+		ids := make([]int, len(polled))
+		for i, squeak := range polled {
+			ids[i] = squeak.ID
+		}
+
+		var err error
+		if votes, err = u.store.GetPollVotes(viewer.Username, ids); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	for _, squeak := range polled {
+		poll := *squeak.Poll
+		poll.Options = append([]PollOption(nil), poll.Options...)
+		poll.Closed = !now.Before(poll.ClosesAt)
+		poll.VotedFor = nil
+
+		if option, ok := votes[squeak.ID]; ok {
+			poll.VotedFor = &option
+		}
+
+		if !poll.Closed && poll.VotedFor == nil {
+			poll.VoteCount = nil
+			for i := range poll.Options {
+				poll.Options[i].Votes = nil
+			}
+		}
+
+		squeak.Poll = &poll
+	}
+
+	return nil
+}
+
+// voteInPoll records the acting user's vote for the option given in the
+// request body and answers with the squeak, now showing the results.
+func (u *UserServer) voteInPoll(w http.ResponseWriter, r *http.Request) {
+	user := userFromContext(r.Context())
+
+	id, err := squeakIDFromPath(r)
+	if err != nil {
+		http.Error(w, fmt.Sprint(err), http.StatusBadRequest)
+		return
+	}
+
+	squeak, err := u.store.GetSqueak(id)
+	if err != nil {
+		if errors.Is(err, ErrSqueakNotFound) {
+			http.Error(w, fmt.Sprint(err), http.StatusNotFound)
+			return
+		}
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if squeak.Poll == nil {
+		http.Error(w, "squeak has no poll", http.StatusNotFound)
+		return
+	}
+
+	if !u.visibleTo(w, user.Username, squeak) || !u.allowedToInteract(w, user.Username, squeak.Author) {
+		return
+	}
+
+	var body struct {
+		Option *int `json:"option"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "failed to decode JSON payload", http.StatusBadRequest)
+		return
+	}
+
+	if body.Option == nil || *body.Option < 0 || *body.Option >= len(squeak.Poll.Options) {
+		http.Error(w, "option must be the index of one of the poll's options", http.StatusBadRequest)
+		return
+	}
+
+	if !time.Now().Before(squeak.Poll.ClosesAt) {
+		http.Error(w, "poll is closed", http.StatusConflict)
+		return
+	}
+
+	if err := u.store.VoteInPoll(user.Username, id, *body.Option); err != nil {
+		if errors.Is(err, ErrAlreadyVoted) {
+			http.Error(w, fmt.Sprint(err), http.StatusConflict)
+			return
+		}
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	voted, err := u.store.GetSqueak(id)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	squeaks, err := u.prepareSqueaks(user, []SqueakPost{*voted})
+	if err != nil || len(squeaks) == 0 {
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", jsonContentType)
+	w.WriteHeader(http.StatusAccepted)
+
+	if err := json.NewEncoder(w).Encode(squeaks[0]); err != nil {
+		log.Println(err)
+	}
+}
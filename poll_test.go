@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPolls(t *testing.T) {
+	store := NewInMemoryUserStore()
+	server := NewUserServer(store)
+
+	store.CreateUser("Anakin", "anakin@test", "")
+	store.CreateUser("Obi-Wan", "obiwan@test", "")
+	store.CreateUser("Padme", "padme@test", "")
+	plainID, _ := store.PostSqueak("Anakin", "I hate sand")
+	closedID, _ := store.CreateSqueak("Obi-Wan", SqueakPost{
+		Text: "Who has the high ground?",
+		Poll: newPoll([]string{"Me", "Anakin"}, time.Now().Add(-time.Minute)),
+	})
+
+	anakinToken, _ := generateJWTToken("Anakin")
+	obiWanToken, _ := generateJWTToken("Obi-Wan")
+	padmeToken, _ := generateJWTToken("Padme")
+
+	store.VoteInPoll("Obi-Wan", closedID, 0)
+	store.VoteInPoll("Padme", closedID, 0)
+
+	showSqueak := func(t testing.TB, name string, id int, token string) SqueakPost {
+		t.Helper()
+
+		request := newGetSqueakRequest(name)
+		if token != "" {
+			request.Header.Set("Cookie", "Authorization="+token)
+		}
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+
+		for _, squeak := range getUserSqueaksFromResponse(t, response.Body) {
+			if squeak.ID == id {
+				return squeak
+			}
+		}
+		t.Fatalf("squeak %d not shown", id)
+		return SqueakPost{}
+	}
+
+	closesAt := time.Now().Add(time.Hour).Format(time.RFC3339)
+	poll := func(options string, closesAt string) []byte {
+		return []byte(fmt.Sprintf(`{"text": "Sand or water?", "poll": {"options": [%s], "closesAt": %q}}`, options, closesAt))
+	}
+
+	t.Run("rejects invalid polls", func(t *testing.T) {
+		for _, body := range [][]byte{
+			poll(`{"text": "Sand"}`, closesAt),
+			poll(`{"text": "a"}, {"text": "b"}, {"text": "c"}, {"text": "d"}, {"text": "e"}`, closesAt),
+			poll(`{"text": "Sand"}, {"text": ""}`, closesAt),
+			poll(`{"text": "Sand"}, {"text": "Water"}`, time.Now().Add(time.Minute).Format(time.RFC3339)),
+			poll(`{"text": "Sand"}, {"text": "Water"}`, time.Now().Add(8*24*time.Hour).Format(time.RFC3339)),
+		} {
+			response := httptest.NewRecorder()
+			server.ServeHTTP(response, newPostSqueakRequestWithJWT("Anakin", body, anakinToken))
+			assertStatus(t, response.Code, http.StatusBadRequest)
+		}
+	})
+
+	var pollID int
+
+	t.Run("posts a poll without revealing results", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newPostSqueakRequestWithJWT("Anakin", poll(`{"text": "Sand"}, {"text": "Water"}`, closesAt), anakinToken))
+		assertStatus(t, response.Code, http.StatusAccepted)
+
+		var squeak SqueakPost
+		assertNoError(t, json.NewDecoder(response.Body).Decode(&squeak))
+		pollID = squeak.ID
+
+		assertEqual(t, len(squeak.Poll.Options), 2)
+		assertEqual(t, squeak.Poll.Options[1].Text, "Water")
+		assertEqual(t, squeak.Poll.Options[1].Votes == nil, true)
+		assertEqual(t, squeak.Poll.Closed, false)
+	})
+	t.Run("voting reveals the results to the voter", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newVoteRequest(pollID, []byte(`{"option": 1}`), padmeToken))
+		assertStatus(t, response.Code, http.StatusAccepted)
+
+		var squeak SqueakPost
+		assertNoError(t, json.NewDecoder(response.Body).Decode(&squeak))
+		assertEqual(t, *squeak.Poll.VotedFor, 1)
+		assertEqual(t, *squeak.Poll.Options[0].Votes, 0)
+		assertEqual(t, *squeak.Poll.Options[1].Votes, 1)
+		assertEqual(t, *squeak.Poll.VoteCount, 1)
+
+		shown := showSqueak(t, "Anakin", pollID, padmeToken)
+		assertEqual(t, *shown.Poll.Options[1].Votes, 1)
+	})
+	t.Run("results stay hidden from those who have not voted", func(t *testing.T) {
+		for _, token := range []string{obiWanToken, ""} {
+			shown := showSqueak(t, "Anakin", pollID, token)
+			assertEqual(t, shown.Poll.Options[1].Votes == nil, true)
+			assertEqual(t, shown.Poll.VoteCount == nil, true)
+			assertEqual(t, shown.Poll.VotedFor == nil, true)
+		}
+	})
+	t.Run("everyone votes once", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newVoteRequest(pollID, []byte(`{"option": 0}`), padmeToken))
+		assertStatus(t, response.Code, http.StatusConflict)
+	})
+	t.Run("rejects votes for unknown options and squeaks without polls", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newVoteRequest(pollID, []byte(`{"option": 2}`), obiWanToken))
+		assertStatus(t, response.Code, http.StatusBadRequest)
+
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, newVoteRequest(plainID, []byte(`{"option": 0}`), obiWanToken))
+		assertStatus(t, response.Code, http.StatusNotFound)
+
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, newVoteRequest(pollID, []byte(`{"option": 0}`), ""))
+		assertStatus(t, response.Code, http.StatusUnauthorized)
+	})
+	t.Run("closed polls show final results to everyone", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newVoteRequest(closedID, []byte(`{"option": 1}`), anakinToken))
+		assertStatus(t, response.Code, http.StatusConflict)
+
+		shown := showSqueak(t, "Obi-Wan", closedID, "")
+		assertEqual(t, shown.Poll.Closed, true)
+		assertEqual(t, *shown.Poll.Options[0].Votes, 2)
+		assertEqual(t, *shown.Poll.Options[1].Votes, 0)
+		assertEqual(t, *shown.Poll.VoteCount, 2)
+	})
+}
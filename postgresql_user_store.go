@@ -5,48 +5,342 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"strings"
 	"time"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
-func initializeDatabase(db *sql.DB) { 
-	query := `CREATE TABLE IF NOT EXISTS "user" (
+func initializeDatabase(db *sql.DB) {
+	// Databases created before users had cached counts get them added
+	// below, and need them computed once from what is stored already.
+	var hasCounts bool
+	query := `SELECT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'user' AND column_name = 'follower_count')`
+	if err := db.QueryRow(query).Scan(&hasCounts); err != nil {
+		log.Fatalf("error initializing database: %v", err)
+	}
+
+	query = `CREATE TABLE IF NOT EXISTS "user" (
 		id SERIAL PRIMARY KEY,
 		username VARCHAR(100) UNIQUE NOT NULL,
 		email VARCHAR(100) UNIQUE NOT NULL,
 		password VARCHAR(60) NOT NULL,
-		createdAt TIMESTAMP
+		createdAt TIMESTAMP,
+		display_name VARCHAR(50) NOT NULL DEFAULT '',
+		bio VARCHAR(160) NOT NULL DEFAULT '',
+		location VARCHAR(30) NOT NULL DEFAULT '',
+		website VARCHAR(100) NOT NULL DEFAULT '',
+		avatar_id INT,
+		header_id INT,
+		follower_count INT NOT NULL DEFAULT 0,
+		following_count INT NOT NULL DEFAULT 0,
+		squeak_count INT NOT NULL DEFAULT 0,
+		pinned_squeak_id INT,
+		protected BOOLEAN NOT NULL DEFAULT FALSE
 	);
+	ALTER TABLE "user"
+		ADD COLUMN IF NOT EXISTS display_name VARCHAR(50) NOT NULL DEFAULT '',
+		ADD COLUMN IF NOT EXISTS bio VARCHAR(160) NOT NULL DEFAULT '',
+		ADD COLUMN IF NOT EXISTS location VARCHAR(30) NOT NULL DEFAULT '',
+		ADD COLUMN IF NOT EXISTS website VARCHAR(100) NOT NULL DEFAULT '',
+		ADD COLUMN IF NOT EXISTS avatar_id INT,
+		ADD COLUMN IF NOT EXISTS header_id INT,
+		ADD COLUMN IF NOT EXISTS follower_count INT NOT NULL DEFAULT 0,
+		ADD COLUMN IF NOT EXISTS following_count INT NOT NULL DEFAULT 0,
+		ADD COLUMN IF NOT EXISTS squeak_count INT NOT NULL DEFAULT 0,
+		ADD COLUMN IF NOT EXISTS pinned_squeak_id INT,
+		ADD COLUMN IF NOT EXISTS protected BOOLEAN NOT NULL DEFAULT FALSE;
+	CREATE INDEX IF NOT EXISTS user_protected_idx ON "user" (id) WHERE protected;
 	CREATE TABLE IF NOT EXISTS "squeak" (
 		id SERIAL PRIMARY KEY,
 		user_id INT,
 		text VARCHAR(255),
 		createdAt TIMESTAMP,
+		parent_id INT REFERENCES squeak(id),
+		root_id INT REFERENCES squeak(id),
+		like_count INT NOT NULL DEFAULT 0,
+		kind VARCHAR(10) NOT NULL DEFAULT 'squeak',
+		original_id INT REFERENCES squeak(id) ON DELETE SET NULL,
+		edited_at TIMESTAMP,
+		deleted_at TIMESTAMP,
+		poll_options TEXT[],
+		poll_closes_at TIMESTAMP,
+		content_warning VARCHAR(100) NOT NULL DEFAULT '',
+		sensitive BOOLEAN NOT NULL DEFAULT FALSE,
+		reply_setting VARCHAR(10) NOT NULL DEFAULT 'everyone',
+		search_vector TSVECTOR GENERATED ALWAYS AS (to_tsvector('english', COALESCE(text, ''))) STORED,
+		FOREIGN KEY (user_id) REFERENCES "user"(id)
+	);
+	ALTER TABLE squeak
+		ADD COLUMN IF NOT EXISTS parent_id INT REFERENCES squeak(id),
+		ADD COLUMN IF NOT EXISTS root_id INT REFERENCES squeak(id),
+		ADD COLUMN IF NOT EXISTS like_count INT NOT NULL DEFAULT 0,
+		ADD COLUMN IF NOT EXISTS kind VARCHAR(10) NOT NULL DEFAULT 'squeak',
+		ADD COLUMN IF NOT EXISTS original_id INT REFERENCES squeak(id) ON DELETE SET NULL,
+		ADD COLUMN IF NOT EXISTS edited_at TIMESTAMP,
+		ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP,
+		ADD COLUMN IF NOT EXISTS poll_options TEXT[],
+		ADD COLUMN IF NOT EXISTS poll_closes_at TIMESTAMP,
+		ADD COLUMN IF NOT EXISTS content_warning VARCHAR(100) NOT NULL DEFAULT '',
+		ADD COLUMN IF NOT EXISTS sensitive BOOLEAN NOT NULL DEFAULT FALSE,
+		ADD COLUMN IF NOT EXISTS reply_setting VARCHAR(10) NOT NULL DEFAULT 'everyone',
+		ADD COLUMN IF NOT EXISTS search_vector TSVECTOR GENERATED ALWAYS AS (to_tsvector('english', COALESCE(text, ''))) STORED;
+	CREATE INDEX IF NOT EXISTS squeak_search_idx ON squeak USING GIN (search_vector);
+	CREATE INDEX IF NOT EXISTS user_search_idx ON "user" USING GIN (to_tsvector('simple', username));
+	CREATE TABLE IF NOT EXISTS "poll_vote" (
+		squeak_id INT,
+		user_id INT,
+		option INT,
+		PRIMARY KEY (squeak_id, user_id),
+		FOREIGN KEY (squeak_id) REFERENCES squeak(id),
+		FOREIGN KEY (user_id) REFERENCES "user"(id)
+	);
+	CREATE TABLE IF NOT EXISTS "media" (
+		id SERIAL PRIMARY KEY,
+		user_id INT,
+		squeak_id INT,
+		position INT,
+		blob_key VARCHAR(64),
+		content_type VARCHAR(50),
+		width INT,
+		height INT,
+		size INT,
+		createdAt TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES "user"(id),
+		FOREIGN KEY (squeak_id) REFERENCES squeak(id)
+	);
+	CREATE INDEX IF NOT EXISTS media_squeak_id_idx ON media (squeak_id);
+	CREATE TABLE IF NOT EXISTS "user_preference" (
+		user_id INT PRIMARY KEY,
+		expand_content_warnings BOOLEAN NOT NULL DEFAULT FALSE,
+		FOREIGN KEY (user_id) REFERENCES "user"(id)
+	);
+	CREATE TABLE IF NOT EXISTS "draft" (
+		id SERIAL PRIMARY KEY,
+		user_id INT,
+		text VARCHAR(255),
+		publish_at TIMESTAMP,
+		createdAt TIMESTAMP,
+		updatedAt TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES "user"(id)
+	);
+	CREATE INDEX IF NOT EXISTS draft_publish_at_idx ON draft (publish_at) WHERE publish_at IS NOT NULL;
+	CREATE TABLE IF NOT EXISTS "squeak_revision" (
+		id SERIAL PRIMARY KEY,
+		squeak_id INT,
+		text VARCHAR(255),
+		createdAt TIMESTAMP,
+		FOREIGN KEY (squeak_id) REFERENCES squeak(id)
+	);
+	CREATE INDEX IF NOT EXISTS squeak_root_id_idx ON squeak (root_id);
+	CREATE INDEX IF NOT EXISTS squeak_created_at_idx ON squeak (createdAt);
+	CREATE TABLE IF NOT EXISTS "squeak_tag" (
+		squeak_id INT,
+		tag VARCHAR(100),
+		PRIMARY KEY (squeak_id, tag),
+		FOREIGN KEY (squeak_id) REFERENCES squeak(id)
+	);
+	CREATE INDEX IF NOT EXISTS squeak_tag_tag_idx ON squeak_tag (tag, squeak_id);
+	CREATE TABLE IF NOT EXISTS "squeak_mention" (
+		squeak_id INT,
+		user_id INT,
+		start_offset INT,
+		end_offset INT,
+		PRIMARY KEY (squeak_id, start_offset),
+		FOREIGN KEY (squeak_id) REFERENCES squeak(id),
+		FOREIGN KEY (user_id) REFERENCES "user"(id)
+	);
+	CREATE INDEX IF NOT EXISTS squeak_mention_user_id_idx ON squeak_mention (user_id, squeak_id);
+	CREATE TABLE IF NOT EXISTS "follow" (
+		follower_id INT,
+		followee_id INT,
+		createdAt TIMESTAMP,
+		PRIMARY KEY (follower_id, followee_id),
+		FOREIGN KEY (follower_id) REFERENCES "user"(id),
+		FOREIGN KEY (followee_id) REFERENCES "user"(id)
+	);
+	CREATE TABLE IF NOT EXISTS "refresh_token" (
+		id SERIAL PRIMARY KEY,
+		user_id INT NOT NULL,
+		family_id VARCHAR(32) NOT NULL,
+		token_hash CHAR(64) UNIQUE NOT NULL,
+		createdAt TIMESTAMP NOT NULL,
+		expires_at TIMESTAMP NOT NULL,
+		used_at TIMESTAMP,
+		revoked_at TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES "user"(id)
+	);
+	CREATE INDEX IF NOT EXISTS refresh_token_family_idx ON refresh_token (family_id);
+	CREATE TABLE IF NOT EXISTS "follow_request" (
+		follower_id INT,
+		followee_id INT,
+		createdAt TIMESTAMP,
+		PRIMARY KEY (follower_id, followee_id),
+		FOREIGN KEY (follower_id) REFERENCES "user"(id),
+		FOREIGN KEY (followee_id) REFERENCES "user"(id)
+	);
+	CREATE INDEX IF NOT EXISTS squeak_user_id_idx ON squeak (user_id, id);
+	CREATE TABLE IF NOT EXISTS "squeak_like" (
+		user_id INT,
+		squeak_id INT,
+		createdAt TIMESTAMP,
+		PRIMARY KEY (squeak_id, user_id),
+		FOREIGN KEY (user_id) REFERENCES "user"(id),
+		FOREIGN KEY (squeak_id) REFERENCES squeak(id)
+	);
+	CREATE TABLE IF NOT EXISTS "timeline" (
+		user_id INT,
+		squeak_id INT,
+		PRIMARY KEY (user_id, squeak_id),
+		FOREIGN KEY (user_id) REFERENCES "user"(id),
+		FOREIGN KEY (squeak_id) REFERENCES squeak(id)
+	);
+	CREATE TABLE IF NOT EXISTS "notification" (
+		id SERIAL PRIMARY KEY,
+		user_id INT,
+		kind VARCHAR(20),
+		squeak_id INT,
+		updated_at TIMESTAMP,
+		read_at TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES "user"(id),
+		FOREIGN KEY (squeak_id) REFERENCES squeak(id)
+	);
+	ALTER TABLE notification ALTER COLUMN kind TYPE VARCHAR(20);
+	CREATE INDEX IF NOT EXISTS notification_user_id_idx ON notification (user_id, id);
+	CREATE UNIQUE INDEX IF NOT EXISTS notification_unread_group_idx ON notification (user_id, kind, COALESCE(squeak_id, 0)) WHERE read_at IS NULL;
+	CREATE TABLE IF NOT EXISTS "notification_actor" (
+		notification_id INT,
+		actor_id INT,
+		createdAt TIMESTAMP,
+		PRIMARY KEY (notification_id, actor_id),
+		FOREIGN KEY (notification_id) REFERENCES notification(id),
+		FOREIGN KEY (actor_id) REFERENCES "user"(id)
+	);
+	CREATE TABLE IF NOT EXISTS "block" (
+		blocker_id INT,
+		blocked_id INT,
+		createdAt TIMESTAMP,
+		PRIMARY KEY (blocker_id, blocked_id),
+		FOREIGN KEY (blocker_id) REFERENCES "user"(id),
+		FOREIGN KEY (blocked_id) REFERENCES "user"(id)
+	);
+	CREATE TABLE IF NOT EXISTS "mute" (
+		muter_id INT,
+		muted_id INT,
+		createdAt TIMESTAMP,
+		PRIMARY KEY (muter_id, muted_id),
+		FOREIGN KEY (muter_id) REFERENCES "user"(id),
+		FOREIGN KEY (muted_id) REFERENCES "user"(id)
+	);
+	CREATE TABLE IF NOT EXISTS "bookmark" (
+		id SERIAL PRIMARY KEY,
+		user_id INT,
+		squeak_id INT,
+		createdAt TIMESTAMP,
+		UNIQUE (user_id, squeak_id),
+		FOREIGN KEY (user_id) REFERENCES "user"(id),
+		FOREIGN KEY (squeak_id) REFERENCES squeak(id)
+	);
+	CREATE TABLE IF NOT EXISTS "list" (
+		id SERIAL PRIMARY KEY,
+		user_id INT,
+		name VARCHAR(50),
+		private BOOLEAN NOT NULL DEFAULT FALSE,
+		createdAt TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES "user"(id)
+	);
+	CREATE TABLE IF NOT EXISTS "list_member" (
+		list_id INT,
+		user_id INT,
+		PRIMARY KEY (list_id, user_id),
+		FOREIGN KEY (list_id) REFERENCES list(id) ON DELETE CASCADE,
+		FOREIGN KEY (user_id) REFERENCES "user"(id)
+	);
+	CREATE TABLE IF NOT EXISTS "conversation" (
+		id SERIAL PRIMARY KEY,
+		createdAt TIMESTAMP
+	);
+	CREATE TABLE IF NOT EXISTS "conversation_participant" (
+		conversation_id INT,
+		user_id INT,
+		last_read_id INT NOT NULL DEFAULT 0,
+		PRIMARY KEY (conversation_id, user_id),
+		FOREIGN KEY (conversation_id) REFERENCES conversation(id),
 		FOREIGN KEY (user_id) REFERENCES "user"(id)
-	)`
+	);
+	CREATE INDEX IF NOT EXISTS conversation_participant_user_id_idx ON conversation_participant (user_id);
+	CREATE TABLE IF NOT EXISTS "message" (
+		id SERIAL PRIMARY KEY,
+		conversation_id INT,
+		sender_id INT,
+		text VARCHAR(1000),
+		createdAt TIMESTAMP,
+		FOREIGN KEY (conversation_id) REFERENCES conversation(id),
+		FOREIGN KEY (sender_id) REFERENCES "user"(id)
+	);
+	CREATE INDEX IF NOT EXISTS message_conversation_id_idx ON message (conversation_id, id)`
 
 	_, err := db.Exec(query)
 	if err != nil {
 		log.Fatalf("error initializing database: %v", err)
 	}
+
+	if !hasCounts {
+		query = `UPDATE "user" u SET
+			follower_count = (SELECT COUNT(*) FROM follow WHERE followee_id = u.id),
+			following_count = (SELECT COUNT(*) FROM follow WHERE follower_id = u.id),
+			squeak_count = (SELECT COUNT(*) FROM squeak WHERE user_id = u.id AND deleted_at IS NULL)`
+
+		if _, err := db.Exec(query); err != nil {
+			log.Fatalf("error initializing database: %v", err)
+		}
+	}
 }
 
 func clearDatabase(db *sql.DB) {
-	_, err := db.Exec(`DROP TABLE IF EXISTS squeak; DROP TABLE IF EXISTS "user";`)
+	_, err := db.Exec(`DROP TABLE IF EXISTS message; DROP TABLE IF EXISTS conversation_participant; DROP TABLE IF EXISTS conversation; DROP TABLE IF EXISTS list_member; DROP TABLE IF EXISTS list; DROP TABLE IF EXISTS bookmark; DROP TABLE IF EXISTS mute; DROP TABLE IF EXISTS block; DROP TABLE IF EXISTS notification_actor; DROP TABLE IF EXISTS notification; DROP TABLE IF EXISTS squeak_mention; DROP TABLE IF EXISTS squeak_tag; DROP TABLE IF EXISTS squeak_revision; DROP TABLE IF EXISTS poll_vote; DROP TABLE IF EXISTS media; DROP TABLE IF EXISTS draft; DROP TABLE IF EXISTS user_preference; DROP TABLE IF EXISTS squeak_like; DROP TABLE IF EXISTS timeline; DROP TABLE IF EXISTS refresh_token; DROP TABLE IF EXISTS follow_request; DROP TABLE IF EXISTS follow; DROP TABLE IF EXISTS squeak; DROP TABLE IF EXISTS "user";`)
 	if err != nil {
 		log.Fatalf("error dropping table: %v", err)
 	}
 }
 
 type PostgreSQLUserStore struct {
-	db *sql.DB
+	db           *sql.DB
+	timelineMode TimelineMode
 }
 
 func NewPostgreSQLUserStore(db *sql.DB) *PostgreSQLUserStore {
 	return &PostgreSQLUserStore{db: db}
 }
 
+// SetTimelineMode switches how timelines are assembled. Switching to
+// FanOutOnWrite rebuilds the precomputed timelines from the current squeaks
+// and follows, so it should happen at startup before serving requests.
+func (s *PostgreSQLUserStore) SetTimelineMode(mode TimelineMode) error {
+	if mode == FanOutOnWrite {
+		tx, err := s.db.Begin()
+		if err != nil {
+			return fmt.Errorf("SetTimelineMode: %w", err)
+		}
+		defer tx.Rollback()
+
+		query := `DELETE FROM timeline;
+			INSERT INTO timeline (user_id, squeak_id)
+			SELECT user_id, id FROM squeak
+			UNION SELECT f.follower_id, s.id FROM follow f JOIN squeak s ON s.user_id = f.followee_id`
+
+		if _, err := tx.Exec(query); err != nil {
+			return fmt.Errorf("SetTimelineMode: %w", err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("SetTimelineMode: %w", err)
+		}
+	}
+
+	s.timelineMode = mode
+	return nil
+}
+
 func NewPostgreSQLConnection(dsName string) (*sql.DB, error) {
 
 	db, err := sql.Open("postgres", dsName)
@@ -75,7 +369,7 @@ func (s *PostgreSQLUserStore) CreateUser(username, email, password string) (int,
 }
 
 func (s *PostgreSQLUserStore) GetUserByID(id int) (*User, error) {
-	query := `SELECT * FROM "user" WHERE id = $1`
+	query := `SELECT id, username, email, password, createdAt FROM "user" WHERE id = $1`
 
 	user := new(User)
 	err := s.db.QueryRow(query, id).Scan(&user.ID, &user.Username, &user.Email, &user.Password, &user.CreatedAt)
@@ -90,7 +384,7 @@ func (s *PostgreSQLUserStore) GetUserByID(id int) (*User, error) {
 }
 
 func (s *PostgreSQLUserStore) GetUserByUsername(username string) (*User, error) {
-	query := `SELECT * FROM "user"	WHERE username = $1`
+	query := `SELECT id, username, email, password, createdAt FROM "user" WHERE username = $1`
 
 	user := new(User)
 	err := s.db.QueryRow(query, username).Scan(&user.ID, &user.Username, &user.Email, &user.Password, &user.CreatedAt)
@@ -109,10 +403,8 @@ func (s *PostgreSQLUserStore) PostSqueak(name, squeak string) (int, error) {
 	if err != nil {
 		return 0, fmt.Errorf("error trying to post new squeak: %s", err)
 	}
-	query := `INSERT INTO squeak (user_id, text, createdAt) VALUES ($1, $2, $3) RETURNING id`
 
-	var id int
-	err = s.db.QueryRow(query, user.ID, squeak, time.Now()).Scan(&id)
+	id, err := s.insertSqueak(SqueakPost{UserID: user.ID, Text: squeak, Kind: KindSqueak})
 	if err != nil {
 		return 0, fmt.Errorf("PostSqueak: %w", err)
 	}
@@ -120,67 +412,2366 @@ func (s *PostgreSQLUserStore) PostSqueak(name, squeak string) (int, error) {
 	return id, nil
 }
 
-func (s *PostgreSQLUserStore) GetUserSqueaks(username string) ([]SqueakPost, error) {
-	user, err := s.GetUserByUsername(username)
+func (s *PostgreSQLUserStore) CreateSqueak(author string, squeak SqueakPost) (int, error) {
+	user, err := s.GetUserByUsername(author)
 	if err != nil {
-		return nil, fmt.Errorf("no user with that username (%s) found", username)
+		return 0, fmt.Errorf("error trying to post new squeak: %s", err)
 	}
-	query := `SELECT text, createdAt FROM squeak WHERE user_id = $1`
 
-	var squeaks []SqueakPost
-	rows, err := s.db.Query(query, user.ID)
+	squeak.UserID, squeak.Kind = user.ID, KindSqueak
+
+	id, err := s.insertSqueak(squeak)
 	if err != nil {
-		return nil, fmt.Errorf("GetUserSqueaks: %w", err)
+		return 0, fmt.Errorf("CreateSqueak: %w", err)
 	}
 
-	defer rows.Close()
+	return id, nil
+}
 
-	var squeak SqueakPost
-	for rows.Next() {
-		if err := rows.Scan(&squeak.Text, &squeak.CreatedAt); err != nil {
-			return nil, fmt.Errorf("GetUserSqueaks: %w", err)
+func (s *PostgreSQLUserStore) PostReply(name string, parentID int, squeak string) (int, error) {
+	user, err := s.GetUserByUsername(name)
+	if err != nil {
+		return 0, fmt.Errorf("error trying to post new reply: %s", err)
+	}
+
+	parent, err := s.GetSqueak(parentID)
+	if err != nil {
+		return 0, fmt.Errorf("PostReply: %w", err)
+	}
+
+	rootID := parent.ID
+	if parent.RootID != nil {
+		rootID = *parent.RootID
+	}
+
+	id, err := s.insertSqueak(SqueakPost{UserID: user.ID, Text: squeak, Kind: KindSqueak, ParentID: &parent.ID, RootID: &rootID})
+	if err != nil {
+		return 0, fmt.Errorf("PostReply: %w", err)
+	}
+
+	return id, nil
+}
+
+func (s *PostgreSQLUserStore) PostResqueak(name string, originalID int, quote string) (int, error) {
+	user, err := s.GetUserByUsername(name)
+	if err != nil {
+		return 0, fmt.Errorf("error trying to post new resqueak: %s", err)
+	}
+
+	original, err := s.GetSqueak(originalID)
+	if err != nil {
+		return 0, fmt.Errorf("PostResqueak: %w", err)
+	}
+
+	id, err := s.insertSqueak(newResqueak(user.ID, original, quote))
+	if err != nil {
+		return 0, fmt.Errorf("PostResqueak: %w", err)
+	}
+
+	return id, nil
+}
+
+func (s *PostgreSQLUserStore) GetSqueaksByIDs(ids []int) (map[int]SqueakPost, error) {
+	query := `SELECT ` + squeakColumns + ` FROM squeak s JOIN "user" u ON u.id = s.user_id
+		WHERE s.id = ANY($1) AND s.deleted_at IS NULL`
+
+	squeaks, err := s.querySqueaks(query, pq.Array(ids))
+	if err != nil {
+		return nil, fmt.Errorf("GetSqueaksByIDs: %w", err)
+	}
+
+	byID := make(map[int]SqueakPost, len(squeaks))
+	for _, squeak := range squeaks {
+		byID[squeak.ID] = squeak
+	}
+
+	return byID, nil
+}
+
+// insertSqueak stores a new squeak and, in FanOutOnWrite mode, adds it to
+// the timelines of the author and their followers in the same transaction.
+func (s *PostgreSQLUserStore) insertSqueak(squeak SqueakPost) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	id, err := s.insertSqueakTx(tx, squeak)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, tx.Commit()
+}
+
+// insertSqueakTx does the work of insertSqueak within tx, attaching the
+// media squeak.MediaIDs to it as well. Squeaks without a reply setting let
+// everyone reply.
+func (s *PostgreSQLUserStore) insertSqueakTx(tx *sql.Tx, squeak SqueakPost) (int, error) {
+	query := `INSERT INTO squeak (user_id, text, createdAt, parent_id, root_id, kind, original_id, poll_options, poll_closes_at,
+			content_warning, sensitive, reply_setting)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12) RETURNING id`
+
+	var pollOptions any
+	var pollClosesAt *time.Time
+	if squeak.Poll != nil {
+		pollOptions = pq.Array(squeak.Poll.optionTexts())
+		closesAt := squeak.Poll.ClosesAt.UTC()
+		pollClosesAt = &closesAt
+	}
+
+	replySetting := squeak.ReplySetting
+	if replySetting == "" {
+		replySetting = ReplyEveryone
+	}
+
+	var id int
+	err := tx.QueryRow(query, squeak.UserID, squeak.Text, time.Now(), squeak.ParentID, squeak.RootID, squeak.Kind, squeak.OriginalID, pollOptions, pollClosesAt,
+		squeak.ContentWarning, squeak.Sensitive, replySetting).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	for position, mediaID := range squeak.MediaIDs {
+		result, err := tx.Exec(`UPDATE media SET squeak_id = $1, position = $2 WHERE id = $3 AND squeak_id IS NULL`, id, position, mediaID)
+		if err != nil {
+			return 0, err
+		}
+
+		if attached, err := result.RowsAffected(); err != nil {
+			return 0, err
+		} else if attached == 0 {
+			return 0, fmt.Errorf("media %d is missing or attached already", mediaID)
 		}
-		squeaks = append(squeaks, squeak)
 	}
 
-	if len(squeaks) == 0 {
-		return nil, fmt.Errorf("no squeaks found for %s", username)
+	if s.timelineMode == FanOutOnWrite {
+		query = `INSERT INTO timeline (user_id, squeak_id)
+			SELECT $1::INT, $2::INT UNION SELECT follower_id, $2 FROM follow WHERE followee_id = $1`
+
+		if _, err := tx.Exec(query, squeak.UserID, id); err != nil {
+			return 0, err
+		}
 	}
 
-	return squeaks, nil
+	if _, err := tx.Exec(`UPDATE "user" SET squeak_count = squeak_count + 1 WHERE id = $1`, squeak.UserID); err != nil {
+		return 0, err
+	}
+
+	if err := indexTags(tx, id, squeak.Text); err != nil {
+		return 0, err
+	}
+
+	if err := s.storeMentions(tx, id, squeak.UserID, squeak.Text); err != nil {
+		return 0, err
+	}
+
+	return id, nil
 }
 
-func (s *PostgreSQLUserStore) GetUserbase() ([]User, error) {
-	query := `SELECT u.id, username, email, password, s.text, s.createdAt, u.createdAt FROM "user" u JOIN "squeak" s 
-		ON u.id = s.user_id ORDER BY u.id, s.id;`
+// storeMentions replaces the mentions stored for squeak id with the ones
+// resolved from text. Users blocking the author or blocked by them are not
+// mentioned.
+func (s *PostgreSQLUserStore) storeMentions(tx *sql.Tx, id, authorID int, text string) error {
+	if _, err := tx.Exec(`DELETE FROM squeak_mention WHERE squeak_id = $1`, id); err != nil {
+		return err
+	}
 
-	rows, err := s.db.Query(query)
+	var lookupErr error
+	lookup := func(username string) (*User, error) {
+		user, err := s.GetUserByUsername(username)
+		if err != nil {
+			return nil, err
+		}
+
+		query := `SELECT EXISTS (SELECT 1 FROM block
+			WHERE (blocker_id = $1 AND blocked_id = $2) OR (blocker_id = $2 AND blocked_id = $1))`
+
+		var blocked bool
+		if err := tx.QueryRow(query, authorID, user.ID).Scan(&blocked); err != nil {
+			lookupErr = err
+			return nil, err
+		}
+		if blocked {
+			return nil, fmt.Errorf("%s cannot be mentioned", username)
+		}
+
+		return user, nil
+	}
+
+	mentions := resolveMentions(text, lookup)
+	if lookupErr != nil {
+		return lookupErr
+	}
+
+	query := `INSERT INTO squeak_mention (squeak_id, user_id, start_offset, end_offset) VALUES ($1, $2, $3, $4)`
+
+	for _, mention := range mentions {
+		if _, err := tx.Exec(query, id, mention.UserID, mention.Start, mention.End); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// indexTags replaces the tags indexed for squeak id with the hashtags in text.
+func indexTags(tx *sql.Tx, id int, text string) error {
+	if _, err := tx.Exec(`DELETE FROM squeak_tag WHERE squeak_id = $1`, id); err != nil {
+		return err
+	}
+
+	for _, tag := range extractHashtags(text) {
+		if _, err := tx.Exec(`INSERT INTO squeak_tag (squeak_id, tag) VALUES ($1, $2)`, id, tag); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *PostgreSQLUserStore) GetSqueak(id int) (*SqueakPost, error) {
+	query := `SELECT ` + squeakColumns + ` FROM squeak s JOIN "user" u ON u.id = s.user_id
+		WHERE s.id = $1 AND s.deleted_at IS NULL`
+
+	squeaks, err := s.querySqueaks(query, id)
 	if err != nil {
-		return nil, fmt.Errorf("GetUserbase: %w", err)
+		return nil, fmt.Errorf("GetSqueak: %w", err)
 	}
 
-	var userbase []User
+	if len(squeaks) == 0 {
+		return nil, ErrSqueakNotFound
+	}
 
-	for rows.Next() {
-		user := new(User)
-		var squeak SqueakPost
-		if err := rows.Scan(&user.ID, &user.Username, &user.Email, &user.Password, &squeak.Text, &squeak.CreatedAt, &user.CreatedAt); err != nil {
-			return nil, fmt.Errorf("GetUserbase: %w", err)
+	return &squeaks[0], nil
+}
+
+// EditSqueak applies edit to squeak id in one transaction. A new text keeps
+// the text it replaces as a revision; flags left unset keep their values.
+func (s *PostgreSQLUserStore) EditSqueak(id int, edit SqueakEdit) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("EditSqueak: %w", err)
+	}
+	defer tx.Rollback()
+
+	var revision SqueakRevision
+	var authorID int
+	query := `SELECT text, COALESCE(edited_at, createdAt), user_id FROM squeak WHERE id = $1 AND deleted_at IS NULL FOR UPDATE`
+
+	if err := tx.QueryRow(query, id).Scan(&revision.Text, &revision.CreatedAt, &authorID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrSqueakNotFound
 		}
+		return fmt.Errorf("EditSqueak: %w", err)
+	}
 
-		userExists := false
-		for i := range userbase {
-			if userbase[i].Username == user.Username {
-				userbase[i].Squeaks = append(userbase[i].Squeaks, squeak)
-				userExists = true
-				break
-			}
+	query = `UPDATE squeak SET content_warning = COALESCE($2, content_warning), sensitive = COALESCE($3, sensitive),
+		reply_setting = COALESCE($4, reply_setting) WHERE id = $1`
+
+	if _, err := tx.Exec(query, id, edit.ContentWarning, edit.Sensitive, edit.ReplySetting); err != nil {
+		return fmt.Errorf("EditSqueak: %w", err)
+	}
+
+	if edit.Text != nil {
+		text := *edit.Text
+		query = `INSERT INTO squeak_revision (squeak_id, text, createdAt) VALUES ($1, $2, $3)`
+
+		if _, err := tx.Exec(query, id, revision.Text, revision.CreatedAt); err != nil {
+			return fmt.Errorf("EditSqueak: %w", err)
+		}
+
+		if _, err := tx.Exec(`UPDATE squeak SET text = $2, edited_at = $3 WHERE id = $1`, id, text, time.Now()); err != nil {
+			return fmt.Errorf("EditSqueak: %w", err)
+		}
+
+		if err := indexTags(tx, id, text); err != nil {
+			return fmt.Errorf("EditSqueak: %w", err)
 		}
 
-		if !userExists {
-			userbase = append(userbase, User{ID: user.ID, Username: user.Username, Email: user.Email, Password: user.Password, Squeaks: []SqueakPost{squeak}})
+		if err := s.storeMentions(tx, id, authorID, text); err != nil {
+			return fmt.Errorf("EditSqueak: %w", err)
 		}
 	}
 
-	return userbase, nil
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("EditSqueak: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteSqueak soft deletes squeak id. Its row stays so that replies and
+// likes keep pointing at it, but its author's pin is cleared if it was on it.
+func (s *PostgreSQLUserStore) DeleteSqueak(id int) error {
+	query := `WITH deleted AS (
+			UPDATE squeak SET deleted_at = $2 WHERE id = $1 AND deleted_at IS NULL RETURNING id, user_id
+		)
+		UPDATE "user" u SET squeak_count = squeak_count - 1, pinned_squeak_id = NULLIF(pinned_squeak_id, deleted.id)
+		FROM deleted WHERE u.id = deleted.user_id`
+
+	result, err := s.db.Exec(query, id, time.Now())
+	if err != nil {
+		return fmt.Errorf("DeleteSqueak: %w", err)
+	}
+
+	if deleted, _ := result.RowsAffected(); deleted == 0 {
+		return ErrSqueakNotFound
+	}
+
+	return nil
+}
+
+func (s *PostgreSQLUserStore) GetSqueakHistory(id int) ([]SqueakRevision, error) {
+	if _, err := s.GetSqueak(id); err != nil {
+		return nil, fmt.Errorf("GetSqueakHistory: %w", err)
+	}
+
+	query := `SELECT text, createdAt FROM (
+			SELECT id, text, createdAt FROM squeak_revision WHERE squeak_id = $1
+			UNION ALL SELECT NULL, text, COALESCE(edited_at, createdAt) FROM squeak WHERE id = $1
+		) history ORDER BY id NULLS LAST`
+
+	rows, err := s.db.Query(query, id)
+	if err != nil {
+		return nil, fmt.Errorf("GetSqueakHistory: %w", err)
+	}
+
+	defer rows.Close()
+
+	var history []SqueakRevision
+	for rows.Next() {
+		var revision SqueakRevision
+		if err := rows.Scan(&revision.Text, &revision.CreatedAt); err != nil {
+			return nil, fmt.Errorf("GetSqueakHistory: %w", err)
+		}
+		history = append(history, revision)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("GetSqueakHistory: %w", err)
+	}
+
+	return history, nil
+}
+
+func (s *PostgreSQLUserStore) GetConversation(rootID int) ([]SqueakPost, error) {
+	query := `SELECT ` + squeakColumns + ` FROM squeak s JOIN "user" u ON u.id = s.user_id
+		WHERE s.id = $1 OR s.root_id = $1 ORDER BY s.id`
+
+	squeaks, err := s.querySqueaks(query, rootID)
+	if err != nil {
+		return nil, fmt.Errorf("GetConversation: %w", err)
+	}
+
+	return squeaks, nil
+}
+
+func (s *PostgreSQLUserStore) GetUserSqueaks(username string) ([]SqueakPost, error) {
+	user, err := s.GetUserByUsername(username)
+	if err != nil {
+		return nil, fmt.Errorf("no user with that username (%s) found", username)
+	}
+	query := `SELECT ` + squeakColumns + ` FROM squeak s JOIN "user" u ON u.id = s.user_id
+		WHERE s.user_id = $1 AND s.deleted_at IS NULL ORDER BY s.id`
+
+	squeaks, err := s.querySqueaks(query, user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("GetUserSqueaks: %w", err)
+	}
+
+	if len(squeaks) == 0 {
+		return nil, fmt.Errorf("no squeaks found for %s", username)
+	}
+
+	return squeaks, nil
+}
+
+func (s *PostgreSQLUserStore) GetUserbase() ([]User, error) {
+	query := `SELECT u.id, u.username, u.email, u.password, u.createdAt FROM "user" u
+		WHERE EXISTS (SELECT 1 FROM squeak s WHERE s.user_id = u.id AND s.deleted_at IS NULL) ORDER BY u.id`
+
+	rows, err := s.db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("GetUserbase: %w", err)
+	}
+
+	defer rows.Close()
+
+	var userbase []User
+	index := map[int]int{}
+	for rows.Next() {
+		var user User
+		if err := rows.Scan(&user.ID, &user.Username, &user.Email, &user.Password, &user.CreatedAt); err != nil {
+			return nil, fmt.Errorf("GetUserbase: %w", err)
+		}
+		index[user.ID] = len(userbase)
+		userbase = append(userbase, user)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("GetUserbase: %w", err)
+	}
+
+	query = `SELECT ` + squeakColumns + ` FROM squeak s JOIN "user" u ON u.id = s.user_id
+		WHERE s.deleted_at IS NULL ORDER BY s.user_id, s.id`
+
+	squeaks, err := s.querySqueaks(query)
+	if err != nil {
+		return nil, fmt.Errorf("GetUserbase: %w", err)
+	}
+
+	for _, squeak := range squeaks {
+		if i, ok := index[squeak.UserID]; ok {
+			userbase[i].Squeaks = append(userbase[i].Squeaks, squeak)
+		}
+	}
+
+	return userbase, nil
+}
+
+func (s *PostgreSQLUserStore) FollowUser(follower, followee string) error {
+	from, err := s.GetUserByUsername(follower)
+	if err != nil {
+		return fmt.Errorf("FollowUser: %w", err)
+	}
+	to, err := s.GetUserByUsername(followee)
+	if err != nil {
+		return fmt.Errorf("FollowUser: %w", err)
+	}
+	if from.ID == to.ID {
+		return fmt.Errorf("FollowUser: %s cannot follow themselves", follower)
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("FollowUser: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := s.followTx(tx, from.ID, to.ID); err != nil {
+		return fmt.Errorf("FollowUser: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("FollowUser: %w", err)
+	}
+
+	return nil
+}
+
+// followTx makes follower follow followee, doing nothing when it does
+// already.
+func (s *PostgreSQLUserStore) followTx(tx *sql.Tx, follower, followee int) error {
+	query := `INSERT INTO follow (follower_id, followee_id, createdAt) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING`
+
+	result, err := tx.Exec(query, follower, followee, time.Now())
+	if err != nil {
+		return err
+	}
+
+	if inserted, _ := result.RowsAffected(); inserted == 0 {
+		return nil
+	}
+
+	if err := updateFollowCounts(tx, follower, followee, 1); err != nil {
+		return err
+	}
+
+	if s.timelineMode == FanOutOnWrite {
+		query = `INSERT INTO timeline (user_id, squeak_id) SELECT $1, id FROM squeak WHERE user_id = $2
+			ON CONFLICT DO NOTHING`
+
+		if _, err := tx.Exec(query, follower, followee); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *PostgreSQLUserStore) UnfollowUser(follower, followee string) error {
+	from, err := s.GetUserByUsername(follower)
+	if err != nil {
+		return fmt.Errorf("UnfollowUser: %w", err)
+	}
+	to, err := s.GetUserByUsername(followee)
+	if err != nil {
+		return fmt.Errorf("UnfollowUser: %w", err)
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("UnfollowUser: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := s.unfollowTx(tx, from.ID, to.ID); err != nil {
+		return fmt.Errorf("UnfollowUser: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("UnfollowUser: %w", err)
+	}
+
+	return nil
+}
+
+// unfollowTx makes follower stop following followee and drops any pending
+// follow request between them, doing nothing when there is neither.
+func (s *PostgreSQLUserStore) unfollowTx(tx *sql.Tx, follower, followee int) error {
+	if _, err := tx.Exec(`DELETE FROM follow_request WHERE follower_id = $1 AND followee_id = $2`, follower, followee); err != nil {
+		return err
+	}
+
+	query := `DELETE FROM follow WHERE follower_id = $1 AND followee_id = $2`
+
+	result, err := tx.Exec(query, follower, followee)
+	if err != nil {
+		return err
+	}
+
+	if deleted, _ := result.RowsAffected(); deleted == 1 {
+		if err := updateFollowCounts(tx, follower, followee, -1); err != nil {
+			return err
+		}
+	}
+
+	if s.timelineMode == FanOutOnWrite {
+		query = `DELETE FROM timeline t USING squeak s
+			WHERE t.squeak_id = s.id AND t.user_id = $1 AND s.user_id = $2`
+
+		if _, err := tx.Exec(query, follower, followee); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// updateFollowCounts adds delta to the following count of follower and the
+// follower count of followee.
+func updateFollowCounts(tx *sql.Tx, follower, followee, delta int) error {
+	query := `UPDATE "user" SET
+			following_count = following_count + CASE WHEN id = $1 THEN $3 ELSE 0 END,
+			follower_count = follower_count + CASE WHEN id = $2 THEN $3 ELSE 0 END
+		WHERE id IN ($1, $2)`
+
+	_, err := tx.Exec(query, follower, followee, delta)
+	return err
+}
+
+func (s *PostgreSQLUserStore) IsFollowing(follower, followee string) (bool, error) {
+	query := `SELECT EXISTS (SELECT 1 FROM follow f JOIN "user" a ON a.id = f.follower_id JOIN "user" b ON b.id = f.followee_id
+		WHERE a.username = $1 AND b.username = $2)`
+
+	var following bool
+	if err := s.db.QueryRow(query, follower, followee).Scan(&following); err != nil {
+		return false, fmt.Errorf("IsFollowing: %w", err)
+	}
+
+	return following, nil
+}
+
+func (s *PostgreSQLUserStore) GetFollowers(name string) ([]User, error) {
+	user, err := s.GetUserByUsername(name)
+	if err != nil {
+		return nil, err
+	}
+	query := `SELECT u.id, u.username, u.createdAt FROM follow f JOIN "user" u ON u.id = f.follower_id
+		WHERE f.followee_id = $1 ORDER BY f.createdAt, u.id`
+
+	followers, err := s.queryUsers(query, user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("GetFollowers: %w", err)
+	}
+
+	return followers, nil
+}
+
+func (s *PostgreSQLUserStore) GetFollowing(name string) ([]User, error) {
+	user, err := s.GetUserByUsername(name)
+	if err != nil {
+		return nil, err
+	}
+	query := `SELECT u.id, u.username, u.createdAt FROM follow f JOIN "user" u ON u.id = f.followee_id
+		WHERE f.follower_id = $1 ORDER BY f.createdAt, u.id`
+
+	following, err := s.queryUsers(query, user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("GetFollowing: %w", err)
+	}
+
+	return following, nil
+}
+
+func (s *PostgreSQLUserStore) GetTimeline(name string, cursor, limit int) ([]SqueakPost, error) {
+	user, err := s.GetUserByUsername(name)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `SELECT ` + squeakColumns + ` FROM squeak s JOIN "user" u ON u.id = s.user_id
+		WHERE (s.user_id = $1 OR s.user_id IN (SELECT followee_id FROM follow WHERE follower_id = $1))
+		AND ($2 = 0 OR s.id < $2) AND s.deleted_at IS NULL ORDER BY s.id DESC LIMIT $3`
+
+	if s.timelineMode == FanOutOnWrite {
+		query = `SELECT ` + squeakColumns + ` FROM timeline t JOIN squeak s ON s.id = t.squeak_id
+			JOIN "user" u ON u.id = s.user_id
+			WHERE t.user_id = $1 AND ($2 = 0 OR t.squeak_id < $2) AND s.deleted_at IS NULL
+			ORDER BY t.squeak_id DESC LIMIT $3`
+	}
+
+	squeaks, err := s.querySqueaks(query, user.ID, cursor, limit)
+	if err != nil {
+		return nil, fmt.Errorf("GetTimeline: %w", err)
+	}
+
+	return squeaks, nil
+}
+
+// LikeSqueak records the like and bumps the squeak's like_count in one
+// transaction. The increment happens in the UPDATE itself and only when the
+// like was new, so concurrent likes never lose or double count.
+func (s *PostgreSQLUserStore) LikeSqueak(name string, id int) error {
+	user, err := s.GetUserByUsername(name)
+	if err != nil {
+		return fmt.Errorf("LikeSqueak: %w", err)
+	}
+	if _, err := s.GetSqueak(id); err != nil {
+		return fmt.Errorf("LikeSqueak: %w", err)
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("LikeSqueak: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `INSERT INTO squeak_like (user_id, squeak_id, createdAt) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING`
+
+	result, err := tx.Exec(query, user.ID, id, time.Now())
+	if err != nil {
+		return fmt.Errorf("LikeSqueak: %w", err)
+	}
+
+	if inserted, _ := result.RowsAffected(); inserted == 1 {
+		if _, err := tx.Exec(`UPDATE squeak SET like_count = like_count + 1 WHERE id = $1`, id); err != nil {
+			return fmt.Errorf("LikeSqueak: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("LikeSqueak: %w", err)
+	}
+
+	return nil
+}
+
+func (s *PostgreSQLUserStore) UnlikeSqueak(name string, id int) error {
+	user, err := s.GetUserByUsername(name)
+	if err != nil {
+		return fmt.Errorf("UnlikeSqueak: %w", err)
+	}
+	if _, err := s.GetSqueak(id); err != nil {
+		return fmt.Errorf("UnlikeSqueak: %w", err)
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("UnlikeSqueak: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`DELETE FROM squeak_like WHERE user_id = $1 AND squeak_id = $2`, user.ID, id)
+	if err != nil {
+		return fmt.Errorf("UnlikeSqueak: %w", err)
+	}
+
+	if deleted, _ := result.RowsAffected(); deleted == 1 {
+		if _, err := tx.Exec(`UPDATE squeak SET like_count = like_count - 1 WHERE id = $1`, id); err != nil {
+			return fmt.Errorf("UnlikeSqueak: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("UnlikeSqueak: %w", err)
+	}
+
+	return nil
+}
+
+func (s *PostgreSQLUserStore) GetSqueakLikes(id int) ([]User, error) {
+	if _, err := s.GetSqueak(id); err != nil {
+		return nil, fmt.Errorf("GetSqueakLikes: %w", err)
+	}
+
+	query := `SELECT u.id, u.username, u.createdAt FROM squeak_like l JOIN "user" u ON u.id = l.user_id
+		WHERE l.squeak_id = $1 ORDER BY l.createdAt, u.id`
+
+	users, err := s.queryUsers(query, id)
+	if err != nil {
+		return nil, fmt.Errorf("GetSqueakLikes: %w", err)
+	}
+
+	return users, nil
+}
+
+func (s *PostgreSQLUserStore) GetLikedSqueaks(name string, ids []int) (map[int]bool, error) {
+	user, err := s.GetUserByUsername(name)
+	if err != nil {
+		return nil, fmt.Errorf("GetLikedSqueaks: %w", err)
+	}
+
+	query := `SELECT squeak_id FROM squeak_like WHERE user_id = $1 AND squeak_id = ANY($2)`
+
+	liked, err := s.queryIDSet(query, user.ID, pq.Array(ids))
+	if err != nil {
+		return nil, fmt.Errorf("GetLikedSqueaks: %w", err)
+	}
+
+	return liked, nil
+}
+
+// queryIDSet runs a query selecting a single integer column and collects
+// the values into a set.
+func (s *PostgreSQLUserStore) queryIDSet(query string, args ...any) (map[int]bool, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	ids := map[int]bool{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids[id] = true
+	}
+
+	return ids, rows.Err()
+}
+
+func (s *PostgreSQLUserStore) GetTaggedSqueaks(tag string, cursor, limit int) ([]SqueakPost, error) {
+	query := `SELECT ` + squeakColumns + ` FROM squeak_tag t JOIN squeak s ON s.id = t.squeak_id
+		JOIN "user" u ON u.id = s.user_id
+		WHERE t.tag = $1 AND ($2 = 0 OR t.squeak_id < $2) AND s.deleted_at IS NULL
+		ORDER BY t.squeak_id DESC LIMIT $3`
+
+	squeaks, err := s.querySqueaks(query, tag, cursor, limit)
+	if err != nil {
+		return nil, fmt.Errorf("GetTaggedSqueaks: %w", err)
+	}
+
+	return squeaks, nil
+}
+
+func (s *PostgreSQLUserStore) GetMentioningSqueaks(name string, cursor, limit int) ([]SqueakPost, error) {
+	user, err := s.GetUserByUsername(name)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `SELECT ` + squeakColumns + ` FROM squeak s JOIN "user" u ON u.id = s.user_id
+		WHERE s.id IN (SELECT squeak_id FROM squeak_mention WHERE user_id = $1)
+		AND ($2 = 0 OR s.id < $2) AND s.deleted_at IS NULL ORDER BY s.id DESC LIMIT $3`
+
+	squeaks, err := s.querySqueaks(query, user.ID, cursor, limit)
+	if err != nil {
+		return nil, fmt.Errorf("GetMentioningSqueaks: %w", err)
+	}
+
+	return squeaks, nil
+}
+
+func (s *PostgreSQLUserStore) GetTrendingTags(since time.Time, limit int) ([]TagCount, error) {
+	query := `SELECT t.tag, COUNT(*) FROM squeak_tag t JOIN squeak s ON s.id = t.squeak_id
+		WHERE s.createdAt > $1 AND s.deleted_at IS NULL
+		GROUP BY t.tag ORDER BY COUNT(*) DESC, t.tag LIMIT $2`
+
+	rows, err := s.db.Query(query, since, limit)
+	if err != nil {
+		return nil, fmt.Errorf("GetTrendingTags: %w", err)
+	}
+
+	defer rows.Close()
+
+	trending := []TagCount{}
+	for rows.Next() {
+		var tag TagCount
+		if err := rows.Scan(&tag.Tag, &tag.Count); err != nil {
+			return nil, fmt.Errorf("GetTrendingTags: %w", err)
+		}
+		trending = append(trending, tag)
+	}
+
+	return trending, rows.Err()
+}
+
+// squeakColumns lists the columns querySqueaks scans, selected from
+// squeak s joined with "user" u.
+// Deleted squeaks come back without their text and with Unavailable set.
+const squeakColumns = `s.id, s.user_id, u.username, CASE WHEN s.deleted_at IS NULL THEN s.text ELSE '' END,
+	s.createdAt, s.parent_id, s.root_id, s.like_count, s.kind, s.original_id, s.edited_at, s.deleted_at IS NOT NULL,
+	s.poll_options, s.poll_closes_at, s.content_warning, s.sensitive, s.reply_setting`
+
+func (s *PostgreSQLUserStore) querySqueaks(query string, args ...any) ([]SqueakPost, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var squeaks []SqueakPost
+	for rows.Next() {
+		var squeak SqueakPost
+		var pollOptions []string
+		var pollClosesAt *time.Time
+		err := rows.Scan(
+			&squeak.ID, &squeak.UserID, &squeak.Author, &squeak.Text,
+			&squeak.CreatedAt, &squeak.ParentID, &squeak.RootID, &squeak.LikeCount, &squeak.Kind, &squeak.OriginalID, &squeak.EditedAt, &squeak.Unavailable,
+			pq.Array(&pollOptions), &pollClosesAt, &squeak.ContentWarning, &squeak.Sensitive, &squeak.ReplySetting,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if pollClosesAt != nil {
+			squeak.Poll = newPoll(pollOptions, *pollClosesAt)
+		}
+		squeaks = append(squeaks, squeak)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := s.attachMentions(squeaks); err != nil {
+		return nil, err
+	}
+
+	if err := s.attachPollVotes(squeaks); err != nil {
+		return nil, err
+	}
+
+	if err := s.attachMedia(squeaks); err != nil {
+		return nil, err
+	}
+
+	return squeaks, nil
+}
+
+// attachMentions loads the mentions of squeaks, taking usernames from the
+// mentioned users' current rows.
+func (s *PostgreSQLUserStore) attachMentions(squeaks []SqueakPost) error {
+	index := map[int]int{}
+	var ids []int
+	for i, squeak := range squeaks {
+		if !squeak.Unavailable {
+			index[squeak.ID] = i
+			ids = append(ids, squeak.ID)
+		}
+	}
+
+	if len(ids) == 0 {
+		return nil
+	}
+
+	query := `SELECT m.squeak_id, m.user_id, u.username, m.start_offset, m.end_offset
+		FROM squeak_mention m JOIN "user" u ON u.id = m.user_id
+		WHERE m.squeak_id = ANY($1) ORDER BY m.squeak_id, m.start_offset`
+
+	rows, err := s.db.Query(query, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var squeakID int
+		var mention Mention
+		if err := rows.Scan(&squeakID, &mention.UserID, &mention.Username, &mention.Start, &mention.End); err != nil {
+			return err
+		}
+		squeak := &squeaks[index[squeakID]]
+		squeak.Mentions = append(squeak.Mentions, mention)
+	}
+
+	return rows.Err()
+}
+
+// attachPollVotes counts the votes for every option of the polls on
+// squeaks.
+func (s *PostgreSQLUserStore) attachPollVotes(squeaks []SqueakPost) error {
+	index := map[int]int{}
+	var ids []int
+	for i, squeak := range squeaks {
+		if squeak.Poll != nil {
+			index[squeak.ID] = i
+			ids = append(ids, squeak.ID)
+		}
+	}
+
+	if len(ids) == 0 {
+		return nil
+	}
+
+	query := `SELECT squeak_id, option, COUNT(*) FROM poll_vote WHERE squeak_id = ANY($1) GROUP BY squeak_id, option`
+
+	rows, err := s.db.Query(query, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var squeakID, option, votes int
+		if err := rows.Scan(&squeakID, &option, &votes); err != nil {
+			return err
+		}
+		poll := squeaks[index[squeakID]].Poll
+		if option < len(poll.Options) {
+			*poll.Options[option].Votes = votes
+			*poll.VoteCount += votes
+		}
+	}
+
+	return rows.Err()
+}
+
+// attachMedia loads the media attached to squeaks in the order they were
+// attached.
+func (s *PostgreSQLUserStore) attachMedia(squeaks []SqueakPost) error {
+	index := map[int]int{}
+	var ids []int
+	for i, squeak := range squeaks {
+		if !squeak.Unavailable {
+			index[squeak.ID] = i
+			ids = append(ids, squeak.ID)
+		}
+	}
+
+	if len(ids) == 0 {
+		return nil
+	}
+
+	media, err := s.queryMedia(`SELECT `+mediaColumns+` FROM media WHERE squeak_id = ANY($1) ORDER BY squeak_id, position`, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+
+	for _, m := range media {
+		squeak := &squeaks[index[*m.SqueakID]]
+		squeak.Media = append(squeak.Media, m)
+	}
+
+	return nil
+}
+
+// queryUsers runs a query selecting id, username and createdAt of users
+// and collects the rows, leaving out email and password.
+func (s *PostgreSQLUserStore) queryUsers(query string, args ...any) ([]User, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	users := []User{}
+	for rows.Next() {
+		var user User
+		if err := rows.Scan(&user.ID, &user.Username, &user.CreatedAt); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+
+	return users, rows.Err()
+}
+
+func (s *PostgreSQLUserStore) AddNotification(name, actor, kind string, squeakID *int) error {
+	user, err := s.GetUserByUsername(name)
+	if err != nil {
+		return fmt.Errorf("AddNotification: %w", err)
+	}
+	from, err := s.GetUserByUsername(actor)
+	if err != nil {
+		return fmt.Errorf("AddNotification: %w", err)
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("AddNotification: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+
+	query := `INSERT INTO notification (user_id, kind, squeak_id, updated_at) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id, kind, COALESCE(squeak_id, 0)) WHERE read_at IS NULL
+		DO UPDATE SET updated_at = EXCLUDED.updated_at RETURNING id`
+
+	var id int
+	if err := tx.QueryRow(query, user.ID, kind, squeakID, now).Scan(&id); err != nil {
+		return fmt.Errorf("AddNotification: %w", err)
+	}
+
+	query = `INSERT INTO notification_actor (notification_id, actor_id, createdAt) VALUES ($1, $2, $3)
+		ON CONFLICT (notification_id, actor_id) DO UPDATE SET createdAt = EXCLUDED.createdAt`
+
+	if _, err := tx.Exec(query, id, from.ID, now); err != nil {
+		return fmt.Errorf("AddNotification: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("AddNotification: %w", err)
+	}
+
+	return nil
+}
+
+func (s *PostgreSQLUserStore) GetNotifications(name string, unread bool, cursor, limit int) ([]Notification, error) {
+	user, err := s.GetUserByUsername(name)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `SELECT n.id, n.kind, n.squeak_id, n.updated_at, n.read_at IS NOT NULL,
+		(SELECT COUNT(*) FROM notification_actor a WHERE a.notification_id = n.id)
+		FROM notification n WHERE n.user_id = $1 AND (NOT $2 OR n.read_at IS NULL)
+		AND ($3 = 0 OR n.id < $3) ORDER BY n.id DESC LIMIT $4`
+
+	rows, err := s.db.Query(query, user.ID, unread, cursor, limit)
+	if err != nil {
+		return nil, fmt.Errorf("GetNotifications: %w", err)
+	}
+
+	defer rows.Close()
+
+	notifications := []Notification{}
+	index := map[int]int{}
+	var ids []int
+	for rows.Next() {
+		var notification Notification
+		if err := rows.Scan(
+			&notification.ID,
+			&notification.Kind,
+			&notification.SqueakID,
+			&notification.UpdatedAt,
+			&notification.Read,
+			&notification.ActorCount,
+		); err != nil {
+			return nil, fmt.Errorf("GetNotifications: %w", err)
+		}
+		notification.Actors = []PublicUser{}
+		index[notification.ID] = len(notifications)
+		ids = append(ids, notification.ID)
+		notifications = append(notifications, notification)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("GetNotifications: %w", err)
+	}
+
+	if len(ids) == 0 {
+		return notifications, nil
+	}
+
+	query = `SELECT notification_id, id, username, createdAt FROM (
+			SELECT a.notification_id, u.id, u.username, u.createdAt,
+			ROW_NUMBER() OVER (PARTITION BY a.notification_id ORDER BY a.createdAt DESC) AS position
+			FROM notification_actor a JOIN "user" u ON u.id = a.actor_id
+			WHERE a.notification_id = ANY($1)
+		) actors WHERE position <= $2 ORDER BY notification_id, position`
+
+	actors, err := s.db.Query(query, pq.Array(ids), maxNotificationActors)
+	if err != nil {
+		return nil, fmt.Errorf("GetNotifications: %w", err)
+	}
+
+	defer actors.Close()
+
+	for actors.Next() {
+		var notificationID int
+		var actor PublicUser
+		if err := actors.Scan(&notificationID, &actor.ID, &actor.Username, &actor.CreatedAt); err != nil {
+			return nil, fmt.Errorf("GetNotifications: %w", err)
+		}
+		notification := &notifications[index[notificationID]]
+		notification.Actors = append(notification.Actors, actor)
+	}
+	if err := actors.Err(); err != nil {
+		return nil, fmt.Errorf("GetNotifications: %w", err)
+	}
+
+	return notifications, nil
+}
+
+func (s *PostgreSQLUserStore) MarkNotificationsRead(name string, ids []int) error {
+	user, err := s.GetUserByUsername(name)
+	if err != nil {
+		return fmt.Errorf("MarkNotificationsRead: %w", err)
+	}
+	if ids == nil {
+		ids = []int{}
+	}
+
+	query := `UPDATE notification SET read_at = $2 WHERE user_id = $1 AND read_at IS NULL
+		AND (cardinality($3::int[]) = 0 OR id = ANY($3))`
+
+	if _, err := s.db.Exec(query, user.ID, time.Now(), pq.Array(ids)); err != nil {
+		return fmt.Errorf("MarkNotificationsRead: %w", err)
+	}
+
+	return nil
+}
+
+func (s *PostgreSQLUserStore) GetSqueaksAfter(names []string, after, limit int) ([]SqueakPost, error) {
+	query := `SELECT ` + squeakColumns + ` FROM squeak s JOIN "user" u ON u.id = s.user_id
+		WHERE u.username = ANY($1) AND s.id > $2 AND s.deleted_at IS NULL ORDER BY s.id LIMIT $3`
+
+	squeaks, err := s.querySqueaks(query, pq.Array(names), after, limit)
+	if err != nil {
+		return nil, fmt.Errorf("GetSqueaksAfter: %w", err)
+	}
+
+	return squeaks, nil
+}
+
+func (s *PostgreSQLUserStore) BlockUser(blocker, blocked string) error {
+	from, err := s.GetUserByUsername(blocker)
+	if err != nil {
+		return fmt.Errorf("BlockUser: %w", err)
+	}
+	to, err := s.GetUserByUsername(blocked)
+	if err != nil {
+		return fmt.Errorf("BlockUser: %w", err)
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("BlockUser: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `INSERT INTO block (blocker_id, blocked_id, createdAt) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING`
+
+	if _, err := tx.Exec(query, from.ID, to.ID, time.Now()); err != nil {
+		return fmt.Errorf("BlockUser: %w", err)
+	}
+
+	if err := s.unfollowTx(tx, from.ID, to.ID); err != nil {
+		return fmt.Errorf("BlockUser: %w", err)
+	}
+	if err := s.unfollowTx(tx, to.ID, from.ID); err != nil {
+		return fmt.Errorf("BlockUser: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("BlockUser: %w", err)
+	}
+
+	return nil
+}
+
+func (s *PostgreSQLUserStore) UnblockUser(blocker, blocked string) error {
+	from, err := s.GetUserByUsername(blocker)
+	if err != nil {
+		return fmt.Errorf("UnblockUser: %w", err)
+	}
+	to, err := s.GetUserByUsername(blocked)
+	if err != nil {
+		return fmt.Errorf("UnblockUser: %w", err)
+	}
+
+	if _, err := s.db.Exec(`DELETE FROM block WHERE blocker_id = $1 AND blocked_id = $2`, from.ID, to.ID); err != nil {
+		return fmt.Errorf("UnblockUser: %w", err)
+	}
+
+	return nil
+}
+
+func (s *PostgreSQLUserStore) IsBlocked(name, other string) (bool, error) {
+	query := `SELECT EXISTS (SELECT 1 FROM block b
+		JOIN "user" a ON a.id = b.blocker_id JOIN "user" z ON z.id = b.blocked_id
+		WHERE (a.username = $1 AND z.username = $2) OR (a.username = $2 AND z.username = $1))`
+
+	var blocked bool
+	if err := s.db.QueryRow(query, name, other).Scan(&blocked); err != nil {
+		return false, fmt.Errorf("IsBlocked: %w", err)
+	}
+
+	return blocked, nil
+}
+
+func (s *PostgreSQLUserStore) CreateDirectConversation(creator string, participants []string) (int, error) {
+	var ids []int
+	for _, name := range append([]string{creator}, participants...) {
+		user, err := s.GetUserByUsername(name)
+		if err != nil {
+			return 0, fmt.Errorf("CreateDirectConversation: %w", err)
+		}
+		ids = append(ids, user.ID)
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("CreateDirectConversation: %w", err)
+	}
+	defer tx.Rollback()
+
+	var id int
+
+	if len(ids) == 2 {
+		query := `SELECT conversation_id FROM conversation_participant GROUP BY conversation_id
+			HAVING COUNT(*) = 2 AND bool_and(user_id = ANY($1)) LIMIT 1`
+
+		err := tx.QueryRow(query, pq.Array(ids)).Scan(&id)
+		if err == nil {
+			return id, nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return 0, fmt.Errorf("CreateDirectConversation: %w", err)
+		}
+	}
+
+	if err := tx.QueryRow(`INSERT INTO conversation (createdAt) VALUES ($1) RETURNING id`, time.Now()).Scan(&id); err != nil {
+		return 0, fmt.Errorf("CreateDirectConversation: %w", err)
+	}
+
+	for _, userID := range ids {
+		if _, err := tx.Exec(`INSERT INTO conversation_participant (conversation_id, user_id) VALUES ($1, $2)`, id, userID); err != nil {
+			return 0, fmt.Errorf("CreateDirectConversation: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("CreateDirectConversation: %w", err)
+	}
+
+	return id, nil
+}
+
+func (s *PostgreSQLUserStore) GetDirectConversation(id int) (*DirectConversation, error) {
+	conversations, err := s.queryDirectConversations(`SELECT id, createdAt, 0 FROM conversation WHERE id = $1`, id)
+	if err != nil {
+		return nil, fmt.Errorf("GetDirectConversation: %w", err)
+	}
+	if len(conversations) == 0 {
+		return nil, fmt.Errorf("GetDirectConversation: %w", ErrConversationNotFound)
+	}
+
+	return &conversations[0], nil
+}
+
+func (s *PostgreSQLUserStore) GetDirectConversations(name string) ([]DirectConversation, error) {
+	user, err := s.GetUserByUsername(name)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `SELECT c.id, c.createdAt,
+		(SELECT COUNT(*) FROM message m WHERE m.conversation_id = c.id AND m.id > p.last_read_id AND m.sender_id <> p.user_id)
+		FROM conversation c JOIN conversation_participant p ON p.conversation_id = c.id
+		WHERE p.user_id = $1
+		ORDER BY COALESCE((SELECT MAX(id) FROM message m WHERE m.conversation_id = c.id), 0) DESC, c.id DESC`
+
+	conversations, err := s.queryDirectConversations(query, user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("GetDirectConversations: %w", err)
+	}
+
+	return conversations, nil
+}
+
+// queryDirectConversations runs a query selecting conversation id,
+// createdAt and unread count, and loads their participants and last
+// messages.
+func (s *PostgreSQLUserStore) queryDirectConversations(query string, args ...any) ([]DirectConversation, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	conversations := []DirectConversation{}
+	index := map[int]int{}
+	var ids []int
+	for rows.Next() {
+		var conversation DirectConversation
+		if err := rows.Scan(&conversation.ID, &conversation.CreatedAt, &conversation.UnreadCount); err != nil {
+			return nil, err
+		}
+		index[conversation.ID] = len(conversations)
+		ids = append(ids, conversation.ID)
+		conversations = append(conversations, conversation)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(ids) == 0 {
+		return conversations, nil
+	}
+
+	query = `SELECT p.conversation_id, p.user_id, u.username, p.last_read_id
+		FROM conversation_participant p JOIN "user" u ON u.id = p.user_id
+		WHERE p.conversation_id = ANY($1) ORDER BY p.conversation_id, u.username`
+
+	participants, err := s.db.Query(query, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+
+	defer participants.Close()
+
+	for participants.Next() {
+		var conversationID int
+		var participant Participant
+		if err := participants.Scan(&conversationID, &participant.UserID, &participant.Username, &participant.LastReadID); err != nil {
+			return nil, err
+		}
+		conversation := &conversations[index[conversationID]]
+		conversation.Participants = append(conversation.Participants, participant)
+	}
+	if err := participants.Err(); err != nil {
+		return nil, err
+	}
+
+	query = `SELECT DISTINCT ON (m.conversation_id) ` + messageColumns + `
+		FROM message m JOIN "user" u ON u.id = m.sender_id
+		WHERE m.conversation_id = ANY($1) ORDER BY m.conversation_id, m.id DESC`
+
+	messages, err := s.queryDirectMessages(query, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, message := range messages {
+		conversations[index[message.ConversationID]].LastMessage = &message
+	}
+
+	return conversations, nil
+}
+
+const messageColumns = `m.id, m.conversation_id, m.sender_id, u.username, m.text, m.createdAt`
+
+func (s *PostgreSQLUserStore) queryDirectMessages(query string, args ...any) ([]DirectMessage, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	messages := []DirectMessage{}
+	for rows.Next() {
+		var message DirectMessage
+		if err := rows.Scan(
+			&message.ID,
+			&message.ConversationID,
+			&message.SenderID,
+			&message.Sender,
+			&message.Text,
+			&message.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		messages = append(messages, message)
+	}
+
+	return messages, rows.Err()
+}
+
+func (s *PostgreSQLUserStore) PostDirectMessage(name string, conversationID int, text string) (int, error) {
+	user, err := s.GetUserByUsername(name)
+	if err != nil {
+		return 0, fmt.Errorf("PostDirectMessage: %w", err)
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("PostDirectMessage: %w", err)
+	}
+	defer tx.Rollback()
+
+	var id int
+
+	query := `INSERT INTO message (conversation_id, sender_id, text, createdAt) VALUES ($1, $2, $3, $4) RETURNING id`
+
+	if err := tx.QueryRow(query, conversationID, user.ID, text, time.Now()).Scan(&id); err != nil {
+		return 0, fmt.Errorf("PostDirectMessage: %w", err)
+	}
+
+	query = `UPDATE conversation_participant SET last_read_id = $3 WHERE conversation_id = $1 AND user_id = $2`
+
+	if _, err := tx.Exec(query, conversationID, user.ID, id); err != nil {
+		return 0, fmt.Errorf("PostDirectMessage: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("PostDirectMessage: %w", err)
+	}
+
+	return id, nil
+}
+
+func (s *PostgreSQLUserStore) GetDirectMessages(conversationID, cursor, limit int) ([]DirectMessage, error) {
+	query := `SELECT ` + messageColumns + ` FROM message m JOIN "user" u ON u.id = m.sender_id
+		WHERE m.conversation_id = $1 AND ($2 = 0 OR m.id < $2) ORDER BY m.id DESC LIMIT $3`
+
+	messages, err := s.queryDirectMessages(query, conversationID, cursor, limit)
+	if err != nil {
+		return nil, fmt.Errorf("GetDirectMessages: %w", err)
+	}
+
+	return messages, nil
+}
+
+func (s *PostgreSQLUserStore) MarkDirectMessagesRead(name string, conversationID, messageID int) error {
+	user, err := s.GetUserByUsername(name)
+	if err != nil {
+		return fmt.Errorf("MarkDirectMessagesRead: %w", err)
+	}
+
+	query := `UPDATE conversation_participant SET last_read_id = GREATEST(last_read_id,
+			COALESCE((SELECT MAX(id) FROM message WHERE conversation_id = $1 AND id <= $3), 0))
+		WHERE conversation_id = $1 AND user_id = $2`
+
+	if _, err := s.db.Exec(query, conversationID, user.ID, messageID); err != nil {
+		return fmt.Errorf("MarkDirectMessagesRead: %w", err)
+	}
+
+	return nil
+}
+
+func (s *PostgreSQLUserStore) GetBlockedUsers(name string) ([]User, error) {
+	query := `SELECT u.id, u.username, u.createdAt FROM block b
+		JOIN "user" u ON u.id = b.blocked_id JOIN "user" me ON me.id = b.blocker_id
+		WHERE me.username = $1 ORDER BY b.createdAt DESC`
+
+	users, err := s.queryUsers(query, name)
+	if err != nil {
+		return nil, fmt.Errorf("GetBlockedUsers: %w", err)
+	}
+
+	return users, nil
+}
+
+func (s *PostgreSQLUserStore) MuteUser(muter, muted string) error {
+	from, err := s.GetUserByUsername(muter)
+	if err != nil {
+		return fmt.Errorf("MuteUser: %w", err)
+	}
+	to, err := s.GetUserByUsername(muted)
+	if err != nil {
+		return fmt.Errorf("MuteUser: %w", err)
+	}
+
+	query := `INSERT INTO mute (muter_id, muted_id, createdAt) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING`
+
+	if _, err := s.db.Exec(query, from.ID, to.ID, time.Now()); err != nil {
+		return fmt.Errorf("MuteUser: %w", err)
+	}
+
+	return nil
+}
+
+func (s *PostgreSQLUserStore) UnmuteUser(muter, muted string) error {
+	from, err := s.GetUserByUsername(muter)
+	if err != nil {
+		return fmt.Errorf("UnmuteUser: %w", err)
+	}
+	to, err := s.GetUserByUsername(muted)
+	if err != nil {
+		return fmt.Errorf("UnmuteUser: %w", err)
+	}
+
+	if _, err := s.db.Exec(`DELETE FROM mute WHERE muter_id = $1 AND muted_id = $2`, from.ID, to.ID); err != nil {
+		return fmt.Errorf("UnmuteUser: %w", err)
+	}
+
+	return nil
+}
+
+func (s *PostgreSQLUserStore) GetMutedUsers(name string) ([]User, error) {
+	query := `SELECT u.id, u.username, u.createdAt FROM mute m
+		JOIN "user" u ON u.id = m.muted_id JOIN "user" me ON me.id = m.muter_id
+		WHERE me.username = $1 ORDER BY m.createdAt DESC`
+
+	users, err := s.queryUsers(query, name)
+	if err != nil {
+		return nil, fmt.Errorf("GetMutedUsers: %w", err)
+	}
+
+	return users, nil
+}
+
+func (s *PostgreSQLUserStore) GetHiddenUsers(name string) (map[int]bool, error) {
+	user, err := s.GetUserByUsername(name)
+	if err != nil {
+		return nil, fmt.Errorf("GetHiddenUsers: %w", err)
+	}
+
+	query := `SELECT blocked_id FROM block WHERE blocker_id = $1
+		UNION SELECT blocker_id FROM block WHERE blocked_id = $1
+		UNION SELECT muted_id FROM mute WHERE muter_id = $1`
+
+	hidden, err := s.queryIDSet(query, user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("GetHiddenUsers: %w", err)
+	}
+
+	return hidden, nil
+}
+
+// prefixQuery turns the words of query into a tsquery matching usernames
+// that contain words starting with each of them.
+func prefixQuery(query string) string {
+	terms := searchTerms(query)
+	for i, term := range terms {
+		terms[i] = term + ":*"
+	}
+	return strings.Join(terms, " & ")
+}
+
+func (s *PostgreSQLUserStore) SearchSqueaks(query string, offset, limit int) ([]SqueakPost, error) {
+	statement := `SELECT ` + squeakColumns + ` FROM squeak s JOIN "user" u ON u.id = s.user_id,
+		websearch_to_tsquery('english', $1) q
+		WHERE s.search_vector @@ q AND s.deleted_at IS NULL
+		ORDER BY ts_rank(s.search_vector, q) DESC, s.id DESC OFFSET $2 LIMIT $3`
+
+	squeaks, err := s.querySqueaks(statement, query, offset, limit)
+	if err != nil {
+		return nil, fmt.Errorf("SearchSqueaks: %w", err)
+	}
+
+	return squeaks, nil
+}
+
+func (s *PostgreSQLUserStore) SearchUsers(query string, offset, limit int) ([]User, error) {
+	statement := `SELECT u.id, u.username, u.createdAt FROM "user" u, to_tsquery('simple', $1) q
+		WHERE to_tsvector('simple', u.username) @@ q
+		ORDER BY ts_rank(to_tsvector('simple', u.username), q) DESC, length(u.username), u.id OFFSET $2 LIMIT $3`
+
+	users, err := s.queryUsers(statement, prefixQuery(query), offset, limit)
+	if err != nil {
+		return nil, fmt.Errorf("SearchUsers: %w", err)
+	}
+
+	return users, nil
+}
+
+func (s *PostgreSQLUserStore) BookmarkSqueak(name string, id int) error {
+	user, err := s.GetUserByUsername(name)
+	if err != nil {
+		return fmt.Errorf("BookmarkSqueak: %w", err)
+	}
+	if _, err := s.GetSqueak(id); err != nil {
+		return fmt.Errorf("BookmarkSqueak: %w", err)
+	}
+
+	query := `INSERT INTO bookmark (user_id, squeak_id, createdAt) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING`
+
+	if _, err := s.db.Exec(query, user.ID, id, time.Now()); err != nil {
+		return fmt.Errorf("BookmarkSqueak: %w", err)
+	}
+
+	return nil
+}
+
+func (s *PostgreSQLUserStore) UnbookmarkSqueak(name string, id int) error {
+	user, err := s.GetUserByUsername(name)
+	if err != nil {
+		return fmt.Errorf("UnbookmarkSqueak: %w", err)
+	}
+
+	if _, err := s.db.Exec(`DELETE FROM bookmark WHERE user_id = $1 AND squeak_id = $2`, user.ID, id); err != nil {
+		return fmt.Errorf("UnbookmarkSqueak: %w", err)
+	}
+
+	return nil
+}
+
+func (s *PostgreSQLUserStore) GetBookmarks(name string, cursor, limit int) ([]Bookmark, error) {
+	user, err := s.GetUserByUsername(name)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `SELECT id, squeak_id, createdAt FROM bookmark
+		WHERE user_id = $1 AND ($2 = 0 OR id < $2) ORDER BY id DESC LIMIT $3`
+
+	rows, err := s.db.Query(query, user.ID, cursor, limit)
+	if err != nil {
+		return nil, fmt.Errorf("GetBookmarks: %w", err)
+	}
+
+	defer rows.Close()
+
+	bookmarks := []Bookmark{}
+	var ids []int
+	for rows.Next() {
+		var bookmark Bookmark
+		if err := rows.Scan(&bookmark.ID, &bookmark.Squeak.ID, &bookmark.CreatedAt); err != nil {
+			return nil, fmt.Errorf("GetBookmarks: %w", err)
+		}
+		bookmarks = append(bookmarks, bookmark)
+		ids = append(ids, bookmark.Squeak.ID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("GetBookmarks: %w", err)
+	}
+
+	if len(ids) == 0 {
+		return bookmarks, nil
+	}
+
+	query = `SELECT ` + squeakColumns + ` FROM squeak s JOIN "user" u ON u.id = s.user_id WHERE s.id = ANY($1)`
+
+	squeaks, err := s.querySqueaks(query, pq.Array(ids))
+	if err != nil {
+		return nil, fmt.Errorf("GetBookmarks: %w", err)
+	}
+
+	byID := make(map[int]SqueakPost, len(squeaks))
+	for _, squeak := range squeaks {
+		byID[squeak.ID] = squeak
+	}
+	for i := range bookmarks {
+		bookmarks[i].Squeak = byID[bookmarks[i].Squeak.ID]
+	}
+
+	return bookmarks, nil
+}
+
+func (s *PostgreSQLUserStore) CreateList(owner, name string, private bool) (int, error) {
+	user, err := s.GetUserByUsername(owner)
+	if err != nil {
+		return 0, fmt.Errorf("CreateList: %w", err)
+	}
+
+	query := `INSERT INTO list (user_id, name, private, createdAt) VALUES ($1, $2, $3, $4) RETURNING id`
+
+	var id int
+	if err := s.db.QueryRow(query, user.ID, name, private, time.Now()).Scan(&id); err != nil {
+		return 0, fmt.Errorf("CreateList: %w", err)
+	}
+
+	return id, nil
+}
+
+// listColumns lists the columns queryLists scans, selected from list l
+// joined with its owner u.
+const listColumns = `l.id, l.user_id, u.username, l.name, l.private,
+	(SELECT COUNT(*) FROM list_member m WHERE m.list_id = l.id), l.createdAt`
+
+func (s *PostgreSQLUserStore) queryLists(query string, args ...any) ([]List, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	lists := []List{}
+	for rows.Next() {
+		var list List
+		if err := rows.Scan(&list.ID, &list.OwnerID, &list.Owner, &list.Name, &list.Private, &list.MemberCount, &list.CreatedAt); err != nil {
+			return nil, err
+		}
+		lists = append(lists, list)
+	}
+
+	return lists, rows.Err()
+}
+
+func (s *PostgreSQLUserStore) GetList(id int) (*List, error) {
+	lists, err := s.queryLists(`SELECT `+listColumns+` FROM list l JOIN "user" u ON u.id = l.user_id WHERE l.id = $1`, id)
+	if err != nil {
+		return nil, fmt.Errorf("GetList: %w", err)
+	}
+	if len(lists) == 0 {
+		return nil, fmt.Errorf("GetList: %w", ErrListNotFound)
+	}
+
+	return &lists[0], nil
+}
+
+func (s *PostgreSQLUserStore) GetLists(owner string, includePrivate bool) ([]List, error) {
+	user, err := s.GetUserByUsername(owner)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `SELECT ` + listColumns + ` FROM list l JOIN "user" u ON u.id = l.user_id
+		WHERE l.user_id = $1 AND ($2 OR NOT l.private) ORDER BY l.id`
+
+	lists, err := s.queryLists(query, user.ID, includePrivate)
+	if err != nil {
+		return nil, fmt.Errorf("GetLists: %w", err)
+	}
+
+	return lists, nil
+}
+
+func (s *PostgreSQLUserStore) UpdateList(id int, name string, private bool) error {
+	result, err := s.db.Exec(`UPDATE list SET name = $2, private = $3 WHERE id = $1`, id, name, private)
+	if err != nil {
+		return fmt.Errorf("UpdateList: %w", err)
+	}
+
+	if updated, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("UpdateList: %w", err)
+	} else if updated == 0 {
+		return fmt.Errorf("UpdateList: %w", ErrListNotFound)
+	}
+
+	return nil
+}
+
+// DeleteList removes the list, its members going with it through the
+// cascading foreign key.
+func (s *PostgreSQLUserStore) DeleteList(id int) error {
+	if _, err := s.db.Exec(`DELETE FROM list WHERE id = $1`, id); err != nil {
+		return fmt.Errorf("DeleteList: %w", err)
+	}
+
+	return nil
+}
+
+func (s *PostgreSQLUserStore) AddListMember(id int, name string) error {
+	user, err := s.GetUserByUsername(name)
+	if err != nil {
+		return fmt.Errorf("AddListMember: %w", err)
+	}
+
+	query := `INSERT INTO list_member (list_id, user_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`
+
+	if _, err := s.db.Exec(query, id, user.ID); err != nil {
+		return fmt.Errorf("AddListMember: %w", err)
+	}
+
+	return nil
+}
+
+func (s *PostgreSQLUserStore) RemoveListMember(id int, name string) error {
+	user, err := s.GetUserByUsername(name)
+	if err != nil {
+		return fmt.Errorf("RemoveListMember: %w", err)
+	}
+
+	if _, err := s.db.Exec(`DELETE FROM list_member WHERE list_id = $1 AND user_id = $2`, id, user.ID); err != nil {
+		return fmt.Errorf("RemoveListMember: %w", err)
+	}
+
+	return nil
+}
+
+func (s *PostgreSQLUserStore) GetListMembers(id int) ([]User, error) {
+	query := `SELECT u.id, u.username, u.createdAt FROM list_member m JOIN "user" u ON u.id = m.user_id
+		WHERE m.list_id = $1 ORDER BY u.username`
+
+	members, err := s.queryUsers(query, id)
+	if err != nil {
+		return nil, fmt.Errorf("GetListMembers: %w", err)
+	}
+
+	return members, nil
+}
+
+func (s *PostgreSQLUserStore) GetListTimeline(id, cursor, limit int) ([]SqueakPost, error) {
+	query := `SELECT ` + squeakColumns + ` FROM squeak s JOIN "user" u ON u.id = s.user_id
+		WHERE s.user_id IN (SELECT user_id FROM list_member WHERE list_id = $1)
+		AND ($2 = 0 OR s.id < $2) AND s.deleted_at IS NULL ORDER BY s.id DESC LIMIT $3`
+
+	squeaks, err := s.querySqueaks(query, id, cursor, limit)
+	if err != nil {
+		return nil, fmt.Errorf("GetListTimeline: %w", err)
+	}
+
+	return squeaks, nil
+}
+
+func (s *PostgreSQLUserStore) VoteInPoll(name string, id, option int) error {
+	user, err := s.GetUserByUsername(name)
+	if err != nil {
+		return fmt.Errorf("VoteInPoll: %w", err)
+	}
+
+	query := `INSERT INTO poll_vote (squeak_id, user_id, option) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING`
+
+	result, err := s.db.Exec(query, id, user.ID, option)
+	if err != nil {
+		return fmt.Errorf("VoteInPoll: %w", err)
+	}
+
+	if voted, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("VoteInPoll: %w", err)
+	} else if voted == 0 {
+		return fmt.Errorf("VoteInPoll: %w", ErrAlreadyVoted)
+	}
+
+	return nil
+}
+
+func (s *PostgreSQLUserStore) GetPollVotes(name string, ids []int) (map[int]int, error) {
+	user, err := s.GetUserByUsername(name)
+	if err != nil {
+		return nil, fmt.Errorf("GetPollVotes: %w", err)
+	}
+
+	rows, err := s.db.Query(`SELECT squeak_id, option FROM poll_vote WHERE user_id = $1 AND squeak_id = ANY($2)`, user.ID, pq.Array(ids))
+	if err != nil {
+		return nil, fmt.Errorf("GetPollVotes: %w", err)
+	}
+
+	defer rows.Close()
+
+	votes := map[int]int{}
+	for rows.Next() {
+		var id, option int
+		if err := rows.Scan(&id, &option); err != nil {
+			return nil, fmt.Errorf("GetPollVotes: %w", err)
+		}
+		votes[id] = option
+	}
+
+	return votes, rows.Err()
+}
+
+// mediaColumns lists the columns queryMedia scans.
+const mediaColumns = `id, user_id, squeak_id, content_type, width, height, size, createdAt, blob_key`
+
+func (s *PostgreSQLUserStore) queryMedia(query string, args ...any) ([]Media, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	media := []Media{}
+	for rows.Next() {
+		var m Media
+		if err := rows.Scan(&m.ID, &m.OwnerID, &m.SqueakID, &m.ContentType, &m.Width, &m.Height, &m.Size, &m.CreatedAt, &m.Key); err != nil {
+			return nil, err
+		}
+		media = append(media, m)
+	}
+
+	return media, rows.Err()
+}
+
+func (s *PostgreSQLUserStore) CreateMedia(owner string, media Media) (int, error) {
+	user, err := s.GetUserByUsername(owner)
+	if err != nil {
+		return 0, fmt.Errorf("CreateMedia: %w", err)
+	}
+
+	query := `INSERT INTO media (user_id, blob_key, content_type, width, height, size, createdAt)
+		VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id`
+
+	var id int
+	err = s.db.QueryRow(query, user.ID, media.Key, media.ContentType, media.Width, media.Height, media.Size, time.Now()).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("CreateMedia: %w", err)
+	}
+
+	return id, nil
+}
+
+func (s *PostgreSQLUserStore) GetMedia(id int) (*Media, error) {
+	media, err := s.queryMedia(`SELECT `+mediaColumns+` FROM media WHERE id = $1`, id)
+	if err != nil {
+		return nil, fmt.Errorf("GetMedia: %w", err)
+	}
+	if len(media) == 0 {
+		return nil, fmt.Errorf("GetMedia: %w", ErrMediaNotFound)
+	}
+
+	return &media[0], nil
+}
+
+// utcTime converts t to UTC for the TIMESTAMP columns, which drop the zone.
+func utcTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	utc := t.UTC()
+	return &utc
+}
+
+func (s *PostgreSQLUserStore) CreateDraft(name, text string, publishAt *time.Time) (int, error) {
+	user, err := s.GetUserByUsername(name)
+	if err != nil {
+		return 0, fmt.Errorf("CreateDraft: %w", err)
+	}
+
+	query := `INSERT INTO draft (user_id, text, publish_at, createdAt, updatedAt) VALUES ($1, $2, $3, $4, $4) RETURNING id`
+
+	var id int
+	if err := s.db.QueryRow(query, user.ID, text, utcTime(publishAt), time.Now()).Scan(&id); err != nil {
+		return 0, fmt.Errorf("CreateDraft: %w", err)
+	}
+
+	return id, nil
+}
+
+func (s *PostgreSQLUserStore) queryDrafts(query string, args ...any) ([]Draft, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	drafts := []Draft{}
+	for rows.Next() {
+		var draft Draft
+		if err := rows.Scan(&draft.ID, &draft.UserID, &draft.Text, &draft.PublishAt, &draft.CreatedAt, &draft.UpdatedAt); err != nil {
+			return nil, err
+		}
+		drafts = append(drafts, draft)
+	}
+
+	return drafts, rows.Err()
+}
+
+func (s *PostgreSQLUserStore) GetDraft(id int) (*Draft, error) {
+	drafts, err := s.queryDrafts(`SELECT id, user_id, text, publish_at, createdAt, updatedAt FROM draft WHERE id = $1`, id)
+	if err != nil {
+		return nil, fmt.Errorf("GetDraft: %w", err)
+	}
+	if len(drafts) == 0 {
+		return nil, fmt.Errorf("GetDraft: %w", ErrDraftNotFound)
+	}
+
+	return &drafts[0], nil
+}
+
+func (s *PostgreSQLUserStore) GetDrafts(name string) ([]Draft, error) {
+	user, err := s.GetUserByUsername(name)
+	if err != nil {
+		return nil, err
+	}
+
+	drafts, err := s.queryDrafts(`SELECT id, user_id, text, publish_at, createdAt, updatedAt FROM draft WHERE user_id = $1 ORDER BY id`, user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("GetDrafts: %w", err)
+	}
+
+	return drafts, nil
+}
+
+func (s *PostgreSQLUserStore) UpdateDraft(id int, text string, publishAt *time.Time) error {
+	result, err := s.db.Exec(`UPDATE draft SET text = $2, publish_at = $3, updatedAt = $4 WHERE id = $1`, id, text, utcTime(publishAt), time.Now())
+	if err != nil {
+		return fmt.Errorf("UpdateDraft: %w", err)
+	}
+
+	if updated, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("UpdateDraft: %w", err)
+	} else if updated == 0 {
+		return fmt.Errorf("UpdateDraft: %w", ErrDraftNotFound)
+	}
+
+	return nil
+}
+
+func (s *PostgreSQLUserStore) DeleteDraft(id int) error {
+	if _, err := s.db.Exec(`DELETE FROM draft WHERE id = $1`, id); err != nil {
+		return fmt.Errorf("DeleteDraft: %w", err)
+	}
+
+	return nil
+}
+
+// PublishDueDrafts locks the due drafts with FOR UPDATE SKIP LOCKED, so a
+// scheduler running in another server skips the ones this one is
+// publishing, and deletes them in the transaction posting their squeaks.
+func (s *PostgreSQLUserStore) PublishDueDrafts(now time.Time, limit int) ([]int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("PublishDueDrafts: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `SELECT id, user_id, text FROM draft WHERE publish_at <= $1
+		ORDER BY publish_at, id LIMIT $2 FOR UPDATE SKIP LOCKED`
+
+	rows, err := tx.Query(query, now.UTC(), limit)
+	if err != nil {
+		return nil, fmt.Errorf("PublishDueDrafts: %w", err)
+	}
+
+	var due []Draft
+	for rows.Next() {
+		var draft Draft
+		if err := rows.Scan(&draft.ID, &draft.UserID, &draft.Text); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("PublishDueDrafts: %w", err)
+		}
+		due = append(due, draft)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("PublishDueDrafts: %w", err)
+	}
+
+	ids := []int{}
+	for _, draft := range due {
+		id, err := s.insertSqueakTx(tx, SqueakPost{UserID: draft.UserID, Text: draft.Text, Kind: KindSqueak})
+		if err != nil {
+			return nil, fmt.Errorf("PublishDueDrafts: %w", err)
+		}
+
+		if _, err := tx.Exec(`DELETE FROM draft WHERE id = $1`, draft.ID); err != nil {
+			return nil, fmt.Errorf("PublishDueDrafts: %w", err)
+		}
+
+		ids = append(ids, id)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("PublishDueDrafts: %w", err)
+	}
+
+	return ids, nil
+}
+
+func (s *PostgreSQLUserStore) GetPreferences(name string) (*Preferences, error) {
+	user, err := s.GetUserByUsername(name)
+	if err != nil {
+		return nil, fmt.Errorf("GetPreferences: %w", err)
+	}
+
+	preferences := new(Preferences)
+	err = s.db.QueryRow(`SELECT expand_content_warnings FROM user_preference WHERE user_id = $1`, user.ID).Scan(&preferences.ExpandContentWarnings)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("GetPreferences: %w", err)
+	}
+
+	return preferences, nil
+}
+
+func (s *PostgreSQLUserStore) UpdatePreferences(name string, preferences Preferences) error {
+	user, err := s.GetUserByUsername(name)
+	if err != nil {
+		return fmt.Errorf("UpdatePreferences: %w", err)
+	}
+
+	query := `INSERT INTO user_preference (user_id, expand_content_warnings) VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET expand_content_warnings = EXCLUDED.expand_content_warnings`
+
+	if _, err := s.db.Exec(query, user.ID, preferences.ExpandContentWarnings); err != nil {
+		return fmt.Errorf("UpdatePreferences: %w", err)
+	}
+
+	return nil
+}
+
+func (s *PostgreSQLUserStore) GetProfile(name string) (*Profile, error) {
+	query := `SELECT id, username, createdAt, display_name, bio, location, website, avatar_id, header_id,
+			pinned_squeak_id, protected, follower_count, following_count, squeak_count
+		FROM "user" WHERE username = $1`
+
+	profile := new(Profile)
+	err := s.db.QueryRow(query, name).Scan(&profile.ID, &profile.Username, &profile.CreatedAt, &profile.DisplayName,
+		&profile.Bio, &profile.Location, &profile.Website, &profile.AvatarID, &profile.HeaderID,
+		&profile.PinnedSqueakID, &profile.Protected, &profile.FollowerCount, &profile.FollowingCount, &profile.SqueakCount)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("no user with that username (%s) found", name)
+		}
+		return nil, fmt.Errorf("GetProfile: %w", err)
+	}
+
+	return profile, nil
+}
+
+// UpdateProfile accepts the pending follow requests of an account that stops
+// being protected in the same transaction, so none are left behind that no
+// one can answer.
+func (s *PostgreSQLUserStore) UpdateProfile(name string, user User) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("UpdateProfile: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE "user" SET display_name = $2, bio = $3, location = $4, website = $5, avatar_id = $6, header_id = $7,
+			protected = $8
+		WHERE username = $1 RETURNING id`
+
+	var id int
+	err = tx.QueryRow(query, name, user.DisplayName, user.Bio, user.Location, user.Website, user.AvatarID, user.HeaderID,
+		user.Protected).Scan(&id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("no user with that username (%s) found", name)
+		}
+		return fmt.Errorf("UpdateProfile: %w", err)
+	}
+
+	if !user.Protected {
+		rows, err := tx.Query(`DELETE FROM follow_request WHERE followee_id = $1 RETURNING follower_id`, id)
+		if err != nil {
+			return fmt.Errorf("UpdateProfile: %w", err)
+		}
+
+		var followers []int
+		for rows.Next() {
+			var follower int
+			if err := rows.Scan(&follower); err != nil {
+				rows.Close()
+				return fmt.Errorf("UpdateProfile: %w", err)
+			}
+			followers = append(followers, follower)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("UpdateProfile: %w", err)
+		}
+
+		for _, follower := range followers {
+			if err := s.followTx(tx, follower, id); err != nil {
+				return fmt.Errorf("UpdateProfile: %w", err)
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("UpdateProfile: %w", err)
+	}
+
+	return nil
+}
+
+// PinSqueak pins squeak id in the same statement that checks it is by name
+// and not deleted.
+func (s *PostgreSQLUserStore) PinSqueak(name string, id int) error {
+	query := `UPDATE "user" u SET pinned_squeak_id = s.id FROM squeak s
+		WHERE u.username = $1 AND s.id = $2 AND s.user_id = u.id AND s.deleted_at IS NULL`
+
+	result, err := s.db.Exec(query, name, id)
+	if err != nil {
+		return fmt.Errorf("PinSqueak: %w", err)
+	}
+
+	if pinned, _ := result.RowsAffected(); pinned == 0 {
+		return ErrSqueakNotFound
+	}
+
+	return nil
+}
+
+func (s *PostgreSQLUserStore) UnpinSqueak(name string, id int) error {
+	query := `UPDATE "user" SET pinned_squeak_id = NULL WHERE username = $1 AND pinned_squeak_id = $2`
+
+	if _, err := s.db.Exec(query, name, id); err != nil {
+		return fmt.Errorf("UnpinSqueak: %w", err)
+	}
+
+	return nil
+}
+
+// RequestFollow records that follower asks to follow followee, unless they
+// follow them already.
+func (s *PostgreSQLUserStore) RequestFollow(follower, followee string) (bool, error) {
+	from, err := s.GetUserByUsername(follower)
+	if err != nil {
+		return false, fmt.Errorf("RequestFollow: %w", err)
+	}
+	to, err := s.GetUserByUsername(followee)
+	if err != nil {
+		return false, fmt.Errorf("RequestFollow: %w", err)
+	}
+	if from.ID == to.ID {
+		return false, fmt.Errorf("RequestFollow: %s cannot follow themselves", follower)
+	}
+
+	query := `INSERT INTO follow_request (follower_id, followee_id, createdAt)
+		SELECT $1, $2, $3 WHERE NOT EXISTS (SELECT 1 FROM follow WHERE follower_id = $1 AND followee_id = $2)
+		ON CONFLICT DO NOTHING`
+
+	if _, err := s.db.Exec(query, from.ID, to.ID, time.Now()); err != nil {
+		return false, fmt.Errorf("RequestFollow: %w", err)
+	}
+
+	var following bool
+	query = `SELECT EXISTS (SELECT 1 FROM follow WHERE follower_id = $1 AND followee_id = $2)`
+
+	if err := s.db.QueryRow(query, from.ID, to.ID).Scan(&following); err != nil {
+		return false, fmt.Errorf("RequestFollow: %w", err)
+	}
+
+	return following, nil
+}
+
+func (s *PostgreSQLUserStore) GetFollowRequests(name string) ([]User, error) {
+	query := `SELECT u.id, u.username, u.createdAt FROM follow_request r JOIN "user" u ON u.id = r.follower_id
+		JOIN "user" me ON me.id = r.followee_id WHERE me.username = $1 ORDER BY r.createdAt DESC`
+
+	users, err := s.queryUsers(query, name)
+	if err != nil {
+		return nil, fmt.Errorf("GetFollowRequests: %w", err)
+	}
+
+	return users, nil
+}
+
+// AcceptFollowRequest turns the request into a follow in one transaction,
+// so that a request answered twice at once is only accepted once.
+func (s *PostgreSQLUserStore) AcceptFollowRequest(name, follower string) error {
+	to, err := s.GetUserByUsername(name)
+	if err != nil {
+		return fmt.Errorf("AcceptFollowRequest: %w", err)
+	}
+	from, err := s.GetUserByUsername(follower)
+	if err != nil {
+		return ErrFollowRequestNotFound
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("AcceptFollowRequest: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`DELETE FROM follow_request WHERE follower_id = $1 AND followee_id = $2`, from.ID, to.ID)
+	if err != nil {
+		return fmt.Errorf("AcceptFollowRequest: %w", err)
+	}
+
+	if deleted, _ := result.RowsAffected(); deleted == 0 {
+		return ErrFollowRequestNotFound
+	}
+
+	if err := s.followTx(tx, from.ID, to.ID); err != nil {
+		return fmt.Errorf("AcceptFollowRequest: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("AcceptFollowRequest: %w", err)
+	}
+
+	return nil
+}
+
+func (s *PostgreSQLUserStore) RejectFollowRequest(name, follower string) error {
+	query := `DELETE FROM follow_request r USING "user" me, "user" f
+		WHERE me.id = r.followee_id AND f.id = r.follower_id AND me.username = $1 AND f.username = $2`
+
+	result, err := s.db.Exec(query, name, follower)
+	if err != nil {
+		return fmt.Errorf("RejectFollowRequest: %w", err)
+	}
+
+	if deleted, _ := result.RowsAffected(); deleted == 0 {
+		return ErrFollowRequestNotFound
+	}
+
+	return nil
+}
+
+func (s *PostgreSQLUserStore) GetProtectedUsers(name string, ids []int) (map[int]bool, error) {
+	query := `SELECT id FROM "user" WHERE id = ANY($2) AND protected AND username <> $1
+		AND id NOT IN (SELECT f.followee_id FROM follow f JOIN "user" me ON me.id = f.follower_id WHERE me.username = $1)`
+
+	protected, err := s.queryIDSet(query, name, pq.Array(ids))
+	if err != nil {
+		return nil, fmt.Errorf("GetProtectedUsers: %w", err)
+	}
+
+	return protected, nil
+}
+
+func (s *PostgreSQLUserStore) CreateRefreshToken(name, family, hash string, expiresAt time.Time) error {
+	query := `INSERT INTO refresh_token (user_id, family_id, token_hash, createdAt, expires_at)
+		SELECT id, $2, $3, $4, $5 FROM "user" WHERE username = $1`
+
+	result, err := s.db.Exec(query, name, family, hash, time.Now().UTC(), expiresAt.UTC())
+	if err != nil {
+		return fmt.Errorf("CreateRefreshToken: %w", err)
+	}
+
+	if inserted, _ := result.RowsAffected(); inserted == 0 {
+		return fmt.Errorf("no user with that username (%s) found", name)
+	}
+
+	return nil
+}
+
+// RotateRefreshToken locks the token row, so that of two requests racing
+// with the same token the second sees it used and revokes the family.
+func (s *PostgreSQLUserStore) RotateRefreshToken(hash, newHash string, now, expiresAt time.Time) (string, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return "", fmt.Errorf("RotateRefreshToken: %w", err)
+	}
+	defer tx.Rollback()
+
+	var userID int
+	var family, username string
+	var tokenExpiresAt time.Time
+	var usedAt, revokedAt *time.Time
+	query := `SELECT t.user_id, u.username, t.family_id, t.expires_at, t.used_at, t.revoked_at
+		FROM refresh_token t JOIN "user" u ON u.id = t.user_id WHERE t.token_hash = $1 FOR UPDATE OF t`
+
+	err = tx.QueryRow(query, hash).Scan(&userID, &username, &family, &tokenExpiresAt, &usedAt, &revokedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrRefreshTokenInvalid
+		}
+		return "", fmt.Errorf("RotateRefreshToken: %w", err)
+	}
+
+	if revokedAt != nil || !now.UTC().Before(tokenExpiresAt) {
+		return "", ErrRefreshTokenInvalid
+	}
+
+	if usedAt != nil {
+		if _, err := tx.Exec(`UPDATE refresh_token SET revoked_at = $2 WHERE family_id = $1 AND revoked_at IS NULL`, family, now.UTC()); err != nil {
+			return "", fmt.Errorf("RotateRefreshToken: %w", err)
+		}
+		if err := tx.Commit(); err != nil {
+			return "", fmt.Errorf("RotateRefreshToken: %w", err)
+		}
+		return "", ErrRefreshTokenReused
+	}
+
+	if _, err := tx.Exec(`UPDATE refresh_token SET used_at = $2 WHERE token_hash = $1`, hash, now.UTC()); err != nil {
+		return "", fmt.Errorf("RotateRefreshToken: %w", err)
+	}
+
+	query = `INSERT INTO refresh_token (user_id, family_id, token_hash, createdAt, expires_at) VALUES ($1, $2, $3, $4, $5)`
+
+	if _, err := tx.Exec(query, userID, family, newHash, now.UTC(), expiresAt.UTC()); err != nil {
+		return "", fmt.Errorf("RotateRefreshToken: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("RotateRefreshToken: %w", err)
+	}
+
+	return username, nil
+}
+
+func (s *PostgreSQLUserStore) RevokeRefreshTokens(hash string) error {
+	query := `UPDATE refresh_token SET revoked_at = $2
+		WHERE family_id = (SELECT family_id FROM refresh_token WHERE token_hash = $1) AND revoked_at IS NULL`
+
+	if _, err := s.db.Exec(query, hash, time.Now().UTC()); err != nil {
+		return fmt.Errorf("RevokeRefreshTokens: %w", err)
+	}
+
+	return nil
 }
@@ -1,8 +1,10 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"sync"
 	"testing"
 	"time"
 
@@ -73,7 +75,7 @@ func TestDatabase(t *testing.T) {
 		username := "Mark"
 
 		got, err := store.GetUserSqueaks(username)
-		want := []SqueakPost{{"I don't believe it!", time.Now()}}
+		want := []SqueakPost{{Text: "I don't believe it!", CreatedAt: time.Now()}}
 
 		assertSqueaks(t, got, want)
 		assertNoError(t, err)
@@ -103,11 +105,1287 @@ func TestDatabase(t *testing.T) {
 
 		got, err := store.GetUserbase()
 		want := []User{
-			{1, "Mark", "test", "test", []SqueakPost{{"I don't believe it!", time.Now()}}, time.Now()},
-			{2, "Harrison", "test2", "test2", []SqueakPost{{"Great, kid, don't get cocky.", time.Now()}, {"Laugh it up, fuzzball!", time.Now()}}, time.Now()},
+			{ID: 1, Username: "Mark", Email: "test", Password: "test", Squeaks: []SqueakPost{{Text: "I don't believe it!", CreatedAt: time.Now()}}, CreatedAt: time.Now()},
+			{ID: 2, Username: "Harrison", Email: "test2", Password: "test2", Squeaks: []SqueakPost{{Text: "Great, kid, don't get cocky.", CreatedAt: time.Now()}, {Text: "Laugh it up, fuzzball!", CreatedAt: time.Now()}}, CreatedAt: time.Now()},
 		}
 
 		assertUserbase(t, got, want)
 		assertNoError(t, err)
 	})
+	t.Run("Mark follows Harrison", func(t *testing.T) {
+		err := store.FollowUser("Mark", "Harrison")
+		assertNoError(t, err)
+
+		followers, err := store.GetFollowers("Harrison")
+		assertNoError(t, err)
+		assertUsernames(t, followers, []string{"Mark"})
+
+		following, err := store.GetFollowing("Mark")
+		assertNoError(t, err)
+		assertUsernames(t, following, []string{"Harrison"})
+	})
+	t.Run("following twice keeps a single follow", func(t *testing.T) {
+		err := store.FollowUser("Mark", "Harrison")
+		assertNoError(t, err)
+
+		followers, err := store.GetFollowers("Harrison")
+		assertNoError(t, err)
+		assertUsernames(t, followers, []string{"Mark"})
+	})
+	t.Run("Mark unfollows Harrison", func(t *testing.T) {
+		err := store.UnfollowUser("Mark", "Harrison")
+		assertNoError(t, err)
+
+		followers, err := store.GetFollowers("Harrison")
+		assertNoError(t, err)
+		assertUsernames(t, followers, []string{})
+	})
+	t.Run("returns Mark's timeline in both timeline modes", func(t *testing.T) {
+		assertNoError(t, store.FollowUser("Mark", "Harrison"))
+
+		for _, mode := range []TimelineMode{FanOutOnRead, FanOutOnWrite} {
+			assertNoError(t, store.SetTimelineMode(mode))
+
+			got, err := store.GetTimeline("Mark", 0, 10)
+			assertNoError(t, err)
+			assertSqueaks(t, got, []SqueakPost{
+				{Text: "Laugh it up, fuzzball!"},
+				{Text: "Great, kid, don't get cocky."},
+				{Text: "I don't believe it!"},
+			})
+
+			got, err = store.GetTimeline("Mark", got[1].ID, 10)
+			assertNoError(t, err)
+			assertSqueaks(t, got, []SqueakPost{{Text: "I don't believe it!"}})
+		}
+	})
+	t.Run("fan-out on write keeps timelines in sync", func(t *testing.T) {
+		_, err := store.PostSqueak("Harrison", "I have a bad feeling about this.")
+		assertNoError(t, err)
+
+		got, err := store.GetTimeline("Mark", 0, 1)
+		assertNoError(t, err)
+		assertSqueaks(t, got, []SqueakPost{{Text: "I have a bad feeling about this."}})
+
+		assertNoError(t, store.UnfollowUser("Mark", "Harrison"))
+
+		got, err = store.GetTimeline("Mark", 0, 10)
+		assertNoError(t, err)
+		assertSqueaks(t, got, []SqueakPost{{Text: "I don't believe it!"}})
+
+		assertNoError(t, store.SetTimelineMode(FanOutOnRead))
+	})
+}
+
+func TestDatabaseConversations(t *testing.T) {
+	db, err := NewPostgreSQLConnection(os.Getenv("CONN_STR_TEST"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	clearDatabase(db)
+	initializeDatabase(db)
+
+	store := NewPostgreSQLUserStore(db)
+	store.CreateUser("Mark", "mark@test", "test")
+	store.CreateUser("Harrison", "harrison@test", "test")
+
+	rootID, err := store.PostSqueak("Mark", "I have a bad feeling about this.")
+	assertNoError(t, err)
+
+	t.Run("stores a reply in the conversation of its parent", func(t *testing.T) {
+		replyID, err := store.PostReply("Harrison", rootID, "Don't get cocky.")
+		assertNoError(t, err)
+
+		nestedID, err := store.PostReply("Mark", replyID, "I'm not.")
+		assertNoError(t, err)
+
+		nested, err := store.GetSqueak(nestedID)
+		assertNoError(t, err)
+		assertEqual(t, *nested.ParentID, replyID)
+		assertEqual(t, *nested.RootID, rootID)
+
+		got, err := store.GetConversation(rootID)
+		assertNoError(t, err)
+		assertSqueaks(t, got, []SqueakPost{
+			{Text: "I have a bad feeling about this."},
+			{Text: "Don't get cocky."},
+			{Text: "I'm not."},
+		})
+	})
+	t.Run("returns ErrSqueakNotFound when replying to a missing squeak", func(t *testing.T) {
+		_, err := store.PostReply("Harrison", 42, "Hello?")
+
+		if !errors.Is(err, ErrSqueakNotFound) {
+			t.Errorf("got error %v want %v", err, ErrSqueakNotFound)
+		}
+	})
+}
+
+func TestDatabaseLikes(t *testing.T) {
+	db, err := NewPostgreSQLConnection(os.Getenv("CONN_STR_TEST"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	clearDatabase(db)
+	initializeDatabase(db)
+
+	store := NewPostgreSQLUserStore(db)
+	store.CreateUser("Mark", "mark@test", "test")
+	id, err := store.PostSqueak("Mark", "I have a bad feeling about this.")
+	assertNoError(t, err)
+
+	const likers = 20
+	for i := 0; i < likers; i++ {
+		store.CreateUser(fmt.Sprintf("user%d", i), fmt.Sprintf("user%d@test", i), "test")
+	}
+
+	t.Run("counts concurrent likes exactly", func(t *testing.T) {
+		var wg sync.WaitGroup
+		for i := 0; i < likers; i++ {
+			wg.Add(2)
+			for range 2 {
+				go func() {
+					defer wg.Done()
+					if err := store.LikeSqueak(fmt.Sprintf("user%d", i), id); err != nil {
+						t.Error(err)
+					}
+				}()
+			}
+		}
+		wg.Wait()
+
+		squeak, err := store.GetSqueak(id)
+		assertNoError(t, err)
+		assertEqual(t, squeak.LikeCount, likers)
+
+		likes, err := store.GetSqueakLikes(id)
+		assertNoError(t, err)
+		assertEqual(t, len(likes), likers)
+	})
+	t.Run("reports which squeaks a user liked", func(t *testing.T) {
+		liked, err := store.GetLikedSqueaks("user0", []int{id, id + 1})
+		assertNoError(t, err)
+		assertEqual(t, liked[id], true)
+		assertEqual(t, liked[id+1], false)
+	})
+	t.Run("unliking decrements the count", func(t *testing.T) {
+		assertNoError(t, store.UnlikeSqueak("user0", id))
+		assertNoError(t, store.UnlikeSqueak("user0", id))
+
+		squeak, err := store.GetSqueak(id)
+		assertNoError(t, err)
+		assertEqual(t, squeak.LikeCount, likers-1)
+	})
+}
+
+func TestDatabaseResqueaks(t *testing.T) {
+	db, err := NewPostgreSQLConnection(os.Getenv("CONN_STR_TEST"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	clearDatabase(db)
+	initializeDatabase(db)
+
+	store := NewPostgreSQLUserStore(db)
+	store.CreateUser("Mark", "mark@test", "test")
+	store.CreateUser("Harrison", "harrison@test", "test")
+
+	originalID, err := store.PostSqueak("Mark", "I have a bad feeling about this.")
+	assertNoError(t, err)
+
+	t.Run("stores resqueaks and quotes", func(t *testing.T) {
+		resqueakID, err := store.PostResqueak("Harrison", originalID, "")
+		assertNoError(t, err)
+		quoteID, err := store.PostResqueak("Harrison", originalID, "Don't get cocky.")
+		assertNoError(t, err)
+
+		squeaks, err := store.GetSqueaksByIDs([]int{resqueakID, quoteID})
+		assertNoError(t, err)
+		assertEqual(t, squeaks[resqueakID].Kind, KindResqueak)
+		assertEqual(t, *squeaks[resqueakID].OriginalID, originalID)
+		assertEqual(t, squeaks[quoteID].Kind, KindQuote)
+		assertEqual(t, squeaks[quoteID].Text, "Don't get cocky.")
+	})
+	t.Run("keeps resqueaks when the original row is removed", func(t *testing.T) {
+		_, err := db.Exec(`DELETE FROM squeak WHERE id = $1`, originalID)
+		assertNoError(t, err)
+
+		squeaks, err := store.GetUserSqueaks("Harrison")
+		assertNoError(t, err)
+		assertEqual(t, len(squeaks), 2)
+		if squeaks[0].OriginalID != nil {
+			t.Errorf("got original id %d want none", *squeaks[0].OriginalID)
+		}
+	})
+}
+
+func TestDatabaseEditing(t *testing.T) {
+	db, err := NewPostgreSQLConnection(os.Getenv("CONN_STR_TEST"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	clearDatabase(db)
+	initializeDatabase(db)
+
+	store := NewPostgreSQLUserStore(db)
+	store.CreateUser("Mark", "mark@test", "test")
+	store.CreateUser("Harrison", "harrison@test", "test")
+
+	id, err := store.PostSqueak("Mark", "I have a bad fealing about this.")
+	assertNoError(t, err)
+	replyID, err := store.PostReply("Harrison", id, "Don't get cocky.")
+	assertNoError(t, err)
+	assertNoError(t, store.LikeSqueak("Harrison", id))
+
+	t.Run("keeps the replaced text as a revision", func(t *testing.T) {
+		assertNoError(t, store.EditSqueak(id, textEdit("I have a bad feeling about this.")))
+
+		squeak, err := store.GetSqueak(id)
+		assertNoError(t, err)
+		assertEqual(t, squeak.Text, "I have a bad feeling about this.")
+		if squeak.EditedAt == nil {
+			t.Error("edited squeak has no editedAt")
+		}
+
+		history, err := store.GetSqueakHistory(id)
+		assertNoError(t, err)
+		assertEqual(t, len(history), 2)
+		assertEqual(t, history[0].Text, "I have a bad fealing about this.")
+	})
+	t.Run("soft deletes a squeak", func(t *testing.T) {
+		assertNoError(t, store.DeleteSqueak(id))
+
+		_, err := store.GetSqueak(id)
+		if !errors.Is(err, ErrSqueakNotFound) {
+			t.Errorf("got error %v want %v", err, ErrSqueakNotFound)
+		}
+
+		conversation, err := store.GetConversation(id)
+		assertNoError(t, err)
+		assertEqual(t, len(conversation), 2)
+		assertEqual(t, conversation[0].Unavailable, true)
+		assertEqual(t, conversation[0].Text, "")
+		assertEqual(t, conversation[0].LikeCount, 1)
+		assertEqual(t, *conversation[1].ParentID, id)
+
+		reply, err := store.GetSqueak(replyID)
+		assertNoError(t, err)
+		assertEqual(t, reply.Text, "Don't get cocky.")
+
+		err = store.DeleteSqueak(id)
+		if !errors.Is(err, ErrSqueakNotFound) {
+			t.Errorf("got error %v want %v", err, ErrSqueakNotFound)
+		}
+	})
+}
+
+func TestDatabaseHashtags(t *testing.T) {
+	db, err := NewPostgreSQLConnection(os.Getenv("CONN_STR_TEST"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	clearDatabase(db)
+	initializeDatabase(db)
+
+	store := NewPostgreSQLUserStore(db)
+	store.CreateUser("Mark", "mark@test", "test")
+
+	store.PostSqueak("Mark", "Learning the #Force")
+	id, err := store.PostSqueak("Mark", "Use the #FORCE, #Luke")
+	assertNoError(t, err)
+
+	t.Run("returns squeaks by normalised tag", func(t *testing.T) {
+		got, err := store.GetTaggedSqueaks("force", 0, 10)
+		assertNoError(t, err)
+		assertSqueaks(t, got, []SqueakPost{{Text: "Use the #FORCE, #Luke"}, {Text: "Learning the #Force"}})
+
+		got, err = store.GetTaggedSqueaks("force", id, 10)
+		assertNoError(t, err)
+		assertSqueaks(t, got, []SqueakPost{{Text: "Learning the #Force"}})
+	})
+	t.Run("counts trending tags", func(t *testing.T) {
+		got, err := store.GetTrendingTags(time.Now().Add(-time.Hour), 10)
+		assertNoError(t, err)
+		assertEqual(t, len(got), 2)
+		assertEqual(t, got[0], TagCount{"force", 2})
+		assertEqual(t, got[1], TagCount{"luke", 1})
+
+		got, err = store.GetTrendingTags(time.Now().Add(time.Hour), 10)
+		assertNoError(t, err)
+		assertEqual(t, len(got), 0)
+	})
+	t.Run("reindexes edited and skips deleted squeaks", func(t *testing.T) {
+		assertNoError(t, store.EditSqueak(id, textEdit("Use the #Force")))
+
+		got, err := store.GetTaggedSqueaks("luke", 0, 10)
+		assertNoError(t, err)
+		assertEqual(t, len(got), 0)
+
+		assertNoError(t, store.DeleteSqueak(id))
+
+		got, err = store.GetTaggedSqueaks("force", 0, 10)
+		assertNoError(t, err)
+		assertSqueaks(t, got, []SqueakPost{{Text: "Learning the #Force"}})
+	})
+}
+
+func TestDatabaseMentions(t *testing.T) {
+	db, err := NewPostgreSQLConnection(os.Getenv("CONN_STR_TEST"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	clearDatabase(db)
+	initializeDatabase(db)
+
+	store := NewPostgreSQLUserStore(db)
+	store.CreateUser("Mark", "mark@test", "test")
+	store.CreateUser("Carrie", "carrie@test", "test")
+
+	store.PostSqueak("Carrie", "@Mark where is the Falcon?")
+	id, err := store.PostSqueak("Carrie", "Hey @Mark, @Nobody here")
+	assertNoError(t, err)
+
+	t.Run("stores resolved mentions", func(t *testing.T) {
+		got, err := store.GetMentioningSqueaks("Mark", 0, 10)
+		assertNoError(t, err)
+		assertSqueaks(t, got, []SqueakPost{{Text: "Hey @Mark, @Nobody here"}, {Text: "@Mark where is the Falcon?"}})
+		assertEqual(t, len(got[0].Mentions), 1)
+		assertEqual(t, got[0].Mentions[0], Mention{got[0].Mentions[0].UserID, "Mark", 4, 9})
+
+		got, err = store.GetMentioningSqueaks("Mark", id, 10)
+		assertNoError(t, err)
+		assertSqueaks(t, got, []SqueakPost{{Text: "@Mark where is the Falcon?"}})
+	})
+	t.Run("re-resolves edited and skips deleted squeaks", func(t *testing.T) {
+		assertNoError(t, store.EditSqueak(id, textEdit("Hey @Carrie")))
+
+		got, err := store.GetMentioningSqueaks("Carrie", 0, 10)
+		assertNoError(t, err)
+		assertSqueaks(t, got, []SqueakPost{{Text: "Hey @Carrie"}})
+
+		assertNoError(t, store.DeleteSqueak(id))
+
+		got, err = store.GetMentioningSqueaks("Carrie", 0, 10)
+		assertNoError(t, err)
+		assertEqual(t, len(got), 0)
+	})
+}
+
+func TestDatabaseNotifications(t *testing.T) {
+	db, err := NewPostgreSQLConnection(os.Getenv("CONN_STR_TEST"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	clearDatabase(db)
+	initializeDatabase(db)
+
+	store := NewPostgreSQLUserStore(db)
+	store.CreateUser("Mark", "mark@test", "test")
+	store.CreateUser("Alice", "alice@test", "test")
+	store.CreateUser("Bob", "bob@test", "test")
+	id, err := store.PostSqueak("Mark", "I have a bad feeling about this.")
+	assertNoError(t, err)
+
+	t.Run("groups unread events", func(t *testing.T) {
+		assertNoError(t, store.AddNotification("Mark", "Alice", NotificationLike, &id))
+		assertNoError(t, store.AddNotification("Mark", "Bob", NotificationLike, &id))
+		assertNoError(t, store.AddNotification("Mark", "Alice", NotificationLike, &id))
+		assertNoError(t, store.AddNotification("Mark", "Alice", NotificationFollow, nil))
+
+		got, err := store.GetNotifications("Mark", false, 0, 10)
+		assertNoError(t, err)
+		assertEqual(t, len(got), 2)
+		assertEqual(t, got[0].Kind, NotificationFollow)
+		assertEqual(t, got[1].ActorCount, 2)
+		assertEqual(t, len(got[1].Actors), 2)
+		assertEqual(t, got[1].Actors[0].Username, "Alice")
+		assertEqual(t, got[1].Actors[1].Username, "Bob")
+	})
+	t.Run("marks notifications read", func(t *testing.T) {
+		got, err := store.GetNotifications("Mark", true, 0, 10)
+		assertNoError(t, err)
+
+		assertNoError(t, store.MarkNotificationsRead("Mark", []int{got[0].ID}))
+
+		got, err = store.GetNotifications("Mark", true, 0, 10)
+		assertNoError(t, err)
+		assertEqual(t, len(got), 1)
+
+		assertNoError(t, store.MarkNotificationsRead("Mark", nil))
+
+		got, err = store.GetNotifications("Mark", true, 0, 10)
+		assertNoError(t, err)
+		assertEqual(t, len(got), 0)
+
+		assertNoError(t, store.AddNotification("Mark", "Bob", NotificationFollow, nil))
+
+		got, err = store.GetNotifications("Mark", false, 0, 10)
+		assertNoError(t, err)
+		assertEqual(t, len(got), 3)
+		assertEqual(t, got[0].Read, false)
+	})
+}
+
+func TestDatabaseSqueaksAfter(t *testing.T) {
+	db, err := NewPostgreSQLConnection(os.Getenv("CONN_STR_TEST"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	clearDatabase(db)
+	initializeDatabase(db)
+
+	store := NewPostgreSQLUserStore(db)
+	store.CreateUser("Mark", "mark@test", "test")
+	store.CreateUser("Carrie", "carrie@test", "test")
+
+	first, err := store.PostSqueak("Mark", "Seen before disconnecting")
+	assertNoError(t, err)
+	store.PostSqueak("Carrie", "Not followed")
+	store.PostSqueak("Mark", "Missed while offline")
+	deleted, _ := store.PostSqueak("Mark", "Deleted while offline")
+	assertNoError(t, store.DeleteSqueak(deleted))
+
+	got, err := store.GetSqueaksAfter([]string{"Mark"}, first, 10)
+	assertNoError(t, err)
+	assertSqueaks(t, got, []SqueakPost{{Text: "Missed while offline"}})
+}
+
+func TestDatabaseDirectMessages(t *testing.T) {
+	db, err := NewPostgreSQLConnection(os.Getenv("CONN_STR_TEST"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	clearDatabase(db)
+	initializeDatabase(db)
+
+	store := NewPostgreSQLUserStore(db)
+	store.CreateUser("Mark", "mark@test", "test")
+	store.CreateUser("Carrie", "carrie@test", "test")
+	store.CreateUser("Harrison", "harrison@test", "test")
+
+	id, err := store.CreateDirectConversation("Mark", []string{"Carrie"})
+	assertNoError(t, err)
+
+	t.Run("reuses one-to-one conversations", func(t *testing.T) {
+		again, err := store.CreateDirectConversation("Carrie", []string{"Mark"})
+		assertNoError(t, err)
+		assertEqual(t, again, id)
+
+		group, err := store.CreateDirectConversation("Mark", []string{"Carrie", "Harrison"})
+		assertNoError(t, err)
+		if group == id {
+			t.Error("group conversation reused the one-to-one conversation")
+		}
+	})
+	t.Run("tracks messages and read receipts", func(t *testing.T) {
+		first, err := store.PostDirectMessage("Carrie", id, "Help me, Obi-Wan")
+		assertNoError(t, err)
+		_, err = store.PostDirectMessage("Carrie", id, "You're my only hope")
+		assertNoError(t, err)
+
+		conversations, err := store.GetDirectConversations("Mark")
+		assertNoError(t, err)
+		assertEqual(t, conversations[0].ID, id)
+		assertEqual(t, conversations[0].UnreadCount, 2)
+		assertEqual(t, conversations[0].LastMessage.Text, "You're my only hope")
+
+		assertNoError(t, store.MarkDirectMessagesRead("Mark", id, first))
+
+		conversations, err = store.GetDirectConversations("Mark")
+		assertNoError(t, err)
+		assertEqual(t, conversations[0].UnreadCount, 1)
+
+		messages, err := store.GetDirectMessages(id, 0, 1)
+		assertNoError(t, err)
+		assertEqual(t, len(messages), 1)
+		assertEqual(t, messages[0].Text, "You're my only hope")
+	})
+	t.Run("reports blocks in both directions", func(t *testing.T) {
+		assertNoError(t, store.BlockUser("Harrison", "Mark"))
+
+		blocked, err := store.IsBlocked("Mark", "Harrison")
+		assertNoError(t, err)
+		assertEqual(t, blocked, true)
+
+		assertNoError(t, store.UnblockUser("Harrison", "Mark"))
+
+		blocked, err = store.IsBlocked("Mark", "Harrison")
+		assertNoError(t, err)
+		assertEqual(t, blocked, false)
+	})
+}
+
+func TestDatabaseBlocksAndMutes(t *testing.T) {
+	db, err := NewPostgreSQLConnection(os.Getenv("CONN_STR_TEST"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	clearDatabase(db)
+	initializeDatabase(db)
+
+	store := NewPostgreSQLUserStore(db)
+	lukeID, _ := store.CreateUser("Luke", "luke@test", "test")
+	vaderID, _ := store.CreateUser("Vader", "vader@test", "test")
+	threepioID, _ := store.CreateUser("Threepio", "threepio@test", "test")
+	store.FollowUser("Vader", "Luke")
+
+	assertNoError(t, store.BlockUser("Luke", "Vader"))
+	assertNoError(t, store.MuteUser("Luke", "Threepio"))
+
+	t.Run("blocking ends following", func(t *testing.T) {
+		following, err := store.GetFollowing("Vader")
+		assertNoError(t, err)
+		assertEqual(t, len(following), 0)
+	})
+	t.Run("lists blocked and muted users", func(t *testing.T) {
+		blocked, err := store.GetBlockedUsers("Luke")
+		assertNoError(t, err)
+		assertUsernames(t, blocked, []string{"Vader"})
+
+		muted, err := store.GetMutedUsers("Luke")
+		assertNoError(t, err)
+		assertUsernames(t, muted, []string{"Threepio"})
+	})
+	t.Run("hides blocks both ways and mutes one way", func(t *testing.T) {
+		hidden, err := store.GetHiddenUsers("Luke")
+		assertNoError(t, err)
+		assertEqual(t, len(hidden), 2)
+		assertEqual(t, hidden[vaderID] && hidden[threepioID], true)
+
+		hidden, err = store.GetHiddenUsers("Vader")
+		assertNoError(t, err)
+		assertEqual(t, hidden[lukeID], true)
+
+		hidden, err = store.GetHiddenUsers("Threepio")
+		assertNoError(t, err)
+		assertEqual(t, len(hidden), 0)
+	})
+	t.Run("does not resolve mentions across a block", func(t *testing.T) {
+		store.PostSqueak("Vader", "Join me @Luke")
+
+		got, err := store.GetMentioningSqueaks("Luke", 0, 10)
+		assertNoError(t, err)
+		assertEqual(t, len(got), 0)
+	})
+}
+
+func TestDatabaseSearch(t *testing.T) {
+	db, err := NewPostgreSQLConnection(os.Getenv("CONN_STR_TEST"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	clearDatabase(db)
+	initializeDatabase(db)
+
+	store := NewPostgreSQLUserStore(db)
+	store.CreateUser("Luke", "luke@test", "test")
+	store.CreateUser("Lukas", "lukas@test", "test")
+	store.CreateUser("Vader", "vader@test", "test")
+	store.PostSqueak("Luke", "The force is strong")
+	store.PostSqueak("Vader", "Feel the force, the force flows through you")
+	deleted, _ := store.PostSqueak("Vader", "Force choke")
+	assertNoError(t, store.DeleteSqueak(deleted))
+
+	t.Run("ranks squeaks by relevance", func(t *testing.T) {
+		got, err := store.SearchSqueaks("forces", 0, 10)
+		assertNoError(t, err)
+		assertSqueaks(t, got, []SqueakPost{
+			{Text: "Feel the force, the force flows through you"},
+			{Text: "The force is strong"},
+		})
+
+		got, err = store.SearchSqueaks("forces", 1, 10)
+		assertNoError(t, err)
+		assertSqueaks(t, got, []SqueakPost{{Text: "The force is strong"}})
+	})
+	t.Run("finds users by username prefix", func(t *testing.T) {
+		got, err := store.SearchUsers("luk", 0, 10)
+		assertNoError(t, err)
+		assertUsernames(t, got, []string{"Luke", "Lukas"})
+	})
+}
+
+func TestDatabaseBookmarks(t *testing.T) {
+	db, err := NewPostgreSQLConnection(os.Getenv("CONN_STR_TEST"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	clearDatabase(db)
+	initializeDatabase(db)
+
+	store := NewPostgreSQLUserStore(db)
+	store.CreateUser("Luke", "luke@test", "test")
+	store.CreateUser("Han", "han@test", "test")
+	firstID, _ := store.PostSqueak("Han", "Never tell me the odds")
+	secondID, _ := store.PostSqueak("Han", "I know")
+
+	assertNoError(t, store.BookmarkSqueak("Luke", secondID))
+	assertNoError(t, store.BookmarkSqueak("Luke", firstID))
+	assertNoError(t, store.BookmarkSqueak("Luke", firstID))
+
+	t.Run("lists bookmarks most recently saved first", func(t *testing.T) {
+		bookmarks, err := store.GetBookmarks("Luke", 0, 10)
+		assertNoError(t, err)
+		assertEqual(t, len(bookmarks), 2)
+		assertEqual(t, bookmarks[0].Squeak.ID, firstID)
+		assertEqual(t, bookmarks[1].Squeak.ID, secondID)
+
+		bookmarks, err = store.GetBookmarks("Luke", bookmarks[0].ID, 10)
+		assertNoError(t, err)
+		assertEqual(t, len(bookmarks), 1)
+		assertEqual(t, bookmarks[0].Squeak.ID, secondID)
+	})
+	t.Run("includes deleted squeaks as unavailable", func(t *testing.T) {
+		assertNoError(t, store.DeleteSqueak(firstID))
+
+		bookmarks, err := store.GetBookmarks("Luke", 0, 10)
+		assertNoError(t, err)
+		assertEqual(t, bookmarks[0].Squeak.Unavailable, true)
+	})
+	t.Run("removes bookmarks", func(t *testing.T) {
+		assertNoError(t, store.UnbookmarkSqueak("Luke", firstID))
+
+		bookmarks, err := store.GetBookmarks("Luke", 0, 10)
+		assertNoError(t, err)
+		assertEqual(t, len(bookmarks), 1)
+	})
+	t.Run("rejects unknown squeaks", func(t *testing.T) {
+		err := store.BookmarkSqueak("Luke", 99)
+		assertEqual(t, errors.Is(err, ErrSqueakNotFound), true)
+	})
+}
+
+func TestDatabaseLists(t *testing.T) {
+	db, err := NewPostgreSQLConnection(os.Getenv("CONN_STR_TEST"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	clearDatabase(db)
+	initializeDatabase(db)
+
+	store := NewPostgreSQLUserStore(db)
+	store.CreateUser("Rob", "rob@test", "test")
+	store.CreateUser("Russ", "russ@test", "test")
+	store.CreateUser("Ian", "ian@test", "test")
+	store.PostSqueak("Russ", "Go 1.0 is out")
+	store.PostSqueak("Rob", "Not on the list")
+	store.PostSqueak("Ian", "Generics are coming")
+
+	coreID, err := store.CreateList("Rob", "Go core", false)
+	assertNoError(t, err)
+	friendsID, err := store.CreateList("Rob", "Friends", true)
+	assertNoError(t, err)
+
+	assertNoError(t, store.AddListMember(coreID, "Russ"))
+	assertNoError(t, store.AddListMember(coreID, "Ian"))
+	assertNoError(t, store.AddListMember(coreID, "Ian"))
+
+	t.Run("gets lists with their member counts", func(t *testing.T) {
+		list, err := store.GetList(coreID)
+		assertNoError(t, err)
+		assertEqual(t, list.Owner, "Rob")
+		assertEqual(t, list.MemberCount, 2)
+
+		members, err := store.GetListMembers(coreID)
+		assertNoError(t, err)
+		assertUsernames(t, members, []string{"Ian", "Russ"})
+	})
+	t.Run("leaves out private lists unless asked", func(t *testing.T) {
+		lists, err := store.GetLists("Rob", false)
+		assertNoError(t, err)
+		assertEqual(t, len(lists), 1)
+
+		lists, err = store.GetLists("Rob", true)
+		assertNoError(t, err)
+		assertEqual(t, len(lists), 2)
+	})
+	t.Run("pages through the list timeline", func(t *testing.T) {
+		squeaks, err := store.GetListTimeline(coreID, 0, 1)
+		assertNoError(t, err)
+		assertEqual(t, len(squeaks), 1)
+		assertEqual(t, squeaks[0].Text, "Generics are coming")
+
+		squeaks, err = store.GetListTimeline(coreID, squeaks[0].ID, 10)
+		assertNoError(t, err)
+		assertEqual(t, len(squeaks), 1)
+		assertEqual(t, squeaks[0].Text, "Go 1.0 is out")
+	})
+	t.Run("updates, removes members and deletes", func(t *testing.T) {
+		assertNoError(t, store.UpdateList(coreID, "Go team", true))
+		assertNoError(t, store.RemoveListMember(coreID, "Ian"))
+
+		list, err := store.GetList(coreID)
+		assertNoError(t, err)
+		assertEqual(t, list.Name, "Go team")
+		assertEqual(t, list.Private, true)
+		assertEqual(t, list.MemberCount, 1)
+
+		assertNoError(t, store.DeleteList(friendsID))
+		_, err = store.GetList(friendsID)
+		assertEqual(t, errors.Is(err, ErrListNotFound), true)
+	})
+}
+
+func TestDatabasePolls(t *testing.T) {
+	db, err := NewPostgreSQLConnection(os.Getenv("CONN_STR_TEST"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	clearDatabase(db)
+	initializeDatabase(db)
+
+	store := NewPostgreSQLUserStore(db)
+	store.CreateUser("Anakin", "anakin@test", "test")
+	store.CreateUser("Padme", "padme@test", "test")
+
+	closesAt := time.Now().Add(time.Hour)
+	id, err := store.CreateSqueak("Anakin", SqueakPost{Text: "Sand or water?", Poll: newPoll([]string{"Sand", "Water"}, closesAt)})
+	assertNoError(t, err)
+
+	t.Run("stores the poll with the squeak", func(t *testing.T) {
+		squeak, err := store.GetSqueak(id)
+		assertNoError(t, err)
+		assertEqual(t, len(squeak.Poll.Options), 2)
+		assertEqual(t, squeak.Poll.Options[0].Text, "Sand")
+		assertEqual(t, squeak.Poll.ClosesAt.Unix(), closesAt.Unix())
+		assertEqual(t, *squeak.Poll.VoteCount, 0)
+	})
+	t.Run("counts one vote per user", func(t *testing.T) {
+		assertNoError(t, store.VoteInPoll("Padme", id, 1))
+		assertEqual(t, errors.Is(store.VoteInPoll("Padme", id, 0), ErrAlreadyVoted), true)
+
+		squeak, err := store.GetSqueak(id)
+		assertNoError(t, err)
+		assertEqual(t, *squeak.Poll.Options[0].Votes, 0)
+		assertEqual(t, *squeak.Poll.Options[1].Votes, 1)
+		assertEqual(t, *squeak.Poll.VoteCount, 1)
+
+		votes, err := store.GetPollVotes("Padme", []int{id})
+		assertNoError(t, err)
+		assertEqual(t, votes[id], 1)
+
+		votes, err = store.GetPollVotes("Anakin", []int{id})
+		assertNoError(t, err)
+		assertEqual(t, len(votes), 0)
+	})
+}
+
+func TestDatabaseMedia(t *testing.T) {
+	db, err := NewPostgreSQLConnection(os.Getenv("CONN_STR_TEST"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	clearDatabase(db)
+	initializeDatabase(db)
+
+	store := NewPostgreSQLUserStore(db)
+	store.CreateUser("Ansel", "ansel@test", "test")
+
+	firstID, err := store.CreateMedia("Ansel", Media{ContentType: "image/png", Width: 8, Height: 6, Size: 100, Key: "first"})
+	assertNoError(t, err)
+	secondID, err := store.CreateMedia("Ansel", Media{ContentType: "image/jpeg", Width: 4, Height: 3, Size: 50, Key: "second"})
+	assertNoError(t, err)
+
+	t.Run("gets media", func(t *testing.T) {
+		media, err := store.GetMedia(firstID)
+		assertNoError(t, err)
+		assertEqual(t, media.Key, "first")
+		assertEqual(t, media.Width, 8)
+		assertEqual(t, media.SqueakID == nil, true)
+
+		_, err = store.GetMedia(99)
+		assertEqual(t, errors.Is(err, ErrMediaNotFound), true)
+	})
+	t.Run("attaches media to squeaks in order", func(t *testing.T) {
+		squeakID, err := store.CreateSqueak("Ansel", SqueakPost{
+			Text: "Moonrise", MediaIDs: []int{secondID, firstID}, ContentWarning: "Night sky", ReplySetting: ReplyFollowing,
+		})
+		assertNoError(t, err)
+
+		squeak, err := store.GetSqueak(squeakID)
+		assertNoError(t, err)
+		assertEqual(t, len(squeak.Media), 2)
+		assertEqual(t, squeak.Media[0].ID, secondID)
+		assertEqual(t, squeak.Media[1].ID, firstID)
+		assertEqual(t, squeak.ContentWarning, "Night sky")
+		assertEqual(t, squeak.ReplySetting, ReplyFollowing)
+	})
+	t.Run("stores nothing when media is attached already", func(t *testing.T) {
+		if _, err := store.CreateSqueak("Ansel", SqueakPost{Text: "Moonrise again", MediaIDs: []int{firstID}}); err == nil {
+			t.Error("attached media twice")
+		}
+
+		squeaks, err := store.GetUserSqueaks("Ansel")
+		assertNoError(t, err)
+		assertEqual(t, len(squeaks), 1)
+	})
+}
+
+func TestDatabaseDrafts(t *testing.T) {
+	db, err := NewPostgreSQLConnection(os.Getenv("CONN_STR_TEST"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	clearDatabase(db)
+	initializeDatabase(db)
+
+	store := NewPostgreSQLUserStore(db)
+	store.CreateUser("Leia", "leia@test", "test")
+
+	inAnHour := time.Now().Add(time.Hour)
+	draftID, err := store.CreateDraft("Leia", "Help me, Obi-Wan", nil)
+	assertNoError(t, err)
+	scheduledID, err := store.CreateDraft("Leia", "You're my only hope", &inAnHour)
+	assertNoError(t, err)
+
+	t.Run("gets, lists and edits drafts", func(t *testing.T) {
+		draft, err := store.GetDraft(scheduledID)
+		assertNoError(t, err)
+		assertEqual(t, draft.PublishAt.Unix(), inAnHour.Unix())
+
+		assertNoError(t, store.UpdateDraft(draftID, "Help me", &inAnHour))
+
+		drafts, err := store.GetDrafts("Leia")
+		assertNoError(t, err)
+		assertEqual(t, len(drafts), 2)
+		assertEqual(t, drafts[0].Text, "Help me")
+		assertEqual(t, drafts[0].PublishAt != nil, true)
+	})
+	t.Run("publishes each due draft once across concurrent schedulers", func(t *testing.T) {
+		for range 20 {
+			store.CreateDraft("Leia", "Scheduled", &inAnHour)
+		}
+
+		var mu sync.Mutex
+		published := map[int]bool{}
+		var wg sync.WaitGroup
+		for range 4 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for {
+					ids, err := store.PublishDueDrafts(inAnHour.Add(time.Minute), 3)
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					mu.Lock()
+					for _, id := range ids {
+						published[id] = true
+					}
+					mu.Unlock()
+					if len(ids) == 0 {
+						return
+					}
+				}
+			}()
+		}
+		wg.Wait()
+
+		assertEqual(t, len(published), 22)
+
+		squeaks, err := store.GetUserSqueaks("Leia")
+		assertNoError(t, err)
+		assertEqual(t, len(squeaks), 22)
+
+		_, err = store.GetDraft(scheduledID)
+		assertEqual(t, errors.Is(err, ErrDraftNotFound), true)
+	})
+}
+
+func TestDatabaseContentWarnings(t *testing.T) {
+	db, err := NewPostgreSQLConnection(os.Getenv("CONN_STR_TEST"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	clearDatabase(db)
+	initializeDatabase(db)
+
+	store := NewPostgreSQLUserStore(db)
+	store.CreateUser("Ripley", "ripley@test", "test")
+	id, _ := store.PostSqueak("Ripley", "Kane did not make it")
+
+	t.Run("stores content flags", func(t *testing.T) {
+		contentWarning, sensitive := "spoilers", true
+		assertNoError(t, store.EditSqueak(id, SqueakEdit{ContentWarning: &contentWarning, Sensitive: &sensitive}))
+
+		squeaks, err := store.GetUserSqueaks("Ripley")
+		assertNoError(t, err)
+		assertEqual(t, squeaks[0].ContentWarning, "spoilers")
+		assertEqual(t, squeaks[0].Sensitive, true)
+
+		userbase, err := store.GetUserbase()
+		assertNoError(t, err)
+		assertEqual(t, userbase[0].Squeaks[0].ContentWarning, "spoilers")
+	})
+	t.Run("stores preferences", func(t *testing.T) {
+		preferences, err := store.GetPreferences("Ripley")
+		assertNoError(t, err)
+		assertEqual(t, preferences.ExpandContentWarnings, false)
+
+		assertNoError(t, store.UpdatePreferences("Ripley", Preferences{ExpandContentWarnings: true}))
+
+		preferences, err = store.GetPreferences("Ripley")
+		assertNoError(t, err)
+		assertEqual(t, preferences.ExpandContentWarnings, true)
+	})
+}
+
+func TestDatabaseUpgrade(t *testing.T) {
+	db, err := NewPostgreSQLConnection(os.Getenv("CONN_STR_TEST"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	clearDatabase(db)
+
+	// The schema and data of a database from before squeaks had replies
+	// and users had profiles.
+	_, err = db.Exec(`CREATE TABLE "user" (
+		id SERIAL PRIMARY KEY,
+		username VARCHAR(100) UNIQUE NOT NULL,
+		email VARCHAR(100) UNIQUE NOT NULL,
+		password VARCHAR(60) NOT NULL,
+		createdAt TIMESTAMP
+	);
+	CREATE TABLE squeak (
+		id SERIAL PRIMARY KEY,
+		user_id INT,
+		text VARCHAR(255),
+		createdAt TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES "user"(id)
+	);
+	CREATE TABLE follow (
+		follower_id INT,
+		followee_id INT,
+		createdAt TIMESTAMP,
+		PRIMARY KEY (follower_id, followee_id),
+		FOREIGN KEY (follower_id) REFERENCES "user"(id),
+		FOREIGN KEY (followee_id) REFERENCES "user"(id)
+	);
+	INSERT INTO "user" (username, email, password, createdAt) VALUES ('Ellen', 'ellen@test', 'test', NOW()), ('Dallas', 'dallas@test', 'test', NOW());
+	INSERT INTO squeak (user_id, text, createdAt) VALUES (1, 'Final report of the commercial starship Nostromo', NOW()), (1, 'Signing off', NOW());
+	INSERT INTO follow (follower_id, followee_id, createdAt) VALUES (2, 1, NOW())`)
+	assertNoError(t, err)
+
+	initializeDatabase(db)
+	store := NewPostgreSQLUserStore(db)
+
+	t.Run("adds the new columns", func(t *testing.T) {
+		squeaks, err := store.GetUserSqueaks("Ellen")
+		assertNoError(t, err)
+		assertEqual(t, len(squeaks), 2)
+		assertEqual(t, squeaks[0].Kind, KindSqueak)
+		assertEqual(t, squeaks[0].ReplySetting, ReplyEveryone)
+	})
+	t.Run("backfills the counts", func(t *testing.T) {
+		profile, err := store.GetProfile("Ellen")
+		assertNoError(t, err)
+		assertEqual(t, profile.SqueakCount, 2)
+		assertEqual(t, profile.FollowerCount, 1)
+
+		profile, err = store.GetProfile("Dallas")
+		assertNoError(t, err)
+		assertEqual(t, profile.FollowingCount, 1)
+	})
+}
+
+func TestDatabaseProfiles(t *testing.T) {
+	db, err := NewPostgreSQLConnection(os.Getenv("CONN_STR_TEST"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	clearDatabase(db)
+	initializeDatabase(db)
+
+	store := NewPostgreSQLUserStore(db)
+	store.CreateUser("Ellen", "ellen@test", "test")
+	store.CreateUser("Dallas", "dallas@test", "test")
+	store.CreateUser("Kane", "kane@test", "test")
+
+	t.Run("stores profile fields", func(t *testing.T) {
+		avatarID := 7
+		assertNoError(t, store.UpdateProfile("Ellen", User{DisplayName: "Ellen Ripley", Bio: "Warrant officer", AvatarID: &avatarID}))
+
+		profile, err := store.GetProfile("Ellen")
+		assertNoError(t, err)
+		assertEqual(t, profile.DisplayName, "Ellen Ripley")
+		assertEqual(t, profile.Bio, "Warrant officer")
+		assertEqual(t, *profile.AvatarID, 7)
+		assertEqual(t, profile.Email, "")
+
+		user, err := store.GetUserByUsername("Ellen")
+		assertNoError(t, err)
+		assertEqual(t, user.Email, "ellen@test")
+	})
+	t.Run("keeps counts up to date", func(t *testing.T) {
+		assertNoError(t, store.FollowUser("Dallas", "Ellen"))
+		assertNoError(t, store.FollowUser("Dallas", "Ellen"))
+		assertNoError(t, store.FollowUser("Kane", "Ellen"))
+		assertNoError(t, store.FollowUser("Ellen", "Dallas"))
+		store.PostSqueak("Ellen", "Final report of the commercial starship Nostromo")
+		id, _ := store.PostSqueak("Ellen", "Signing off")
+
+		profile, err := store.GetProfile("Ellen")
+		assertNoError(t, err)
+		assertEqual(t, profile.FollowerCount, 2)
+		assertEqual(t, profile.FollowingCount, 1)
+		assertEqual(t, profile.SqueakCount, 2)
+
+		assertNoError(t, store.BlockUser("Kane", "Ellen"))
+		assertNoError(t, store.DeleteSqueak(id))
+		if err := store.DeleteSqueak(id); err == nil {
+			t.Error("expected deleting twice to fail")
+		}
+
+		profile, err = store.GetProfile("Ellen")
+		assertNoError(t, err)
+		assertEqual(t, profile.FollowerCount, 1)
+		assertEqual(t, profile.SqueakCount, 1)
+
+		dallas, err := store.GetProfile("Dallas")
+		assertNoError(t, err)
+		assertEqual(t, dallas.FollowerCount, 1)
+		assertEqual(t, dallas.FollowingCount, 1)
+	})
+}
+
+func TestDatabasePinnedSqueaks(t *testing.T) {
+	db, err := NewPostgreSQLConnection(os.Getenv("CONN_STR_TEST"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	clearDatabase(db)
+	initializeDatabase(db)
+
+	store := NewPostgreSQLUserStore(db)
+	store.CreateUser("Ellen", "ellen@test", "test")
+	store.CreateUser("Dallas", "dallas@test", "test")
+	first, _ := store.PostSqueak("Ellen", "Final report of the commercial starship Nostromo")
+	second, _ := store.PostSqueak("Ellen", "Signing off")
+	dallas, _ := store.PostSqueak("Dallas", "Ash, what's the story?")
+
+	t.Run("pins only the user's own squeaks", func(t *testing.T) {
+		if err := store.PinSqueak("Ellen", dallas); !errors.Is(err, ErrSqueakNotFound) {
+			t.Errorf("got error %v, want %v", err, ErrSqueakNotFound)
+		}
+
+		assertNoError(t, store.PinSqueak("Ellen", first))
+		assertNoError(t, store.UpdateProfile("Ellen", User{Bio: "Warrant officer"}))
+
+		profile, err := store.GetProfile("Ellen")
+		assertNoError(t, err)
+		assertEqual(t, *profile.PinnedSqueakID, first)
+	})
+	t.Run("unpins only the pinned squeak", func(t *testing.T) {
+		assertNoError(t, store.UnpinSqueak("Ellen", second))
+
+		profile, _ := store.GetProfile("Ellen")
+		assertEqual(t, *profile.PinnedSqueakID, first)
+	})
+	t.Run("clears the pin when the squeak is deleted", func(t *testing.T) {
+		assertNoError(t, store.PinSqueak("Ellen", second))
+		assertNoError(t, store.DeleteSqueak(second))
+
+		profile, _ := store.GetProfile("Ellen")
+		if profile.PinnedSqueakID != nil {
+			t.Errorf("got pinned squeak %d, want none", *profile.PinnedSqueakID)
+		}
+		assertEqual(t, profile.SqueakCount, 1)
+
+		if err := store.PinSqueak("Ellen", second); !errors.Is(err, ErrSqueakNotFound) {
+			t.Errorf("got error %v, want %v", err, ErrSqueakNotFound)
+		}
+	})
+}
+
+func TestDatabaseFollowRequests(t *testing.T) {
+	db, err := NewPostgreSQLConnection(os.Getenv("CONN_STR_TEST"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	clearDatabase(db)
+	initializeDatabase(db)
+
+	store := NewPostgreSQLUserStore(db)
+	store.CreateUser("Ellen", "ellen@test", "test")
+	store.CreateUser("Dallas", "dallas@test", "test")
+	store.CreateUser("Kane", "kane@test", "test")
+	ellen, _ := store.GetUserByUsername("Ellen")
+	dallas, _ := store.GetUserByUsername("Dallas")
+	ids := []int{ellen.ID, dallas.ID}
+	assertNoError(t, store.UpdateProfile("Ellen", User{Protected: true}))
+
+	t.Run("protects squeaks from anyone but the owner", func(t *testing.T) {
+		for _, name := range []string{"", "Dallas"} {
+			protected, err := store.GetProtectedUsers(name, ids)
+			assertNoError(t, err)
+			assertEqual(t, protected[ellen.ID], true)
+			assertEqual(t, len(protected), 1)
+		}
+
+		protected, err := store.GetProtectedUsers("Ellen", ids)
+		assertNoError(t, err)
+		assertEqual(t, len(protected), 0)
+	})
+	t.Run("stores requests until answered", func(t *testing.T) {
+		for _, name := range []string{"Dallas", "Kane", "Dallas"} {
+			following, err := store.RequestFollow(name, "Ellen")
+			assertNoError(t, err)
+			assertEqual(t, following, false)
+		}
+
+		requests, err := store.GetFollowRequests("Ellen")
+		assertNoError(t, err)
+		assertUsernames(t, requests, []string{"Kane", "Dallas"})
+
+		assertNoError(t, store.AcceptFollowRequest("Ellen", "Dallas"))
+		if err := store.AcceptFollowRequest("Ellen", "Dallas"); !errors.Is(err, ErrFollowRequestNotFound) {
+			t.Errorf("got error %v, want %v", err, ErrFollowRequestNotFound)
+		}
+		assertNoError(t, store.RejectFollowRequest("Ellen", "Kane"))
+		if err := store.RejectFollowRequest("Ellen", "Kane"); !errors.Is(err, ErrFollowRequestNotFound) {
+			t.Errorf("got error %v, want %v", err, ErrFollowRequestNotFound)
+		}
+
+		following, err := store.RequestFollow("Dallas", "Ellen")
+		assertNoError(t, err)
+		assertEqual(t, following, true)
+
+		protected, _ := store.GetProtectedUsers("Dallas", ids)
+		assertEqual(t, len(protected), 0)
+
+		profile, _ := store.GetProfile("Ellen")
+		assertEqual(t, profile.FollowerCount, 1)
+		assertEqual(t, profile.Protected, true)
+	})
+	t.Run("withdraws requests on unfollow and block", func(t *testing.T) {
+		store.RequestFollow("Kane", "Ellen")
+		assertNoError(t, store.UnfollowUser("Kane", "Ellen"))
+		store.RequestFollow("Kane", "Ellen")
+		assertNoError(t, store.BlockUser("Ellen", "Kane"))
+
+		requests, err := store.GetFollowRequests("Ellen")
+		assertNoError(t, err)
+		assertEqual(t, len(requests), 0)
+	})
+	t.Run("accepts pending requests once unprotected", func(t *testing.T) {
+		assertNoError(t, store.UnblockUser("Ellen", "Kane"))
+		store.RequestFollow("Kane", "Ellen")
+		assertNoError(t, store.UpdateProfile("Ellen", User{}))
+
+		requests, err := store.GetFollowRequests("Ellen")
+		assertNoError(t, err)
+		assertEqual(t, len(requests), 0)
+
+		following, err := store.IsFollowing("Kane", "Ellen")
+		assertNoError(t, err)
+		assertEqual(t, following, true)
+
+		profile, _ := store.GetProfile("Ellen")
+		assertEqual(t, profile.FollowerCount, 2)
+	})
+}
+
+func TestDatabaseReplySettings(t *testing.T) {
+	db, err := NewPostgreSQLConnection(os.Getenv("CONN_STR_TEST"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	clearDatabase(db)
+	initializeDatabase(db)
+
+	store := NewPostgreSQLUserStore(db)
+	store.CreateUser("Ellen", "ellen@test", "test")
+	store.CreateUser("Dallas", "dallas@test", "test")
+	id, _ := store.PostSqueak("Ellen", "Bridge crew only")
+
+	t.Run("stores reply settings", func(t *testing.T) {
+		squeak, err := store.GetSqueak(id)
+		assertNoError(t, err)
+		assertEqual(t, squeak.ReplySetting, ReplyEveryone)
+
+		setting := ReplyFollowing
+		assertNoError(t, store.EditSqueak(id, SqueakEdit{ReplySetting: &setting}))
+
+		squeak, err = store.GetSqueak(id)
+		assertNoError(t, err)
+		assertEqual(t, squeak.ReplySetting, ReplyFollowing)
+
+		if err := store.EditSqueak(42, SqueakEdit{ReplySetting: &setting}); !errors.Is(err, ErrSqueakNotFound) {
+			t.Errorf("got error %v, want %v", err, ErrSqueakNotFound)
+		}
+	})
+	t.Run("tells who follows whom", func(t *testing.T) {
+		assertNoError(t, store.FollowUser("Ellen", "Dallas"))
+
+		following, err := store.IsFollowing("Ellen", "Dallas")
+		assertNoError(t, err)
+		assertEqual(t, following, true)
+
+		following, err = store.IsFollowing("Dallas", "Ellen")
+		assertNoError(t, err)
+		assertEqual(t, following, false)
+	})
+}
+
+func TestDatabaseRefreshTokens(t *testing.T) {
+	db, err := NewPostgreSQLConnection(os.Getenv("CONN_STR_TEST"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	clearDatabase(db)
+	initializeDatabase(db)
+
+	store := NewPostgreSQLUserStore(db)
+	store.CreateUser("Ellen", "ellen@test", "test")
+	expiresAt := time.Now().Add(time.Hour)
+
+	t.Run("rotates tokens and revokes the family on reuse", func(t *testing.T) {
+		assertNoError(t, store.CreateRefreshToken("Ellen", "family", "first", expiresAt))
+
+		username, err := store.RotateRefreshToken("first", "second", time.Now(), expiresAt)
+		assertNoError(t, err)
+		assertEqual(t, username, "Ellen")
+
+		if _, err := store.RotateRefreshToken("first", "third", time.Now(), expiresAt); !errors.Is(err, ErrRefreshTokenReused) {
+			t.Errorf("got error %v, want %v", err, ErrRefreshTokenReused)
+		}
+		if _, err := store.RotateRefreshToken("second", "fourth", time.Now(), expiresAt); !errors.Is(err, ErrRefreshTokenInvalid) {
+			t.Errorf("got error %v, want %v", err, ErrRefreshTokenInvalid)
+		}
+	})
+	t.Run("rejects expired and revoked tokens", func(t *testing.T) {
+		assertNoError(t, store.CreateRefreshToken("Ellen", "stale", "stale", time.Now().Add(-time.Minute)))
+		if _, err := store.RotateRefreshToken("stale", "fresh", time.Now(), expiresAt); !errors.Is(err, ErrRefreshTokenInvalid) {
+			t.Errorf("got error %v, want %v", err, ErrRefreshTokenInvalid)
+		}
+
+		assertNoError(t, store.CreateRefreshToken("Ellen", "logout", "logout", expiresAt))
+		assertNoError(t, store.RevokeRefreshTokens("logout"))
+		if _, err := store.RotateRefreshToken("logout", "again", time.Now(), expiresAt); !errors.Is(err, ErrRefreshTokenInvalid) {
+			t.Errorf("got error %v, want %v", err, ErrRefreshTokenInvalid)
+		}
+	})
+	t.Run("uses a token only once when rotated concurrently", func(t *testing.T) {
+		assertNoError(t, store.CreateRefreshToken("Ellen", "race", "race", expiresAt))
+
+		var wg sync.WaitGroup
+		results := make([]error, 10)
+		for i := range results {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				_, results[i] = store.RotateRefreshToken("race", fmt.Sprintf("race-%d", i), time.Now(), expiresAt)
+			}(i)
+		}
+		wg.Wait()
+
+		rotated := 0
+		for _, err := range results {
+			if err == nil {
+				rotated++
+			}
+		}
+		assertEqual(t, rotated, 1)
+	})
 }
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"unicode/utf8"
+)
+
+const (
+	maxDisplayNameLength = 50
+	maxBioLength         = 160
+	maxLocationLength    = 30
+	maxWebsiteLength     = 100
+)
+
+// Profile is the public face of a user, with how many followers, followed
+// users and squeaks they have. Stores keep the counts up to date as they
+// change rather than counting on every request.
+type Profile struct {
+	User
+	FollowerCount  int `json:"followerCount"`
+	FollowingCount int `json:"followingCount"`
+	SqueakCount    int `json:"squeakCount"`
+}
+
+// profileResponse is a Profile as shown to clients, without the private
+// fields of its User.
+type profileResponse struct {
+	PublicUser
+	FollowerCount  int `json:"followerCount"`
+	FollowingCount int `json:"followingCount"`
+	SqueakCount    int `json:"squeakCount"`
+}
+
+func newProfileResponse(profile *Profile) profileResponse {
+	return profileResponse{newPublicUser(profile.User), profile.FollowerCount, profile.FollowingCount, profile.SqueakCount}
+}
+
+// validateProfile checks the length of every profile field of user and
+// that the website is an http or https URL.
+func validateProfile(user User) error {
+	for _, field := range []struct {
+		name, value string
+		max         int
+	}{
+		{"display name", user.DisplayName, maxDisplayNameLength},
+		{"bio", user.Bio, maxBioLength},
+		{"location", user.Location, maxLocationLength},
+		{"website", user.Website, maxWebsiteLength},
+	} {
+		if utf8.RuneCountInString(field.value) > field.max {
+			return fmt.Errorf("%s must not be longer than %d characters", field.name, field.max)
+		}
+	}
+
+	if user.Website != "" {
+		website, err := url.Parse(user.Website)
+		if err != nil || (website.Scheme != "http" && website.Scheme != "https") || website.Host == "" {
+			return errors.New("website must be an http or https URL")
+		}
+	}
+
+	return nil
+}
+
+func (u *UserServer) showProfile(w http.ResponseWriter, r *http.Request) {
+	profile, err := u.store.GetProfile(r.PathValue("name"))
+	if err != nil {
+		http.Error(w, fmt.Sprint(err), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", jsonContentType)
+
+	if err := json.NewEncoder(w).Encode(newProfileResponse(profile)); err != nil {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// updateProfile changes the profile fields given in the request body and
+// leaves the others as they are. An avatarId or headerId of 0 removes the
+// image.
+func (u *UserServer) updateProfile(w http.ResponseWriter, r *http.Request) {
+	user := userFromContext(r.Context())
+
+	var body struct {
+		DisplayName *string `json:"displayName"`
+		Bio         *string `json:"bio"`
+		Location    *string `json:"location"`
+		Website     *string `json:"website"`
+		AvatarID    *int    `json:"avatarId"`
+		HeaderID    *int    `json:"headerId"`
+		Protected   *bool   `json:"protected"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "failed to decode JSON payload", http.StatusBadRequest)
+		return
+	}
+
+	profile, err := u.store.GetProfile(user.Username)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	for _, field := range []struct {
+		value *string
+		to    *string
+	}{
+		{body.DisplayName, &profile.DisplayName},
+		{body.Bio, &profile.Bio},
+		{body.Location, &profile.Location},
+		{body.Website, &profile.Website},
+	} {
+		if field.value != nil {
+			*field.to = *field.value
+		}
+	}
+
+	if body.Protected != nil {
+		profile.Protected = *body.Protected
+	}
+
+	for _, image := range []struct {
+		id *int
+		to **int
+	}{
+		{body.AvatarID, &profile.AvatarID},
+		{body.HeaderID, &profile.HeaderID},
+	} {
+		if image.id == nil {
+			continue
+		}
+		if *image.id == 0 {
+			*image.to = nil
+			continue
+		}
+		if !u.ownsMedia(w, user, *image.id) {
+			return
+		}
+		*image.to = image.id
+	}
+
+	if err := validateProfile(profile.User); err != nil {
+		http.Error(w, fmt.Sprint(err), http.StatusBadRequest)
+		return
+	}
+
+	if err := u.store.UpdateProfile(user.Username, profile.User); err != nil {
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	updated, err := u.store.GetProfile(user.Username)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", jsonContentType)
+	w.WriteHeader(http.StatusAccepted)
+
+	if err := json.NewEncoder(w).Encode(newProfileResponse(updated)); err != nil {
+		log.Println(err)
+	}
+}
+
+// ownsMedia answers the request with 400 and returns false unless media id
+// was uploaded by user.
+func (u *UserServer) ownsMedia(w http.ResponseWriter, user *User, id int) bool {
+	media, err := u.store.GetMedia(id)
+	if err != nil && !errors.Is(err, ErrMediaNotFound) {
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return false
+	}
+
+	if media == nil || media.OwnerID != user.ID {
+		http.Error(w, fmt.Sprintf("media %d cannot be used", id), http.StatusBadRequest)
+		return false
+	}
+
+	return true
+}
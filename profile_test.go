@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func getProfileFromResponse(t testing.TB, body io.Reader) (profile Profile) {
+	t.Helper()
+
+	if err := json.NewDecoder(body).Decode(&profile); err != nil {
+		t.Fatalf("unable to parse response from server %q into Profile, '%v'", body, err)
+	}
+
+	return
+}
+
+func TestProfiles(t *testing.T) {
+	store := NewInMemoryUserStore()
+	server := NewUserServer(store)
+
+	store.CreateUser("Ellen", "ellen@test", "secret")
+	store.CreateUser("Dallas", "dallas@test", "")
+	store.CreateUser("Kane", "kane@test", "")
+
+	ellenToken, _ := generateJWTToken("Ellen")
+	dallasToken, _ := generateJWTToken("Dallas")
+
+	showProfile := func(t testing.TB, name string) Profile {
+		t.Helper()
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newProfileRequest(http.MethodGet, "/users/"+name+"/profile", nil, ""))
+		assertStatus(t, response.Code, http.StatusOK)
+
+		return getProfileFromResponse(t, response.Body)
+	}
+
+	updateProfile := func(body, token string) *httptest.ResponseRecorder {
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newProfileRequest(http.MethodPatch, "/me/profile", []byte(body), token))
+		return response
+	}
+
+	t.Run("returns 404 for unknown users", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newProfileRequest(http.MethodGet, "/users/Ash/profile", nil, ""))
+		assertStatus(t, response.Code, http.StatusNotFound)
+	})
+	t.Run("returns an empty profile without email or password", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newProfileRequest(http.MethodGet, "/users/Ellen/profile", nil, ""))
+		assertStatus(t, response.Code, http.StatusOK)
+
+		body := response.Body.String()
+		if strings.Contains(body, "ellen@test") || strings.Contains(body, "secret") {
+			t.Errorf("profile leaks private fields: %s", body)
+		}
+
+		profile := getProfileFromResponse(t, strings.NewReader(body))
+		assertEqual(t, profile.Username, "Ellen")
+		assertEqual(t, profile.DisplayName, "")
+		assertEqual(t, profile.SqueakCount, 0)
+	})
+	t.Run("requires authentication to update", func(t *testing.T) {
+		assertStatus(t, updateProfile(`{"bio": "Warrant officer"}`, "").Code, http.StatusUnauthorized)
+	})
+	t.Run("updates only the given fields", func(t *testing.T) {
+		response := updateProfile(`{"displayName": "Ellen Ripley", "bio": "Warrant officer", "website": "https://weyland.test"}`, ellenToken)
+		assertStatus(t, response.Code, http.StatusAccepted)
+		assertEqual(t, getProfileFromResponse(t, response.Body).DisplayName, "Ellen Ripley")
+
+		assertStatus(t, updateProfile(`{"location": "Nostromo"}`, ellenToken).Code, http.StatusAccepted)
+
+		profile := showProfile(t, "Ellen")
+		assertEqual(t, profile.DisplayName, "Ellen Ripley")
+		assertEqual(t, profile.Bio, "Warrant officer")
+		assertEqual(t, profile.Location, "Nostromo")
+		assertEqual(t, profile.Website, "https://weyland.test")
+	})
+	t.Run("rejects invalid fields", func(t *testing.T) {
+		for _, body := range []string{
+			`{"displayName": "` + strings.Repeat("x", maxDisplayNameLength+1) + `"}`,
+			`{"bio": "` + strings.Repeat("x", maxBioLength+1) + `"}`,
+			`{"location": "` + strings.Repeat("x", maxLocationLength+1) + `"}`,
+			`{"website": "https://` + strings.Repeat("x", maxWebsiteLength) + `.test"}`,
+			`{"website": "javascript:alert(1)"}`,
+			`{"website": "weyland.test"}`,
+			`{"avatarId": 42}`,
+			`not json`,
+		} {
+			assertStatus(t, updateProfile(body, ellenToken).Code, http.StatusBadRequest)
+		}
+
+		assertEqual(t, showProfile(t, "Ellen").Bio, "Warrant officer")
+	})
+	t.Run("sets and removes avatar and header images", func(t *testing.T) {
+		var ids []int
+		for _, token := range []string{ellenToken, ellenToken, dallasToken} {
+			response := httptest.NewRecorder()
+			server.ServeHTTP(response, newUploadRequest(testImage(t, "png", 40, 40), token))
+			assertStatus(t, response.Code, http.StatusAccepted)
+
+			var media Media
+			assertNoError(t, json.NewDecoder(response.Body).Decode(&media))
+			ids = append(ids, media.ID)
+		}
+
+		assertStatus(t, updateProfile(fmt.Sprintf(`{"avatarId": %d}`, ids[2]), ellenToken).Code, http.StatusBadRequest)
+
+		assertStatus(t, updateProfile(fmt.Sprintf(`{"avatarId": %d, "headerId": %d}`, ids[0], ids[1]), ellenToken).Code, http.StatusAccepted)
+		profile := showProfile(t, "Ellen")
+		assertEqual(t, *profile.AvatarID, ids[0])
+		assertEqual(t, *profile.HeaderID, ids[1])
+
+		assertStatus(t, updateProfile(`{"avatarId": 0}`, ellenToken).Code, http.StatusAccepted)
+		profile = showProfile(t, "Ellen")
+		if profile.AvatarID != nil {
+			t.Errorf("got avatar %d, want none", *profile.AvatarID)
+		}
+		assertEqual(t, *profile.HeaderID, ids[1])
+	})
+	t.Run("counts followers, followed users and squeaks", func(t *testing.T) {
+		store.FollowUser("Dallas", "Ellen")
+		store.FollowUser("Kane", "Ellen")
+		store.FollowUser("Ellen", "Dallas")
+		store.PostSqueak("Ellen", "Final report of the commercial starship Nostromo")
+		id, _ := store.PostSqueak("Ellen", "Signing off")
+
+		profile := showProfile(t, "Ellen")
+		assertEqual(t, profile.FollowerCount, 2)
+		assertEqual(t, profile.FollowingCount, 1)
+		assertEqual(t, profile.SqueakCount, 2)
+
+		store.UnfollowUser("Kane", "Ellen")
+		store.DeleteSqueak(id)
+
+		profile = showProfile(t, "Ellen")
+		assertEqual(t, profile.FollowerCount, 1)
+		assertEqual(t, profile.SqueakCount, 1)
+	})
+}
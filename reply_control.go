@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+)
+
+// Who may reply to a squeak besides its author.
+const (
+	ReplyEveryone  = "everyone"
+	ReplyFollowing = "following"
+	ReplyMentioned = "mentioned"
+)
+
+func validateReplySetting(setting string) error {
+	if !slices.Contains([]string{ReplyEveryone, ReplyFollowing, ReplyMentioned}, setting) {
+		return fmt.Errorf("replySetting must be one of %s, %s or %s", ReplyEveryone, ReplyFollowing, ReplyMentioned)
+	}
+	return nil
+}
+
+// allowedToReply answers the request with 403 and returns false when the
+// reply setting of parent does not let user reply to it. Authors can always
+// reply to their own squeaks.
+func (u *UserServer) allowedToReply(w http.ResponseWriter, user *User, parent *SqueakPost) bool {
+	if user.ID == parent.UserID {
+		return true
+	}
+
+	switch parent.ReplySetting {
+	case ReplyFollowing:
+		following, err := u.store.IsFollowing(parent.Author, user.Username)
+		if err != nil {
+			log.Println(err)
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return false
+		}
+		if !following {
+			http.Error(w, fmt.Sprintf("only people %s follows can reply to this squeak", parent.Author), http.StatusForbidden)
+			return false
+		}
+	case ReplyMentioned:
+		mentioned := slices.ContainsFunc(parent.Mentions, func(mention Mention) bool {
+			return mention.UserID == user.ID
+		})
+		if !mentioned {
+			http.Error(w, "only people mentioned in this squeak can reply to it", http.StatusForbidden)
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestReplySettings(t *testing.T) {
+	store := NewInMemoryUserStore()
+	server := NewUserServer(store)
+
+	store.CreateUser("Ellen", "ellen@test", "")
+	store.CreateUser("Dallas", "dallas@test", "")
+	store.CreateUser("Kane", "kane@test", "")
+
+	ellenToken, _ := generateJWTToken("Ellen")
+	dallasToken, _ := generateJWTToken("Dallas")
+	kaneToken, _ := generateJWTToken("Kane")
+
+	store.FollowUser("Ellen", "Dallas")
+
+	post := func(t testing.TB, body string) SqueakPost {
+		t.Helper()
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newPostSqueakRequestWithJWT("Ellen", []byte(body), ellenToken))
+		assertStatus(t, response.Code, http.StatusAccepted)
+
+		var squeak SqueakPost
+		assertNoError(t, json.NewDecoder(response.Body).Decode(&squeak))
+		return squeak
+	}
+
+	reply := func(id int, token string) *httptest.ResponseRecorder {
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newReplyRequest(id, []byte(`{"text": "Copy that"}`), token))
+		return response
+	}
+
+	t.Run("lets everyone reply by default", func(t *testing.T) {
+		squeak := post(t, `{"text": "Crew meeting in the galley"}`)
+		assertEqual(t, squeak.ReplySetting, ReplyEveryone)
+
+		for _, token := range []string{dallasToken, kaneToken} {
+			assertStatus(t, reply(squeak.ID, token).Code, http.StatusAccepted)
+		}
+	})
+	t.Run("rejects unknown settings", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newPostSqueakRequestWithJWT("Ellen", []byte(`{"text": "Hi", "replySetting": "nobody"}`), ellenToken))
+		assertStatus(t, response.Code, http.StatusBadRequest)
+	})
+	t.Run("lets only people the author follows reply", func(t *testing.T) {
+		squeak := post(t, `{"text": "Bridge crew only", "replySetting": "following"}`)
+		assertEqual(t, squeak.ReplySetting, ReplyFollowing)
+
+		assertStatus(t, reply(squeak.ID, dallasToken).Code, http.StatusAccepted)
+		assertStatus(t, reply(squeak.ID, ellenToken).Code, http.StatusAccepted)
+
+		response := reply(squeak.ID, kaneToken)
+		assertStatus(t, response.Code, http.StatusForbidden)
+		if !strings.Contains(response.Body.String(), "only people Ellen follows can reply") {
+			t.Errorf("got error %q, want it to explain who may reply", response.Body.String())
+		}
+	})
+	t.Run("lets only mentioned people reply", func(t *testing.T) {
+		squeak := post(t, `{"text": "@Kane take a look", "replySetting": "mentioned"}`)
+
+		assertStatus(t, reply(squeak.ID, kaneToken).Code, http.StatusAccepted)
+
+		response := reply(squeak.ID, dallasToken)
+		assertStatus(t, response.Code, http.StatusForbidden)
+		if !strings.Contains(response.Body.String(), "only people mentioned") {
+			t.Errorf("got error %q, want it to explain who may reply", response.Body.String())
+		}
+	})
+	t.Run("changes the setting with an edit", func(t *testing.T) {
+		squeak := post(t, `{"text": "Open channel"}`)
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newEditSqueakRequest(http.MethodPatch, squeak.ID, []byte(`{"replySetting": "mentioned"}`), ellenToken))
+		assertStatus(t, response.Code, http.StatusAccepted)
+
+		var edited SqueakPost
+		assertNoError(t, json.NewDecoder(response.Body).Decode(&edited))
+		assertEqual(t, edited.ReplySetting, ReplyMentioned)
+		assertEqual(t, edited.Text, "Open channel")
+		assertEqual(t, edited.EditedAt == nil, true)
+		assertStatus(t, reply(squeak.ID, kaneToken).Code, http.StatusForbidden)
+
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, newEditSqueakRequest(http.MethodPatch, squeak.ID, []byte(`{"replySetting": "nobody"}`), ellenToken))
+		assertStatus(t, response.Code, http.StatusBadRequest)
+
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, newEditSqueakRequest(http.MethodPatch, squeak.ID, []byte(`{"replySetting": "everyone"}`), dallasToken))
+		assertStatus(t, response.Code, http.StatusForbidden)
+	})
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+const unavailableSqueakText = "squeak unavailable"
+
+// tombstone stands in for a squeak that was deleted, id is 0 when even its
+// ID is gone.
+func tombstone(id int) *SqueakPost {
+	return &SqueakPost{ID: id, Text: unavailableSqueakText, Unavailable: true}
+}
+
+// newResqueak builds the repost of original by the user userID. Resqueaking a
+// plain resqueak reposts the squeak it points at, so chains never form.
+func newResqueak(userID int, original *SqueakPost, quote string) SqueakPost {
+	originalID := original.ID
+	if original.Kind == KindResqueak && original.OriginalID != nil {
+		originalID = *original.OriginalID
+	}
+
+	kind := KindResqueak
+	if quote != "" {
+		kind = KindQuote
+	}
+
+	return SqueakPost{UserID: userID, Text: quote, Kind: kind, OriginalID: &originalID}
+}
+
+// embedOriginals sets Original on every resqueak and quote in squeaks,
+// using a tombstone when the original is not available anymore.
+func (u *UserServer) embedOriginals(squeaks []SqueakPost) error {
+	var ids []int
+	for _, squeak := range squeaks {
+		if squeak.OriginalID != nil {
+			ids = append(ids, *squeak.OriginalID)
+		}
+	}
+
+	originals := map[int]SqueakPost{}
+	if len(ids) > 0 {
+		var err error
+		if originals, err = u.store.GetSqueaksByIDs(ids); err != nil {
+			return err
+		}
+	}
+
+	for i := range squeaks {
+		if squeaks[i].Kind != KindResqueak && squeaks[i].Kind != KindQuote {
+			continue
+		}
+
+		if squeaks[i].OriginalID == nil {
+			squeaks[i].Original = tombstone(0)
+			continue
+		}
+
+		original, ok := originals[*squeaks[i].OriginalID]
+		if !ok {
+			squeaks[i].Original = tombstone(*squeaks[i].OriginalID)
+			continue
+		}
+		squeaks[i].Original = &original
+	}
+
+	return nil
+}
+
+// saveResqueak handles a saveSqueak payload that references an original
+// squeak. A resqueak carries no text of its own, a quote must have some.
+func (u *UserServer) saveResqueak(w http.ResponseWriter, username string, squeak SqueakPost) {
+	if squeak.Kind == "" {
+		squeak.Kind = KindResqueak
+		if squeak.Text != "" {
+			squeak.Kind = KindQuote
+		}
+	}
+
+	switch squeak.Kind {
+	case KindResqueak:
+		if squeak.Text != "" {
+			http.Error(w, "a resqueak cannot have text, post a quote instead", http.StatusBadRequest)
+			return
+		}
+	case KindQuote:
+		if err := validateSqueakText(squeak.Text); err != nil {
+			http.Error(w, fmt.Sprint(err), http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, fmt.Sprintf("a squeak with originalId must be a %s or a %s", KindResqueak, KindQuote), http.StatusBadRequest)
+		return
+	}
+
+	original, err := u.store.GetSqueak(*squeak.OriginalID)
+	if err != nil {
+		if errors.Is(err, ErrSqueakNotFound) {
+			http.Error(w, fmt.Sprint(err), http.StatusNotFound)
+			return
+		}
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if !u.visibleTo(w, username, original) || !u.allowedToInteract(w, username, original.Author) {
+		return
+	}
+
+	id, err := u.store.PostResqueak(username, *squeak.OriginalID, squeak.Text)
+	if err != nil {
+		if errors.Is(err, ErrSqueakNotFound) {
+			http.Error(w, fmt.Sprint(err), http.StatusNotFound)
+			return
+		}
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if squeak, ok := u.respondWithSqueak(w, id); ok {
+		u.afterSqueakPosted(squeak)
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestResqueaks(t *testing.T) {
+	store := NewInMemoryUserStore()
+	server := NewUserServer(store)
+
+	store.CreateUser("Mark", "mark@test", "")
+	store.CreateUser("Harrison", "harrison@test", "")
+	store.FollowUser("Mark", "Harrison")
+	originalID, _ := store.PostSqueak("Mark", "I have a bad feeling about this.")
+
+	token, _ := generateJWTToken("Harrison")
+
+	postSqueak := func(t testing.TB, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newPostSqueakRequestWithJWT("Harrison", []byte(body), token))
+		return response
+	}
+
+	t.Run("Harrison resqueaks Mark's squeak", func(t *testing.T) {
+		response := postSqueak(t, `{"originalId": 1}`)
+
+		assertStatus(t, response.Code, http.StatusAccepted)
+
+		var resqueak SqueakPost
+		if err := json.NewDecoder(response.Body).Decode(&resqueak); err != nil {
+			t.Fatal(err)
+		}
+		assertEqual(t, resqueak.Kind, KindResqueak)
+		assertEqual(t, *resqueak.OriginalID, originalID)
+	})
+	t.Run("Harrison quotes Mark's squeak", func(t *testing.T) {
+		response := postSqueak(t, `{"originalId": 1, "text": "Don't get cocky."}`)
+
+		assertStatus(t, response.Code, http.StatusAccepted)
+
+		var quote SqueakPost
+		if err := json.NewDecoder(response.Body).Decode(&quote); err != nil {
+			t.Fatal(err)
+		}
+		assertEqual(t, quote.Kind, KindQuote)
+	})
+	t.Run("resqueaking a resqueak reposts the original", func(t *testing.T) {
+		id, err := store.PostResqueak("Mark", 2, "")
+		assertNoError(t, err)
+
+		resqueak, _ := store.GetSqueak(id)
+		assertEqual(t, *resqueak.OriginalID, originalID)
+	})
+	t.Run("rejects a resqueak with text", func(t *testing.T) {
+		response := postSqueak(t, `{"originalId": 1, "kind": "resqueak", "text": "Hmm."}`)
+
+		assertStatus(t, response.Code, http.StatusBadRequest)
+	})
+	t.Run("rejects a quote without text", func(t *testing.T) {
+		response := postSqueak(t, `{"originalId": 1, "kind": "quote"}`)
+
+		assertStatus(t, response.Code, http.StatusBadRequest)
+	})
+	t.Run("returns 404 when resqueaking a missing squeak", func(t *testing.T) {
+		response := postSqueak(t, `{"originalId": 42}`)
+
+		assertStatus(t, response.Code, http.StatusNotFound)
+	})
+	t.Run("the timeline embeds the originals", func(t *testing.T) {
+		markToken, _ := generateJWTToken("Mark")
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newTimelineRequest("", markToken))
+
+		page := getSqueakPageFromResponse(t, response.Body)
+		for _, squeak := range page.Squeaks {
+			if squeak.Kind == KindSqueak {
+				continue
+			}
+			if squeak.Original == nil || squeak.Original.Text != "I have a bad feeling about this." {
+				t.Errorf("got original %+v of squeak %d, want Mark's squeak", squeak.Original, squeak.ID)
+			}
+		}
+	})
+}
+
+func TestEmbedOriginals(t *testing.T) {
+	store := NewInMemoryUserStore()
+	server := NewUserServer(store)
+
+	store.CreateUser("Mark", "mark@test", "")
+	store.PostSqueak("Mark", "I have a bad feeling about this.")
+
+	one, missing := 1, 42
+	squeaks := []SqueakPost{
+		{ID: 2, Kind: KindResqueak, OriginalID: &one},
+		{ID: 3, Kind: KindQuote, Text: "Hmm.", OriginalID: &missing},
+		{ID: 4, Kind: KindResqueak},
+		{ID: 5, Kind: KindSqueak, Text: "Plain."},
+	}
+
+	assertNoError(t, server.embedOriginals(squeaks))
+
+	assertEqual(t, squeaks[0].Original.Text, "I have a bad feeling about this.")
+	if !reflect.DeepEqual(*squeaks[1].Original, *tombstone(missing)) {
+		t.Errorf("got original %+v, want a tombstone", squeaks[1].Original)
+	}
+	if !reflect.DeepEqual(*squeaks[2].Original, *tombstone(0)) {
+		t.Errorf("got original %+v, want a tombstone", squeaks[2].Original)
+	}
+	if squeaks[3].Original != nil {
+		t.Errorf("got original %+v for a plain squeak", squeaks[3].Original)
+	}
+}
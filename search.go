@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const maxSearchQueryLength = 200
+
+// Searcher finds squeaks and users matching a free text query, the most
+// relevant first. Results are paged by offset, as relevance has no stable
+// cursor.
+type Searcher interface {
+	SearchSqueaks(query string, offset, limit int) ([]SqueakPost, error)
+	SearchUsers(query string, offset, limit int) ([]User, error)
+}
+
+// WithSearcher makes the server answer searches with searcher instead of
+// its store.
+func WithSearcher(searcher Searcher) ServerOption {
+	return func(u *UserServer) {
+		u.searcher = searcher
+	}
+}
+
+// SearchResults is one page of search results for squeaks and users alike.
+// NextOffset fetches the following page of both and is empty once neither
+// has more results.
+type SearchResults struct {
+	Squeaks    []SqueakPost `json:"squeaks"`
+	Users      []PublicUser `json:"users"`
+	NextOffset string       `json:"nextOffset,omitempty"`
+}
+
+// searchTerms splits text into the lowercase words searches match on.
+func searchTerms(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// parseOffset reads the number of results to skip from the offset query
+// parameter, zero when it is missing.
+func parseOffset(r *http.Request) (int, error) {
+	value := r.URL.Query().Get("offset")
+	if value == "" {
+		return 0, nil
+	}
+
+	offset, err := strconv.Atoi(value)
+	if err != nil || offset < 0 {
+		return 0, errors.New("invalid offset")
+	}
+
+	return offset, nil
+}
+
+func (u *UserServer) search(w http.ResponseWriter, r *http.Request) {
+	if u.searcher == nil {
+		http.Error(w, "search is not available", http.StatusNotImplemented)
+		return
+	}
+
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if len(searchTerms(query)) == 0 || len(query) > maxSearchQueryLength {
+		http.Error(w, fmt.Sprintf("q must contain a word and be at most %d characters long", maxSearchQueryLength), http.StatusBadRequest)
+		return
+	}
+
+	_, limit, err := parsePagination(r)
+	if err != nil {
+		http.Error(w, fmt.Sprint(err), http.StatusBadRequest)
+		return
+	}
+
+	offset, err := parseOffset(r)
+	if err != nil {
+		http.Error(w, fmt.Sprint(err), http.StatusBadRequest)
+		return
+	}
+
+	squeaks, err := u.searcher.SearchSqueaks(query, offset, limit+1)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	users, err := u.searcher.SearchUsers(query, offset, limit+1)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	results := SearchResults{Squeaks: squeaks}
+	if len(squeaks) > limit || len(users) > limit {
+		results.NextOffset = strconv.Itoa(offset + limit)
+	}
+	results.Squeaks = squeaks[:min(len(squeaks), limit)]
+	users = users[:min(len(users), limit)]
+
+	viewer := userFromContext(r.Context())
+
+	results.Squeaks, err = u.prepareSqueaks(viewer, results.Squeaks)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if viewer != nil {
+		hidden, err := u.store.GetHiddenUsers(viewer.Username)
+		if err != nil {
+			log.Println(err)
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		visible := users[:0]
+		for _, user := range users {
+			if !hidden[user.ID] {
+				visible = append(visible, user)
+			}
+		}
+		users = visible
+	}
+	results.Users = newPublicUsers(users)
+
+	w.Header().Set("Content-Type", jsonContentType)
+
+	if err := json.NewEncoder(w).Encode(results); err != nil {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+}
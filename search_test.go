@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestSearchTerms(t *testing.T) {
+	got := searchTerms("Use the #Force, Luke! It's 2024.")
+	want := []string{"use", "the", "force", "luke", "it", "s", "2024"}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q want %q", got, want)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	store := NewInMemoryUserStore()
+	server := NewUserServer(store)
+
+	store.CreateUser("Luke", "luke@test", "")
+	store.CreateUser("Lukas", "lukas@test", "")
+	store.CreateUser("Vader", "vader@test", "")
+	store.PostSqueak("Luke", "The force is strong")
+	store.PostSqueak("Vader", "Feel the force, the force flows through you")
+	edited, _ := store.PostSqueak("Luke", "A force typo")
+	deleted, _ := store.PostSqueak("Vader", "Force choke")
+	store.PostSqueak("Luke", "Nothing to see here")
+	store.DeleteSqueak(deleted)
+	store.EditSqueak(edited, textEdit("Fixed it"))
+
+	search := func(t *testing.T, query string) SearchResults {
+		t.Helper()
+		request, _ := http.NewRequest(http.MethodGet, "/search?"+query, nil)
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertContentType(t, response, jsonContentType)
+
+		var results SearchResults
+		if err := json.NewDecoder(response.Body).Decode(&results); err != nil {
+			t.Fatal(err)
+		}
+		return results
+	}
+
+	t.Run("ranks squeaks by relevance", func(t *testing.T) {
+		results := search(t, "q=Force")
+
+		assertSqueaks(t, results.Squeaks, []SqueakPost{
+			{Text: "Feel the force, the force flows through you"},
+			{Text: "The force is strong"},
+		})
+	})
+	t.Run("matches every word", func(t *testing.T) {
+		results := search(t, "q="+url.QueryEscape("strong force"))
+
+		assertSqueaks(t, results.Squeaks, []SqueakPost{{Text: "The force is strong"}})
+	})
+	t.Run("finds users by username", func(t *testing.T) {
+		results := search(t, "q=luk")
+
+		assertEqual(t, len(results.Users), 2)
+		assertEqual(t, results.Users[0].Username, "Luke")
+		assertEqual(t, results.Users[1].Username, "Lukas")
+		assertEqual(t, len(results.Squeaks), 0)
+	})
+	t.Run("paginates results", func(t *testing.T) {
+		results := search(t, "q=force&limit=1")
+		assertSqueaks(t, results.Squeaks, []SqueakPost{{Text: "Feel the force, the force flows through you"}})
+
+		results = search(t, "q=force&limit=1&offset="+results.NextOffset)
+		assertSqueaks(t, results.Squeaks, []SqueakPost{{Text: "The force is strong"}})
+		assertEqual(t, results.NextOffset, "")
+	})
+	t.Run("hides blocked users", func(t *testing.T) {
+		store.BlockUser("Luke", "Vader")
+		token, _ := generateJWTToken("Luke")
+
+		request, _ := http.NewRequest(http.MethodGet, "/search?q=force", nil)
+		request.Header.Set("Cookie", "Authorization="+token)
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+
+		var results SearchResults
+		json.NewDecoder(response.Body).Decode(&results)
+		assertSqueaks(t, results.Squeaks, []SqueakPost{{Text: "The force is strong"}})
+	})
+	t.Run("rejects an empty query", func(t *testing.T) {
+		request, _ := http.NewRequest(http.MethodGet, "/search?q=%23%21", nil)
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusBadRequest)
+	})
+	t.Run("rejects an invalid offset", func(t *testing.T) {
+		request, _ := http.NewRequest(http.MethodGet, "/search?q=force&offset=-1", nil)
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusBadRequest)
+	})
+	t.Run("is unavailable without a searcher", func(t *testing.T) {
+		server := NewUserServer(&StubUserStore{})
+
+		request, _ := http.NewRequest(http.MethodGet, "/search?q=force", nil)
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusNotImplemented)
+	})
+}
@@ -8,17 +8,34 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/golang-jwt/jwt/v5"
 	"golang.org/x/crypto/bcrypt"
 )
 
 type UserServer struct {
-	store UserStore
+	store    UserStore
+	broker   Broker
+	searcher Searcher
+	blobs    BlobStore
 	http.Handler
 }
 
+// ServerOption configures optional parts of a UserServer.
+type ServerOption func(*UserServer)
+
+// WithBroker makes the server publish new squeaks through broker instead of
+// an in-process MemoryBroker.
+func WithBroker(broker Broker) ServerOption {
+	return func(u *UserServer) {
+		u.broker = broker
+	}
+}
+
 type User struct {
 	ID        int          `json:"id"`
 	Username  string       `json:"username"`
@@ -26,25 +43,229 @@ type User struct {
 	Password  string       `json:"password"`
 	Squeaks   []SqueakPost `json:"squeaks"`
 	CreatedAt time.Time    `json:"createdAt"`
+	// The profile fields are only filled in by GetProfile. AvatarID and
+	// HeaderID name uploaded media.
+	DisplayName string `json:"displayName,omitempty"`
+	Bio         string `json:"bio,omitempty"`
+	Location    string `json:"location,omitempty"`
+	Website     string `json:"website,omitempty"`
+	AvatarID    *int   `json:"avatarId,omitempty"`
+	HeaderID    *int   `json:"headerId,omitempty"`
+	// PinnedSqueakID is the squeak shown first among the user's squeaks.
+	PinnedSqueakID *int `json:"pinnedSqueakId,omitempty"`
+	// Protected accounts only show their squeaks to followers they
+	// approved.
+	Protected bool `json:"protected,omitempty"`
+}
+
+// PublicUser is what is shown of a user in listings of other users, such as
+// followers, leaving out their email, password and squeaks.
+type PublicUser struct {
+	ID             int       `json:"id"`
+	Username       string    `json:"username"`
+	CreatedAt      time.Time `json:"createdAt"`
+	DisplayName    string    `json:"displayName,omitempty"`
+	Bio            string    `json:"bio,omitempty"`
+	Location       string    `json:"location,omitempty"`
+	Website        string    `json:"website,omitempty"`
+	AvatarID       *int      `json:"avatarId,omitempty"`
+	HeaderID       *int      `json:"headerId,omitempty"`
+	PinnedSqueakID *int      `json:"pinnedSqueakId,omitempty"`
+	Protected      bool      `json:"protected,omitempty"`
+}
+
+func newPublicUser(user User) PublicUser {
+	return PublicUser{
+		ID: user.ID, Username: user.Username, CreatedAt: user.CreatedAt,
+		DisplayName: user.DisplayName, Bio: user.Bio, Location: user.Location, Website: user.Website,
+		AvatarID: user.AvatarID, HeaderID: user.HeaderID, PinnedSqueakID: user.PinnedSqueakID, Protected: user.Protected,
+	}
+}
+
+func newPublicUsers(users []User) []PublicUser {
+	public := make([]PublicUser, len(users))
+	for i, user := range users {
+		public[i] = newPublicUser(user)
+	}
+	return public
 }
 
 // Squeaks are Gopher's variant of tweets
 type SqueakPost struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"userId"`
+	Author    string    `json:"author"`
+	Text      string    `json:"text"`
+	CreatedAt time.Time `json:"createdAt"`
+	ParentID  *int      `json:"parentId,omitempty"`
+	RootID    *int      `json:"rootId,omitempty"`
+	LikeCount int       `json:"likeCount"`
+	// LikedByMe is only set when the squeak is shown to an authenticated user.
+	LikedByMe *bool `json:"likedByMe,omitempty"`
+	// Kind tells plain squeaks from resqueaks and quotes of the squeak
+	// OriginalID, which is embedded as Original when shown.
+	Kind        string      `json:"kind"`
+	OriginalID  *int        `json:"originalId,omitempty"`
+	Original    *SqueakPost `json:"original,omitempty"`
+	Unavailable bool        `json:"unavailable,omitempty"`
+	EditedAt    *time.Time  `json:"editedAt,omitempty"`
+	Mentions    []Mention   `json:"mentions,omitempty"`
+	Poll        *Poll       `json:"poll,omitempty"`
+	// MediaIDs names uploads to attach to a new squeak, which is shown with
+	// them as Media.
+	MediaIDs []int   `json:"mediaIds,omitempty"`
+	Media    []Media `json:"media,omitempty"`
+	// ContentWarning summarises what readers may not want to see without
+	// warning, and Sensitive flags the squeak's media. Collapsed tells that
+	// the server hid what either covers, following the viewer's preference.
+	ContentWarning string `json:"contentWarning,omitempty"`
+	Sensitive      bool   `json:"sensitive,omitempty"`
+	Collapsed      bool   `json:"collapsed,omitempty"`
+	// Pinned is set on the squeak its author pinned when it leads their
+	// squeaks.
+	Pinned bool `json:"pinned,omitempty"`
+	// ReplySetting tells who besides the author may reply, everyone unless
+	// given when posting.
+	ReplySetting string `json:"replySetting,omitempty"`
+}
+
+// SqueakRevision is one version of a squeak's text and when it was written.
+type SqueakRevision struct {
 	Text      string    `json:"text"`
 	CreatedAt time.Time `json:"createdAt"`
 }
 
-func NewUserServer(store UserStore) *UserServer {
+const (
+	KindSqueak   = "squeak"
+	KindResqueak = "resqueak"
+	KindQuote    = "quote"
+)
+
+// maxSqueakLength matches the size of the text column of the squeak table.
+const maxSqueakLength = 255
+
+var ErrSqueakNotFound = errors.New("squeak not found")
+
+func validateSqueakText(text string) error {
+	if strings.TrimSpace(text) == "" {
+		return errors.New("squeak text must not be empty")
+	}
+	if utf8.RuneCountInString(text) > maxSqueakLength {
+		return fmt.Errorf("squeak text must not be longer than %d characters", maxSqueakLength)
+	}
+	return nil
+}
+
+// SqueakPage is one page of a feed, newest squeak first. NextCursor is
+// passed back as the cursor query parameter to fetch the following page
+// and is empty on the last one.
+type SqueakPage struct {
+	Squeaks    []SqueakPost `json:"squeaks"`
+	NextCursor string       `json:"nextCursor,omitempty"`
+}
+
+// TimelineMode selects how a store assembles home timelines.
+type TimelineMode int
+
+const (
+	// FanOutOnRead merges the squeaks of followed users when a timeline is read.
+	FanOutOnRead TimelineMode = iota
+	// FanOutOnWrite copies each new squeak into the precomputed timelines
+	// of the author and their followers when it is posted.
+	FanOutOnWrite
+)
+
+func parseTimelineMode(mode string) (TimelineMode, error) {
+	switch mode {
+	case "", "read":
+		return FanOutOnRead, nil
+	case "write":
+		return FanOutOnWrite, nil
+	default:
+		return 0, fmt.Errorf("unknown timeline mode %q, use \"read\" or \"write\"", mode)
+	}
+}
+
+func NewUserServer(store UserStore, options ...ServerOption) *UserServer {
 	u := new(UserServer)
 
 	u.store = store
+	u.broker = NewMemoryBroker()
+	u.searcher, _ = store.(Searcher)
+	u.blobs = NewMemoryBlobStore()
+	for _, option := range options {
+		option(u)
+	}
 
 	router := http.NewServeMux()
-	router.Handle("/userbase", http.HandlerFunc(u.userbaseHandler))
-	router.Handle("GET /users/{name}", http.HandlerFunc(u.showSqueaks))
+	router.Handle("/userbase", u.withOptionalAuthentication(http.HandlerFunc(u.userbaseHandler)))
+	router.Handle("GET /users/{name}", u.withOptionalAuthentication(http.HandlerFunc(u.showSqueaks)))
 	router.Handle("POST /users/{name}", u.requiresAuthentication(http.HandlerFunc(u.saveSqueak)))
+	router.Handle("POST /users/{name}/follow", u.requiresAuthentication(http.HandlerFunc(u.followUser)))
+	router.Handle("DELETE /users/{name}/follow", u.requiresAuthentication(http.HandlerFunc(u.unfollowUser)))
+	router.Handle("GET /me/follow-requests", u.requiresAuthentication(http.HandlerFunc(u.showFollowRequests)))
+	router.Handle("POST /me/follow-requests/{name}/accept", u.requiresAuthentication(u.answerFollowRequest(u.store.AcceptFollowRequest, true)))
+	router.Handle("POST /me/follow-requests/{name}/reject", u.requiresAuthentication(u.answerFollowRequest(u.store.RejectFollowRequest, false)))
+	router.Handle("GET /users/{name}/followers", http.HandlerFunc(u.showFollowers))
+	router.Handle("GET /users/{name}/following", http.HandlerFunc(u.showFollowing))
+	router.Handle("GET /timeline", u.requiresAuthentication(http.HandlerFunc(u.showTimeline)))
+	router.Handle("POST /squeaks/{id}/replies", u.requiresAuthentication(http.HandlerFunc(u.postReply)))
+	router.Handle("GET /squeaks/{id}/thread", u.withOptionalAuthentication(http.HandlerFunc(u.showThread)))
+	router.Handle("PUT /squeaks/{id}/like", u.requiresAuthentication(http.HandlerFunc(u.likeSqueak)))
+	router.Handle("DELETE /squeaks/{id}/like", u.requiresAuthentication(http.HandlerFunc(u.unlikeSqueak)))
+	router.Handle("POST /squeaks/{id}/vote", u.requiresAuthentication(http.HandlerFunc(u.voteInPoll)))
+	router.Handle("GET /squeaks/{id}/likes", u.withOptionalAuthentication(http.HandlerFunc(u.showLikes)))
+	router.Handle("PATCH /squeaks/{id}", u.requiresAuthentication(u.requiresSqueakAuthor(http.HandlerFunc(u.editSqueak))))
+	router.Handle("DELETE /squeaks/{id}", u.requiresAuthentication(u.requiresSqueakAuthor(http.HandlerFunc(u.deleteSqueak))))
+	router.Handle("PUT /squeaks/{id}/pin", u.requiresAuthentication(u.requiresSqueakAuthor(http.HandlerFunc(u.pinSqueak))))
+	router.Handle("DELETE /squeaks/{id}/pin", u.requiresAuthentication(http.HandlerFunc(u.unpinSqueak)))
+	router.Handle("GET /squeaks/{id}/history", u.withOptionalAuthentication(http.HandlerFunc(u.showSqueakHistory)))
+	router.Handle("GET /tags/{tag}", u.withOptionalAuthentication(http.HandlerFunc(u.showTagFeed)))
+	router.Handle("GET /trending/tags", http.HandlerFunc(u.showTrendingTags))
+	router.Handle("GET /me/mentions", u.requiresAuthentication(http.HandlerFunc(u.showMentions)))
+	router.Handle("GET /notifications", u.requiresAuthentication(http.HandlerFunc(u.showNotifications)))
+	router.Handle("POST /notifications/read", u.requiresAuthentication(http.HandlerFunc(u.markNotificationsRead)))
+	router.Handle("GET /stream", u.requiresAuthentication(http.HandlerFunc(u.streamSqueaks)))
+	router.Handle("GET /ws", u.requiresAuthentication(http.HandlerFunc(u.serveLive)))
+	router.Handle("POST /conversations", u.requiresAuthentication(http.HandlerFunc(u.openConversation)))
+	router.Handle("GET /conversations", u.requiresAuthentication(http.HandlerFunc(u.showConversations)))
+	router.Handle("GET /conversations/{id}/messages", u.requiresAuthentication(u.requiresConversationParticipant(http.HandlerFunc(u.showMessages))))
+	router.Handle("POST /conversations/{id}/messages", u.requiresAuthentication(u.requiresConversationParticipant(http.HandlerFunc(u.sendMessage))))
+	router.Handle("POST /conversations/{id}/read", u.requiresAuthentication(u.requiresConversationParticipant(http.HandlerFunc(u.markConversationRead))))
+	router.Handle("POST /users/{name}/block", u.requiresAuthentication(u.changeRelation(u.store.BlockUser)))
+	router.Handle("DELETE /users/{name}/block", u.requiresAuthentication(u.changeRelation(u.store.UnblockUser)))
+	router.Handle("POST /users/{name}/mute", u.requiresAuthentication(u.changeRelation(u.store.MuteUser)))
+	router.Handle("DELETE /users/{name}/mute", u.requiresAuthentication(u.changeRelation(u.store.UnmuteUser)))
+	router.Handle("GET /me/blocked", u.requiresAuthentication(u.showRelation(u.store.GetBlockedUsers)))
+	router.Handle("GET /me/muted", u.requiresAuthentication(u.showRelation(u.store.GetMutedUsers)))
+	router.Handle("PUT /squeaks/{id}/bookmark", u.requiresAuthentication(http.HandlerFunc(u.bookmarkSqueak)))
+	router.Handle("DELETE /squeaks/{id}/bookmark", u.requiresAuthentication(http.HandlerFunc(u.unbookmarkSqueak)))
+	router.Handle("GET /bookmarks", u.requiresAuthentication(http.HandlerFunc(u.showBookmarks)))
+	router.Handle("POST /lists", u.requiresAuthentication(http.HandlerFunc(u.createList)))
+	router.Handle("GET /users/{name}/lists", u.withOptionalAuthentication(http.HandlerFunc(u.showLists)))
+	router.Handle("GET /lists/{id}", u.withOptionalAuthentication(u.requiresListAccess(http.HandlerFunc(u.showList))))
+	router.Handle("PATCH /lists/{id}", u.requiresAuthentication(u.requiresListAccess(u.requiresListOwner(http.HandlerFunc(u.updateList)))))
+	router.Handle("DELETE /lists/{id}", u.requiresAuthentication(u.requiresListAccess(u.requiresListOwner(http.HandlerFunc(u.deleteList)))))
+	router.Handle("GET /lists/{id}/members", u.withOptionalAuthentication(u.requiresListAccess(http.HandlerFunc(u.showListMembers))))
+	router.Handle("PUT /lists/{id}/members/{name}", u.requiresAuthentication(u.requiresListAccess(u.requiresListOwner(u.changeListMember(u.store.AddListMember)))))
+	router.Handle("DELETE /lists/{id}/members/{name}", u.requiresAuthentication(u.requiresListAccess(u.requiresListOwner(u.changeListMember(u.store.RemoveListMember)))))
+	router.Handle("GET /lists/{id}/timeline", u.withOptionalAuthentication(u.requiresListAccess(http.HandlerFunc(u.showListTimeline))))
+	router.Handle("POST /media", u.requiresAuthentication(http.HandlerFunc(u.uploadMedia)))
+	router.Handle("GET /media/{id}", u.withOptionalAuthentication(u.serveMedia(false)))
+	router.Handle("GET /media/{id}/thumbnail", u.withOptionalAuthentication(u.serveMedia(true)))
+	router.Handle("POST /drafts", u.requiresAuthentication(http.HandlerFunc(u.saveDraft)))
+	router.Handle("GET /drafts", u.requiresAuthentication(http.HandlerFunc(u.showDrafts)))
+	router.Handle("PATCH /drafts/{id}", u.requiresAuthentication(u.requiresDraftAuthor(http.HandlerFunc(u.editDraft))))
+	router.Handle("DELETE /drafts/{id}", u.requiresAuthentication(u.requiresDraftAuthor(http.HandlerFunc(u.cancelDraft))))
+	router.Handle("GET /me/preferences", u.requiresAuthentication(http.HandlerFunc(u.showPreferences)))
+	router.Handle("PUT /me/preferences", u.requiresAuthentication(http.HandlerFunc(u.updatePreferences)))
+	router.Handle("GET /users/{name}/profile", http.HandlerFunc(u.showProfile))
+	router.Handle("PATCH /me/profile", u.requiresAuthentication(http.HandlerFunc(u.updateProfile)))
+	router.Handle("GET /search", u.withOptionalAuthentication(http.HandlerFunc(u.search)))
 	router.Handle("/register", http.HandlerFunc(u.registerUser))
 	router.Handle("/login", http.HandlerFunc(u.loginUser))
+	router.Handle("POST /auth/refresh", http.HandlerFunc(u.refreshSession))
+	router.Handle("POST /auth/logout", http.HandlerFunc(u.logout))
 
 	u.Handler = router
 
@@ -54,10 +275,226 @@ func NewUserServer(store UserStore) *UserServer {
 type UserStore interface {
 	GetUserSqueaks(name string) ([]SqueakPost, error)
 	PostSqueak(name, squeak string) (int, error)
+	// CreateSqueak stores a squeak by author together with its poll, the
+	// media squeak.MediaIDs, none attached yet, its content flags and reply
+	// setting, storing nothing when any of them fails.
+	CreateSqueak(author string, squeak SqueakPost) (int, error)
+	// VoteInPoll records name's vote for option of the poll on squeak id,
+	// returning ErrAlreadyVoted when they have voted in it before.
+	VoteInPoll(name string, id, option int) error
+	// GetPollVotes reports the option name voted for in each poll on the
+	// squeaks ids they have voted in.
+	GetPollVotes(name string, ids []int) (map[int]int, error)
+	// CreateMedia records an upload by owner whose bytes are in the
+	// BlobStore under media.Key.
+	CreateMedia(owner string, media Media) (int, error)
+	// GetMedia returns ErrMediaNotFound when there is no media id.
+	GetMedia(id int) (*Media, error)
+	// CreateDraft saves a draft by name, scheduled when publishAt is set.
+	CreateDraft(name, text string, publishAt *time.Time) (int, error)
+	// GetDraft returns ErrDraftNotFound when there is no draft id, including
+	// once it has been published.
+	GetDraft(id int) (*Draft, error)
+	// GetDrafts lists the drafts of name, oldest first.
+	GetDrafts(name string) ([]Draft, error)
+	UpdateDraft(id int, text string, publishAt *time.Time) error
+	DeleteDraft(id int) error
+	// PublishDueDrafts posts up to limit drafts scheduled at or before now as
+	// squeaks, removes them and returns the IDs of the new squeaks. Each
+	// draft is published by one caller only, however many call at once.
+	PublishDueDrafts(now time.Time, limit int) ([]int, error)
 	GetUserbase() ([]User, error)
 	CreateUser(name, email, password string) (int, error)
 	GetUserByUsername(username string) (*User, error)
 	GetUserByID(id int) (*User, error)
+	// CreateRefreshToken stores the hash of a refresh token of name that
+	// starts or continues the token family.
+	CreateRefreshToken(name, family, hash string, expiresAt time.Time) error
+	// RotateRefreshToken uses up the refresh token with hash and stores
+	// newHash in its place in the same family, returning whose it is. A
+	// token that is unknown, expired or revoked gives ErrRefreshTokenInvalid.
+	// One used before gives ErrRefreshTokenReused and revokes its family.
+	// A token is only used once, however many rotate it at once.
+	RotateRefreshToken(hash, newHash string, now, expiresAt time.Time) (string, error)
+	// RevokeRefreshTokens revokes the family of the token with hash.
+	RevokeRefreshTokens(hash string) error
+	FollowUser(follower, followee string) error
+	// IsFollowing reports whether follower follows followee.
+	IsFollowing(follower, followee string) (bool, error)
+	// UnfollowUser also withdraws a pending follow request.
+	UnfollowUser(follower, followee string) error
+	GetFollowers(name string) ([]User, error)
+	GetFollowing(name string) ([]User, error)
+	// GetTimeline returns up to limit squeaks by name and the users they follow,
+	// newest first, starting below the squeak ID cursor (0 starts from the newest).
+	GetTimeline(name string, cursor, limit int) ([]SqueakPost, error)
+	// GetSqueak returns ErrSqueakNotFound when there is no squeak with the id
+	// or it has been deleted.
+	GetSqueak(id int) (*SqueakPost, error)
+	// PostReply stores a reply to the squeak parentID in the same conversation.
+	PostReply(name string, parentID int, squeak string) (int, error)
+	// GetConversation returns the root squeak rootID and every reply in its
+	// conversation, oldest first. Deleted squeaks are included as Unavailable
+	// so the shape of the conversation is kept.
+	GetConversation(rootID int) ([]SqueakPost, error)
+	LikeSqueak(name string, id int) error
+	UnlikeSqueak(name string, id int) error
+	GetSqueakLikes(id int) ([]User, error)
+	// GetLikedSqueaks reports which of the squeaks ids name has liked.
+	GetLikedSqueaks(name string, ids []int) (map[int]bool, error)
+	// PostResqueak reposts the squeak originalID, as a quote when quote is not empty.
+	PostResqueak(name string, originalID int, quote string) (int, error)
+	// GetSqueaksByIDs returns the squeaks that exist among ids, keyed by ID.
+	GetSqueaksByIDs(ids []int) (map[int]SqueakPost, error)
+	// EditSqueak applies every change in edit to squeak id at once. A new
+	// text keeps the text it replaces as a revision.
+	EditSqueak(id int, edit SqueakEdit) error
+	// GetPreferences returns the defaults for users who never set any.
+	GetPreferences(name string) (*Preferences, error)
+	UpdatePreferences(name string, preferences Preferences) error
+	// GetProfile returns the profile of name without email or password.
+	GetProfile(name string) (*Profile, error)
+	// UpdateProfile replaces the profile fields of name with those of user.
+	// Pending follow requests are accepted once name is not protected.
+	UpdateProfile(name string, user User) error
+	// PinSqueak pins squeak id, which must be by name, to their profile.
+	PinSqueak(name string, id int) error
+	// UnpinSqueak clears the pin of name if it is on squeak id.
+	UnpinSqueak(name string, id int) error
+	// RequestFollow asks followee to accept follower, reporting whether
+	// follower follows them already, in which case nothing is asked.
+	RequestFollow(follower, followee string) (bool, error)
+	// GetFollowRequests returns the users waiting for name to answer their
+	// request, most recent first.
+	GetFollowRequests(name string) ([]User, error)
+	// AcceptFollowRequest makes follower follow name and RejectFollowRequest
+	// drops the request. Both return ErrFollowRequestNotFound without one.
+	AcceptFollowRequest(name, follower string) error
+	RejectFollowRequest(name, follower string) error
+	// GetProtectedUsers reports which of the users ids are protected and
+	// hide their squeaks from name, as they are neither name nor followed by
+	// them. name is empty for anonymous viewers.
+	GetProtectedUsers(name string, ids []int) (map[int]bool, error)
+	DeleteSqueak(id int) error
+	// GetSqueakHistory returns every version of squeak id, oldest first,
+	// ending with the current one.
+	GetSqueakHistory(id int) ([]SqueakRevision, error)
+	// GetTaggedSqueaks pages through the squeaks tagged with the normalised
+	// tag like GetTimeline does.
+	GetTaggedSqueaks(tag string, cursor, limit int) ([]SqueakPost, error)
+	// GetTrendingTags returns the limit tags used by most squeaks posted after since.
+	GetTrendingTags(since time.Time, limit int) ([]TagCount, error)
+	// GetMentioningSqueaks pages through the squeaks mentioning name like
+	// GetTimeline does.
+	GetMentioningSqueaks(name string, cursor, limit int) ([]SqueakPost, error)
+	// AddNotification records that actor did something of kind to name,
+	// grouping it into name's unread notification of that kind about the
+	// same squeak when there is one.
+	AddNotification(name, actor, kind string, squeakID *int) error
+	// GetNotifications pages through name's notifications like GetTimeline
+	// does, only unread ones when unread is set.
+	GetNotifications(name string, unread bool, cursor, limit int) ([]Notification, error)
+	// MarkNotificationsRead marks name's notifications with the given ids
+	// read, or all of them when ids is empty.
+	MarkNotificationsRead(name string, ids []int) error
+	// GetSqueaksAfter returns up to limit squeaks of the named users with an
+	// ID above after, oldest first.
+	GetSqueaksAfter(names []string, after, limit int) ([]SqueakPost, error)
+	// BlockUser also ends any following and follow requests between the
+	// two users.
+	BlockUser(blocker, blocked string) error
+	UnblockUser(blocker, blocked string) error
+	// IsBlocked reports whether either of the two users blocks the other.
+	IsBlocked(name, other string) (bool, error)
+	GetBlockedUsers(name string) ([]User, error)
+	MuteUser(muter, muted string) error
+	UnmuteUser(muter, muted string) error
+	GetMutedUsers(name string) ([]User, error)
+	// GetHiddenUsers returns the IDs of the users whose content name must
+	// not see: those name blocks or mutes and those blocking name.
+	GetHiddenUsers(name string) (map[int]bool, error)
+	// BookmarkSqueak saves squeak id for name, doing nothing when it is
+	// saved already.
+	BookmarkSqueak(name string, id int) error
+	UnbookmarkSqueak(name string, id int) error
+	// GetBookmarks pages through name's bookmarks by bookmark ID, most
+	// recently saved first. Deleted squeaks are included as Unavailable.
+	GetBookmarks(name string, cursor, limit int) ([]Bookmark, error)
+	CreateList(owner, name string, private bool) (int, error)
+	// GetList returns ErrListNotFound when there is no list id.
+	GetList(id int) (*List, error)
+	// GetLists returns the lists owned by owner, oldest first, leaving out
+	// private ones unless includePrivate is set.
+	GetLists(owner string, includePrivate bool) ([]List, error)
+	UpdateList(id int, name string, private bool) error
+	DeleteList(id int) error
+	// AddListMember adds name to list id, doing nothing when they are a
+	// member already.
+	AddListMember(id int, name string) error
+	RemoveListMember(id int, name string) error
+	GetListMembers(id int) ([]User, error)
+	// GetListTimeline pages through the squeaks of list id's members like
+	// GetTimeline.
+	GetListTimeline(id, cursor, limit int) ([]SqueakPost, error)
+	// CreateDirectConversation starts a conversation between creator and
+	// participants, or returns the existing one-to-one conversation of the
+	// two users.
+	CreateDirectConversation(creator string, participants []string) (int, error)
+	// GetDirectConversation returns ErrConversationNotFound for an unknown id.
+	GetDirectConversation(id int) (*DirectConversation, error)
+	// GetDirectConversations lists name's conversations, the most recently
+	// active first, counting the messages name has not read.
+	GetDirectConversations(name string) ([]DirectConversation, error)
+	// PostDirectMessage also marks the conversation read for the sender.
+	PostDirectMessage(name string, conversationID int, text string) (int, error)
+	// GetDirectMessages pages through a conversation like GetTimeline does.
+	GetDirectMessages(conversationID, cursor, limit int) ([]DirectMessage, error)
+	// MarkDirectMessagesRead moves name's read receipt in the conversation
+	// forward to messageID.
+	MarkDirectMessagesRead(name string, conversationID, messageID int) error
+}
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// parsePagination reads the cursor and limit query parameters of a feed request.
+func parsePagination(r *http.Request) (cursor, limit int, err error) {
+	limit = defaultPageSize
+
+	if value := r.URL.Query().Get("cursor"); value != "" {
+		cursor, err = strconv.Atoi(value)
+		if err != nil || cursor < 0 {
+			return 0, 0, errors.New("invalid cursor")
+		}
+	}
+
+	if value := r.URL.Query().Get("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxPageSize {
+			return 0, 0, fmt.Errorf("limit must be between 1 and %d", maxPageSize)
+		}
+	}
+
+	return cursor, limit, nil
+}
+
+// newSqueakPage builds a page from squeaks fetched with limit+1, using the
+// extra squeak only to tell whether there is a next page. It has to run
+// before prepareSqueaks, which may leave squeaks out.
+func newSqueakPage(squeaks []SqueakPost, limit int) SqueakPage {
+	page := SqueakPage{Squeaks: squeaks}
+	if page.Squeaks == nil {
+		page.Squeaks = []SqueakPost{}
+	}
+
+	if len(squeaks) > limit {
+		page.Squeaks = squeaks[:limit]
+		page.NextCursor = strconv.Itoa(squeaks[limit-1].ID)
+	}
+
+	return page
 }
 
 const jsonContentType = "application/json"
@@ -70,6 +507,41 @@ func (u *UserServer) userbaseHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	viewer := userFromContext(r.Context())
+	hidden := map[int]bool{}
+	if viewer != nil {
+		if hidden, err = u.store.GetHiddenUsers(viewer.Username); err != nil {
+			log.Println(err)
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	collapsed, err := u.collapseRequested(r)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	visible := userbase[:0]
+	for _, user := range userbase {
+		if hidden[user.ID] {
+			continue
+		}
+		user.Squeaks, err = u.prepareSqueaks(viewer, user.Squeaks)
+		if err != nil {
+			log.Println(err)
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+		if collapsed {
+			collapseFlagged(user.Squeaks)
+		}
+		visible = append(visible, user)
+	}
+	userbase = visible
+
 	if err := json.NewEncoder(w).Encode(userbase); err != nil {
 		http.Error(w, "internal server error", http.StatusInternalServerError)
 		return
@@ -85,6 +557,29 @@ func (u *UserServer) showSqueaks(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	profile, err := u.store.GetProfile(user)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	squeaks = pinFirst(squeaks, profile.PinnedSqueakID)
+
+	squeaks, err = u.prepareSqueaks(userFromContext(r.Context()), squeaks)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if collapsed, err := u.collapseRequested(r); err != nil {
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	} else if collapsed {
+		collapseFlagged(squeaks)
+	}
+
 	w.Header().Set("Content-Type", jsonContentType)
 
 	if err := json.NewEncoder(w).Encode(squeaks); err != nil {
@@ -95,6 +590,11 @@ func (u *UserServer) showSqueaks(w http.ResponseWriter, r *http.Request) {
 
 func (u *UserServer) saveSqueak(w http.ResponseWriter, r *http.Request) {
 	username := r.PathValue("name")
+	if userFromContext(r.Context()).Username != username {
+		http.Error(w, "access denied", http.StatusUnauthorized)
+		return
+	}
+
 	var squeak SqueakPost
 
 	if err := json.NewDecoder(r.Body).Decode(&squeak); err != nil {
@@ -102,13 +602,341 @@ func (u *UserServer) saveSqueak(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err := u.store.PostSqueak(username, squeak.Text)
+	if squeak.OriginalID != nil {
+		u.saveResqueak(w, username, squeak)
+		return
+	}
+
+	// Squeaks carrying media may go without text.
+	if len(squeak.MediaIDs) == 0 || squeak.Text != "" {
+		if err := validateSqueakText(squeak.Text); err != nil {
+			http.Error(w, fmt.Sprint(err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := validateContentFlags(squeak.ContentWarning, squeak.Sensitive, len(squeak.MediaIDs) > 0); err != nil {
+		http.Error(w, fmt.Sprint(err), http.StatusBadRequest)
+		return
+	}
+
+	if squeak.ReplySetting == "" {
+		squeak.ReplySetting = ReplyEveryone
+	}
+	if err := validateReplySetting(squeak.ReplySetting); err != nil {
+		http.Error(w, fmt.Sprint(err), http.StatusBadRequest)
+		return
+	}
+
+	if !u.mediaAttachable(w, userFromContext(r.Context()), squeak.MediaIDs) {
+		return
+	}
+
+	if squeak.Poll != nil {
+		if err := validatePoll(squeak.Poll, time.Now()); err != nil {
+			http.Error(w, fmt.Sprint(err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	id, err := u.store.CreateSqueak(username, SqueakPost{
+		Text: squeak.Text, Poll: squeak.Poll, MediaIDs: squeak.MediaIDs,
+		ContentWarning: squeak.ContentWarning, Sensitive: squeak.Sensitive, ReplySetting: squeak.ReplySetting,
+	})
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if squeak, ok := u.respondWithSqueak(w, id); ok {
+		u.afterSqueakPosted(squeak)
+	}
+}
+
+// prepareSqueaks turns deleted squeaks into tombstones, embeds the originals
+// of resqueaks and adds what depends on the viewer to squeaks before they are
+// shown. Squeaks of users hidden from the viewer by a block or mute, or
+// protected from them, are left out, and originals by them are replaced by
+// tombstones. viewer is nil for anonymous requests.
+func (u *UserServer) prepareSqueaks(viewer *User, squeaks []SqueakPost) ([]SqueakPost, error) {
+	if len(squeaks) == 0 {
+		return squeaks, nil
+	}
+
+	hidden := map[int]bool{}
+	if viewer != nil {
+		var err error
+		if hidden, err = u.store.GetHiddenUsers(viewer.Username); err != nil {
+			return nil, err
+		}
+	}
+
+	authors := make([]int, len(squeaks))
+	for i, squeak := range squeaks {
+		authors[i] = squeak.UserID
+	}
+	if err := u.hideProtected(viewer, hidden, authors); err != nil {
+		return nil, err
+	}
+
+	visible := squeaks[:0]
+	for _, squeak := range squeaks {
+		if hidden[squeak.UserID] {
+			continue
+		}
+		if squeak.Unavailable {
+			deleted := tombstone(squeak.ID)
+			deleted.ParentID, deleted.RootID = squeak.ParentID, squeak.RootID
+			squeak = *deleted
+		}
+		visible = append(visible, squeak)
+	}
+	squeaks = visible
+
+	if err := u.embedOriginals(squeaks); err != nil {
+		return nil, err
+	}
+
+	if err := u.preparePolls(viewer, squeaks); err != nil {
+		return nil, err
+	}
+
+	var originalAuthors []int
+	for _, squeak := range squeaks {
+		if original := squeak.Original; original != nil && !original.Unavailable {
+			originalAuthors = append(originalAuthors, original.UserID)
+		}
+	}
+	if err := u.hideProtected(viewer, hidden, originalAuthors); err != nil {
+		return nil, err
+	}
+
+	for i, squeak := range squeaks {
+		if original := squeak.Original; original != nil && hidden[original.UserID] {
+			squeaks[i].Original = tombstone(original.ID)
+		}
+	}
+
+	if viewer == nil || len(squeaks) == 0 {
+		return squeaks, nil
+	}
+
+	ids := make([]int, len(squeaks))
+	for i, squeak := range squeaks {
+		ids[i] = squeak.ID
+	}
+
+	liked, err := u.store.GetLikedSqueaks(viewer.Username, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range squeaks {
+		likedByMe := liked[squeaks[i].ID]
+		squeaks[i].LikedByMe = &likedByMe
+	}
+
+	return squeaks, nil
+}
+
+// hideProtected adds those of the users ids that are protected from viewer
+// to hidden.
+func (u *UserServer) hideProtected(viewer *User, hidden map[int]bool, ids []int) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	protected, err := u.store.GetProtectedUsers(viewerName(viewer), ids)
+	if err != nil {
+		return err
+	}
+	for id := range protected {
+		hidden[id] = true
+	}
+
+	return nil
+}
+
+// respondWithSqueak answers a request that stored the squeak id with the
+// squeak itself, so clients learn its ID. It returns the squeak unless it
+// could not be loaded.
+func (u *UserServer) respondWithSqueak(w http.ResponseWriter, id int) (SqueakPost, bool) {
+	squeak, err := u.store.GetSqueak(id)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return SqueakPost{}, false
+	}
+
+	// The response has no viewer, so it must not give away poll results.
+	shown := []SqueakPost{*squeak}
+	if err := u.preparePolls(nil, shown); err != nil {
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return SqueakPost{}, false
+	}
+
+	w.Header().Set("Content-Type", jsonContentType)
+	w.WriteHeader(http.StatusAccepted)
+
+	if err := json.NewEncoder(w).Encode(shown[0]); err != nil {
+		log.Println(err)
+	}
+
+	return *squeak, true
+}
+
+// afterSqueakPosted runs once a new squeak is stored, notifying the author
+// of the squeak it replies to and the users it mentions, and publishing it
+// to stream subscribers.
+func (u *UserServer) afterSqueakPosted(squeak SqueakPost) {
+	u.broker.Publish(squeak)
+
+	if squeak.ParentID != nil {
+		parent, err := u.store.GetSqueak(*squeak.ParentID)
+		if err == nil {
+			u.notify(parent.Author, squeak.Author, NotificationReply, &parent.ID)
+		}
+	}
+
+	for _, mention := range squeak.Mentions {
+		u.notify(mention.Username, squeak.Author, NotificationMention, &squeak.ID)
+	}
+}
+
+// squeakIDFromPath parses the {id} wildcard of squeak routes.
+func squeakIDFromPath(r *http.Request) (int, error) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		return 0, errors.New("invalid squeak id")
+	}
+	return id, nil
+}
+
+func (u *UserServer) followUser(w http.ResponseWriter, r *http.Request) {
+	follower := userFromContext(r.Context())
+	followee := r.PathValue("name")
+
+	if follower.Username == followee {
+		http.Error(w, "you cannot follow yourself", http.StatusBadRequest)
+		return
+	}
+
+	profile, err := u.store.GetProfile(followee)
 	if err != nil {
+		http.Error(w, fmt.Sprint(err), http.StatusNotFound)
+		return
+	}
+
+	if !u.allowedToInteract(w, follower.Username, followee) {
+		return
+	}
+
+	if profile.Protected {
+		u.requestFollow(w, follower, followee)
+		return
+	}
+
+	if err := u.store.FollowUser(follower.Username, followee); err != nil {
 		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
 	}
+
+	u.notify(followee, follower.Username, NotificationFollow, nil)
+
+	respondWithFollowStatus(w, FollowStatusFollowing)
+}
+
+func (u *UserServer) unfollowUser(w http.ResponseWriter, r *http.Request) {
+	follower := userFromContext(r.Context())
+	followee := r.PathValue("name")
+
+	if _, err := u.store.GetUserByUsername(followee); err != nil {
+		http.Error(w, fmt.Sprint(err), http.StatusNotFound)
+		return
+	}
+
+	if err := u.store.UnfollowUser(follower.Username, followee); err != nil {
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
 	w.WriteHeader(http.StatusAccepted)
 }
 
+func (u *UserServer) showFollowers(w http.ResponseWriter, r *http.Request) {
+	followers, err := u.store.GetFollowers(r.PathValue("name"))
+	if err != nil {
+		http.Error(w, fmt.Sprint(err), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", jsonContentType)
+
+	if err := json.NewEncoder(w).Encode(newPublicUsers(followers)); err != nil {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (u *UserServer) showFollowing(w http.ResponseWriter, r *http.Request) {
+	following, err := u.store.GetFollowing(r.PathValue("name"))
+	if err != nil {
+		http.Error(w, fmt.Sprint(err), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", jsonContentType)
+
+	if err := json.NewEncoder(w).Encode(newPublicUsers(following)); err != nil {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (u *UserServer) showTimeline(w http.ResponseWriter, r *http.Request) {
+	user := userFromContext(r.Context())
+
+	cursor, limit, err := parsePagination(r)
+	if err != nil {
+		http.Error(w, fmt.Sprint(err), http.StatusBadRequest)
+		return
+	}
+
+	squeaks, err := u.store.GetTimeline(user.Username, cursor, limit+1)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	page := newSqueakPage(squeaks, limit)
+	page.Squeaks, err = u.prepareSqueaks(user, page.Squeaks)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if collapsed, err := u.collapseRequested(r); err != nil {
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	} else if collapsed {
+		collapseFlagged(page.Squeaks)
+	}
+
+	w.Header().Set("Content-Type", jsonContentType)
+
+	if err := json.NewEncoder(w).Encode(page); err != nil {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+}
+
 func (u *UserServer) registerUser(w http.ResponseWriter, r *http.Request) {
 	var user User
 
@@ -177,22 +1005,12 @@ func (u *UserServer) loginUser(w http.ResponseWriter, r *http.Request) {
 
 	loggedUser, _ := u.store.GetUserByUsername(username)
 
-	tokenString, err := generateJWTToken(loggedUser.Username)
-	if err != nil {
-		http.Error(w, "failed to create token", http.StatusBadRequest)
-	}
-
-	cookie := &http.Cookie{
-		Name:     "Authorization",
-		Value:    tokenString,
-		MaxAge:   int(time.Hour * 24 * 30),
-		Secure:   false,
-		HttpOnly: true,
-		SameSite: http.SameSiteLaxMode,
+	if err := u.startSession(w, loggedUser.Username); err != nil {
+		log.Println(err)
+		http.Error(w, "failed to create token", http.StatusInternalServerError)
+		return
 	}
 
-	http.SetCookie(w, cookie)
-
 	w.WriteHeader(http.StatusAccepted)
 }
 
@@ -201,11 +1019,13 @@ type CustomClaims struct {
 	jwt.RegisteredClaims
 }
 
+// generateJWTToken issues a short-lived access token for username, which
+// clients renew through POST /auth/refresh.
 func generateJWTToken(username string) (string, error) {
 	claims := &CustomClaims{
 		Username: username,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour * 24 * 30)),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(accessTokenLifetime)),
 		},
 	}
 
@@ -231,36 +1051,60 @@ func parseJWTToken(cookieValue string) (*CustomClaims, error) {
 	return claims, nil
 }
 
-func (u *UserServer) requiresAuthentication(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+type contextKey string
 
-		cookie, err := r.Cookie("Authorization")
-		if err != nil {
-			http.Error(w, "access denied", http.StatusUnauthorized)
-			return
-		}
+const userContextKey contextKey = "user"
 
-		claims, err := parseJWTToken(cookie.Value)
-		if err != nil {
-            http.Error(w, "access denied", http.StatusUnauthorized)
-            return
-        }
+// userFromContext returns the user that requiresAuthentication or
+// withOptionalAuthentication stored in the request context, or nil.
+func userFromContext(ctx context.Context) *User {
+	user, _ := ctx.Value(userContextKey).(*User)
+	return user
+}
 
-		if time.Now().Unix() > claims.ExpiresAt.Unix() {
-			http.Error(w, "access denied", http.StatusUnauthorized)
-			return
-		}
+// authenticate returns the user whose token is in the Authorization cookie.
+func (u *UserServer) authenticate(r *http.Request) (*User, error) {
+	cookie, err := r.Cookie("Authorization")
+	if err != nil {
+		return nil, err
+	}
+
+	claims, err := parseJWTToken(cookie.Value)
+	if err != nil {
+		return nil, err
+	}
 
-		var userName = claims.Username
-		var usernameFromPath = r.PathValue("name")
+	if claims.ExpiresAt == nil || time.Now().Unix() > claims.ExpiresAt.Unix() {
+		return nil, errors.New("token expired")
+	}
 
-		user, err := u.store.GetUserByUsername(userName)
-		if user == nil || user.Username != usernameFromPath || err != nil {
+	return u.store.GetUserByUsername(claims.Username)
+}
+
+// requiresAuthentication verifies the Authorization cookie and supplies the
+// acting user to the next handler, see userFromContext.
+func (u *UserServer) requiresAuthentication(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, err := u.authenticate(r)
+		if user == nil || err != nil {
 			http.Error(w, "access denied", http.StatusUnauthorized)
 			return
 		}
 
-		ctx := context.WithValue(r.Context(), "user", user)
+		ctx := context.WithValue(r.Context(), userContextKey, user)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
+
+// withOptionalAuthentication supplies the acting user like
+// requiresAuthentication when the request carries a valid token, and lets
+// anonymous requests through with no user in the context.
+func (u *UserServer) withOptionalAuthentication(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, err := u.authenticate(r); user != nil && err == nil {
+			r = r.WithContext(context.WithValue(r.Context(), userContextKey, user))
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -99,7 +99,7 @@ func TestPostingSqueaksAndRetrievingThem(t *testing.T) {
 		server.ServeHTTP(response, newGetSqueakRequest("Harrison"))
 
 		got := getUserSqueaksFromResponse(t, response.Body)
-		want := []SqueakPost{{"Great, kid, don't get cocky.", time.Now()}, {"Laugh it up, fuzzball!", time.Now()}}
+		want := []SqueakPost{{Text: "Great, kid, don't get cocky.", CreatedAt: time.Now()}, {Text: "Laugh it up, fuzzball!", CreatedAt: time.Now()}}
 
 		assertResponse(t, got, want)
 		assertStatus(t, response.Code, http.StatusOK)
@@ -112,7 +112,7 @@ func TestPostingSqueaksAndRetrievingThem(t *testing.T) {
 
 		got := getUserbaseFromResponse(t, response.Body)
 		want := []User{
-			{1, "Harrison", "test", "", []SqueakPost{{"Great, kid, don't get cocky.", time.Now()}, {"Laugh it up, fuzzball!", time.Now()}}, time.Now()},
+			{ID: 1, Username: "Harrison", Email: "test", Squeaks: []SqueakPost{{Text: "Great, kid, don't get cocky.", CreatedAt: time.Now()}, {Text: "Laugh it up, fuzzball!", CreatedAt: time.Now()}}, CreatedAt: time.Now()},
 		}
 
 		if len(got) != len(want) {
@@ -5,17 +5,23 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 )
 
+// StubUserStore embeds UserStore so it satisfies the interface without
+// implementing every method; the tests using it only call the methods below.
 type StubUserStore struct {
-	userbase []User
+	UserStore
+	userbase  []User
+	following map[string][]string
 }
 
 func (s *StubUserStore) CreateUser(name, email, password string) (int, error) {
 	id := len(s.userbase) + 1
-	s.userbase = append(s.userbase, User{id, name, email, password, []SqueakPost{}, time.Now()})
+	s.userbase = append(s.userbase, User{ID: id, Username: name, Email: email, Password: password, Squeaks: []SqueakPost{}, CreatedAt: time.Now()})
 	return id, nil
 }
 
@@ -46,8 +52,27 @@ func (s *StubUserStore) PostSqueak(username, squeak string) (int, error) {
 	if err != nil {
 		return 0, fmt.Errorf("error getting user: %s", err)
 	}
-	user.Squeaks = append(user.Squeaks, SqueakPost{squeak, time.Now()})
-	return user.ID, nil
+	id := 1
+	for _, u := range s.userbase {
+		id += len(u.Squeaks)
+	}
+	user.Squeaks = append(user.Squeaks, SqueakPost{ID: id, UserID: user.ID, Author: username, Text: squeak, CreatedAt: time.Now()})
+	return id, nil
+}
+
+func (s *StubUserStore) CreateSqueak(author string, squeak SqueakPost) (int, error) {
+	return s.PostSqueak(author, squeak.Text)
+}
+
+func (s *StubUserStore) GetSqueak(id int) (*SqueakPost, error) {
+	for _, user := range s.userbase {
+		for _, squeak := range user.Squeaks {
+			if squeak.ID == id {
+				return &squeak, nil
+			}
+		}
+	}
+	return nil, ErrSqueakNotFound
 }
 
 func (s *StubUserStore) GetUserSqueaks(name string) ([]SqueakPost, error) {
@@ -58,10 +83,81 @@ func (s *StubUserStore) GetUserSqueaks(name string) ([]SqueakPost, error) {
 	return user.Squeaks, nil
 }
 
+func (s *StubUserStore) CreateRefreshToken(name, family, hash string, expiresAt time.Time) error {
+	return nil
+}
+
+func (s *StubUserStore) GetProfile(name string) (*Profile, error) {
+	user, err := s.GetUserByUsername(name)
+	if err != nil {
+		return nil, err
+	}
+	return &Profile{User: *user}, nil
+}
+
 func (s *StubUserStore) GetUserbase() ([]User, error) {
 	return s.userbase, nil
 }
 
+func (s *StubUserStore) FollowUser(follower, followee string) error {
+	if s.following == nil {
+		s.following = map[string][]string{}
+	}
+	if slices.Contains(s.following[follower], followee) {
+		return nil
+	}
+	s.following[follower] = append(s.following[follower], followee)
+	return nil
+}
+
+func (s *StubUserStore) UnfollowUser(follower, followee string) error {
+	s.following[follower] = slices.DeleteFunc(s.following[follower], func(name string) bool {
+		return name == followee
+	})
+	return nil
+}
+
+func (s *StubUserStore) GetFollowers(name string) ([]User, error) {
+	if _, err := s.GetUserByUsername(name); err != nil {
+		return nil, err
+	}
+	followers := []User{}
+	for _, user := range s.userbase {
+		if slices.Contains(s.following[user.Username], name) {
+			followers = append(followers, User{ID: user.ID, Username: user.Username})
+		}
+	}
+	return followers, nil
+}
+
+func (s *StubUserStore) GetFollowing(name string) ([]User, error) {
+	if _, err := s.GetUserByUsername(name); err != nil {
+		return nil, err
+	}
+	following := []User{}
+	for _, followee := range s.following[name] {
+		user, _ := s.GetUserByUsername(followee)
+		following = append(following, User{ID: user.ID, Username: user.Username})
+	}
+	return following, nil
+}
+
+func (s *StubUserStore) AddNotification(name, actor, kind string, squeakID *int) error {
+	return nil
+}
+
+func (s *StubUserStore) IsBlocked(name, other string) (bool, error) {
+	return false, nil
+}
+
+func (s *StubUserStore) GetHiddenUsers(name string) (map[int]bool, error) {
+	return map[int]bool{}, nil
+}
+
+func (s *StubUserStore) GetProtectedUsers(name string, ids []int) (map[int]bool, error) {
+	return map[int]bool{}, nil
+}
+
 func TestAuthentication(t *testing.T) {
 	store := StubUserStore{}
 	server := NewUserServer(&store)
@@ -87,7 +183,7 @@ func TestAuthentication(t *testing.T) {
 
 		got := getUserbaseFromResponse(t, response.Body)
 		want := []User{
-			{1, "Carrie", "test", "", []SqueakPost{}, time.Now()},
+			{ID: 1, Username: "Carrie", Email: "test", Squeaks: []SqueakPost{}, CreatedAt: time.Now()},
 		}
 
 		assertUserbase(t, got, want)
@@ -145,7 +241,7 @@ email already taken
 
 func TestStoreNewSqueaks(t *testing.T) {
 	store := StubUserStore{
-		[]User{{1, "Mark", "", "", []SqueakPost{}, time.Now()}},
+		userbase: []User{{ID: 1, Username: "Mark", Squeaks: []SqueakPost{}, CreatedAt: time.Now()}},
 	}
 	server := NewUserServer(&store)
 
@@ -177,16 +273,16 @@ func TestStoreNewSqueaks(t *testing.T) {
 
 		got, err := store.GetUserSqueaks("Mark")
 
-		assertResponse(t, got, []SqueakPost{{"Let go of your hate.", time.Now()}})
+		assertResponse(t, got, []SqueakPost{{Text: "Let go of your hate.", CreatedAt: time.Now()}})
 		assertNoError(t, err)
 	})
 }
 
 func TestGETSqueaks(t *testing.T) {
 	store := StubUserStore{
-		[]User{
-			{1, "Mark", "", "", []SqueakPost{{"I don't believe it!", time.Now()}}, time.Now()},
-			{2, "Harrison", "", "", []SqueakPost{{"Great, kid, don't get cocky.", time.Now()}, {"Laugh it up, fuzzball!", time.Now()}}, time.Now()},
+		userbase: []User{
+			{ID: 1, Username: "Mark", Squeaks: []SqueakPost{{Text: "I don't believe it!", CreatedAt: time.Now()}}, CreatedAt: time.Now()},
+			{ID: 2, Username: "Harrison", Squeaks: []SqueakPost{{Text: "Great, kid, don't get cocky.", CreatedAt: time.Now()}, {Text: "Laugh it up, fuzzball!", CreatedAt: time.Now()}}, CreatedAt: time.Now()},
 		},
 	}
 	server := NewUserServer(&store)
@@ -200,7 +296,7 @@ func TestGETSqueaks(t *testing.T) {
 		got := getUserSqueaksFromResponse(t, response.Body)
 
 		assertStatus(t, response.Code, http.StatusOK)
-		assertResponse(t, got, []SqueakPost{{"I don't believe it!", time.Now()}})
+		assertResponse(t, got, []SqueakPost{{Text: "I don't believe it!", CreatedAt: time.Now()}})
 		assertContentType(t, response, jsonContentType)
 	})
 	t.Run("returns Harrison's squeaks", func(t *testing.T) {
@@ -212,7 +308,7 @@ func TestGETSqueaks(t *testing.T) {
 		got := getUserSqueaksFromResponse(t, response.Body)
 
 		assertStatus(t, response.Code, http.StatusOK)
-		assertResponse(t, got, []SqueakPost{{"Great, kid, don't get cocky.", time.Now()}, {"Laugh it up, fuzzball!", time.Now()}})
+		assertResponse(t, got, []SqueakPost{{Text: "Great, kid, don't get cocky.", CreatedAt: time.Now()}, {Text: "Laugh it up, fuzzball!", CreatedAt: time.Now()}})
 		assertContentType(t, response, jsonContentType)
 	})
 	t.Run("returns 404 on missing user", func(t *testing.T) {
@@ -229,12 +325,12 @@ func TestUserbase(t *testing.T) {
 
 	t.Run("it returns the user base as JSON", func(t *testing.T) {
 		wantedUserbase := []User{
-			{1, "Mark", "", "", []SqueakPost{{"I don't believe it!", time.Now()}}, time.Now()},
-			{2, "Harrison", "", "", []SqueakPost{{"I have a bad feeling about this.", time.Now()}, {"Great, kid, don't get cocky.", time.Now()}}, time.Now()},
-			{3, "Carrie", "", "", []SqueakPost{{"Will somebody get this big walking carpet out of my way?", time.Now()}}, time.Now()},
+			{ID: 1, Username: "Mark", Squeaks: []SqueakPost{{Text: "I don't believe it!", CreatedAt: time.Now()}}, CreatedAt: time.Now()},
+			{ID: 2, Username: "Harrison", Squeaks: []SqueakPost{{Text: "I have a bad feeling about this.", CreatedAt: time.Now()}, {Text: "Great, kid, don't get cocky.", CreatedAt: time.Now()}}, CreatedAt: time.Now()},
+			{ID: 3, Username: "Carrie", Squeaks: []SqueakPost{{Text: "Will somebody get this big walking carpet out of my way?", CreatedAt: time.Now()}}, CreatedAt: time.Now()},
 		}
 
-		store := StubUserStore{wantedUserbase}
+		store := StubUserStore{userbase: wantedUserbase}
 		server := NewUserServer(&store)
 
 		request := newUserbaseRequest()
@@ -249,3 +345,139 @@ func TestUserbase(t *testing.T) {
 		assertContentType(t, response, jsonContentType)
 	})
 }
+
+func TestFollow(t *testing.T) {
+	store := StubUserStore{
+		userbase: []User{
+			{ID: 1, Username: "Mark", Squeaks: []SqueakPost{}, CreatedAt: time.Now()},
+			{ID: 2, Username: "Harrison", Squeaks: []SqueakPost{}, CreatedAt: time.Now()},
+		},
+	}
+	server := NewUserServer(&store)
+
+	token, _ := generateJWTToken("Mark")
+
+	t.Run("it requires authentication to follow", func(t *testing.T) {
+		request := newFollowRequest(http.MethodPost, "Harrison", "")
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusUnauthorized)
+	})
+	t.Run("Mark follows Harrison", func(t *testing.T) {
+		request := newFollowRequest(http.MethodPost, "Harrison", token)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusAccepted)
+
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, newFollowListRequest("Harrison", "followers"))
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertContentType(t, response, jsonContentType)
+
+		body := response.Body.String()
+		for _, private := range []string{`"email"`, `"password"`, `"squeaks"`} {
+			if strings.Contains(body, private) {
+				t.Errorf("followers list %s, want it without %s", body, private)
+			}
+		}
+		assertUsernames(t, getUsersFromResponse(t, strings.NewReader(body)), []string{"Mark"})
+
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, newFollowListRequest("Mark", "following"))
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertUsernames(t, getUsersFromResponse(t, response.Body), []string{"Harrison"})
+	})
+	t.Run("it rejects following yourself", func(t *testing.T) {
+		request := newFollowRequest(http.MethodPost, "Mark", token)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusBadRequest)
+	})
+	t.Run("returns 404 when following missing user", func(t *testing.T) {
+		request := newFollowRequest(http.MethodPost, "Carrie", token)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusNotFound)
+	})
+	t.Run("Mark unfollows Harrison", func(t *testing.T) {
+		request := newFollowRequest(http.MethodDelete, "Harrison", token)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusAccepted)
+
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, newFollowListRequest("Harrison", "followers"))
+
+		assertUsernames(t, getUsersFromResponse(t, response.Body), []string{})
+	})
+	t.Run("it does not let users post on someone else's behalf", func(t *testing.T) {
+		body := []byte(`{"text": "I know."}`)
+		request := newPostSqueakRequestWithJWT("Harrison", body, token)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusUnauthorized)
+	})
+}
+
+func TestTimeline(t *testing.T) {
+	store := NewInMemoryUserStore()
+	server := NewUserServer(store)
+
+	store.CreateUser("Mark", "mark@test", "")
+	store.CreateUser("Harrison", "harrison@test", "")
+	store.CreateUser("Carrie", "carrie@test", "")
+	store.PostSqueak("Harrison", "Great, kid, don't get cocky.")
+	store.PostSqueak("Carrie", "Will somebody get this big walking carpet out of my way?")
+	store.PostSqueak("Mark", "I don't believe it!")
+	store.PostSqueak("Harrison", "Laugh it up, fuzzball!")
+	store.FollowUser("Mark", "Harrison")
+
+	token, _ := generateJWTToken("Mark")
+
+	t.Run("it requires authentication", func(t *testing.T) {
+		request, _ := http.NewRequest(http.MethodGet, "/timeline", nil)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusUnauthorized)
+	})
+	t.Run("returns own and followed squeaks newest first, page by page", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newTimelineRequest("", token))
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertContentType(t, response, jsonContentType)
+
+		page := getSqueakPageFromResponse(t, response.Body)
+		assertSqueaks(t, page.Squeaks, []SqueakPost{{Text: "Laugh it up, fuzzball!"}, {Text: "I don't believe it!"}})
+		assertEqual(t, page.NextCursor, "3")
+
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, newTimelineRequest(page.NextCursor, token))
+
+		page = getSqueakPageFromResponse(t, response.Body)
+		assertSqueaks(t, page.Squeaks, []SqueakPost{{Text: "Great, kid, don't get cocky."}})
+		assertEqual(t, page.NextCursor, "")
+	})
+	t.Run("rejects an invalid cursor", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newTimelineRequest("abc", token))
+
+		assertStatus(t, response.Code, http.StatusBadRequest)
+	})
+}
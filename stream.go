@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	maxStreamUsers = 100
+	// streamKeepAlive is how often an idle stream sends a comment, so
+	// proxies do not close the connection.
+	streamKeepAlive = 30 * time.Second
+)
+
+// parseStreamUsers resolves the comma separated usernames of the users query
+// parameter.
+func (u *UserServer) parseStreamUsers(r *http.Request) ([]string, []int, int, error) {
+	var names []string
+	for _, name := range strings.Split(r.URL.Query().Get("users"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+
+	if len(names) == 0 || len(names) > maxStreamUsers {
+		return nil, nil, http.StatusBadRequest, fmt.Errorf("users must list between 1 and %d usernames", maxStreamUsers)
+	}
+
+	ids := make([]int, len(names))
+	for i, name := range names {
+		user, err := u.store.GetUserByUsername(name)
+		if err != nil {
+			return nil, nil, http.StatusNotFound, err
+		}
+		ids[i] = user.ID
+	}
+
+	return names, ids, 0, nil
+}
+
+// streamSqueaks pushes the squeaks of the users listed in the users query
+// parameter as Server-Sent Events. Each event's ID is the squeak ID, so a
+// client reconnecting with Last-Event-ID first receives what it missed.
+func (u *UserServer) streamSqueaks(w http.ResponseWriter, r *http.Request) {
+	viewer := userFromContext(r.Context())
+
+	names, ids, status, err := u.parseStreamUsers(r)
+	if err != nil {
+		http.Error(w, fmt.Sprint(err), status)
+		return
+	}
+
+	lastID := 0
+	if value := r.Header.Get("Last-Event-ID"); value != "" {
+		lastID, err = strconv.Atoi(value)
+		if err != nil || lastID < 0 {
+			http.Error(w, "Last-Event-ID must be a squeak ID", http.StatusBadRequest)
+			return
+		}
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	// Subscribe before catching up, so nothing posted in between is lost.
+	squeaks, cancel := u.broker.Subscribe(ids)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	// lastID is the newest squeak handled, sent or hidden from viewer, so a
+	// squeak pushed while catching up is not sent twice.
+	send := func(squeak SqueakPost) bool {
+		if squeak.ID <= lastID {
+			return true
+		}
+		lastID = squeak.ID
+
+		prepared, err := u.prepareSqueaks(viewer, []SqueakPost{squeak})
+		if err != nil {
+			log.Println(err)
+			return false
+		}
+		if len(prepared) == 0 {
+			return true
+		}
+
+		data, err := json.Marshal(prepared[0])
+		if err != nil {
+			log.Println(err)
+			return false
+		}
+
+		if _, err := fmt.Fprintf(w, "id: %d\nevent: squeak\ndata: %s\n\n", squeak.ID, data); err != nil {
+			return false
+		}
+		flusher.Flush()
+
+		return true
+	}
+
+	// fetchedID pages through the missed squeaks independently of what send
+	// lets through.
+	for fetchedID := lastID; fetchedID > 0; {
+		if r.Context().Err() != nil {
+			return
+		}
+
+		missed, err := u.store.GetSqueaksAfter(names, fetchedID, maxPageSize)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		for _, squeak := range missed {
+			fetchedID = squeak.ID
+			if !send(squeak) {
+				return
+			}
+		}
+		if len(missed) < maxPageSize {
+			break
+		}
+	}
+
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case squeak, ok := <-squeaks:
+			if !ok || !send(squeak) {
+				return
+			}
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
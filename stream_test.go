@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readEvent reads the next Server-Sent Event, skipping comments.
+func readEvent(t testing.TB, reader *bufio.Reader) (id string, squeak SqueakPost) {
+	t.Helper()
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading event: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+
+		switch {
+		case strings.HasPrefix(line, "id: "):
+			id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "data: "):
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &squeak); err != nil {
+				t.Fatal(err)
+			}
+		case line == "" && id != "":
+			return id, squeak
+		}
+	}
+}
+
+func TestStream(t *testing.T) {
+	store := NewInMemoryUserStore()
+	server := NewUserServer(store)
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+
+	store.CreateUser("Mark", "mark@test", "")
+	store.CreateUser("Harrison", "harrison@test", "")
+	store.CreateUser("Carrie", "carrie@test", "")
+	first, _ := store.PostSqueak("Mark", "Seen before disconnecting")
+	store.PostSqueak("Carrie", "Not followed")
+	store.PostSqueak("Harrison", "Also missed")
+
+	carrieToken, _ := generateJWTToken("Carrie")
+	harrisonToken, _ := generateJWTToken("Harrison")
+
+	openStream := func(t *testing.T, query, lastEventID string) *http.Response {
+		t.Helper()
+		request, _ := http.NewRequest(http.MethodGet, httpServer.URL+"/stream?"+query, nil)
+		request.Header.Set("Cookie", "Authorization="+carrieToken)
+		if lastEventID != "" {
+			request.Header.Set("Last-Event-ID", lastEventID)
+		}
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return response
+	}
+
+	t.Run("it requires authentication", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		request, _ := http.NewRequest(http.MethodGet, "/stream?users=Mark", nil)
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusUnauthorized)
+	})
+	t.Run("rejects missing and unknown users", func(t *testing.T) {
+		response := openStream(t, "", "")
+		response.Body.Close()
+		assertStatus(t, response.StatusCode, http.StatusBadRequest)
+
+		response = openStream(t, "users=Mark,Nobody", "")
+		response.Body.Close()
+		assertStatus(t, response.StatusCode, http.StatusNotFound)
+	})
+	t.Run("replays missed squeaks then pushes new ones", func(t *testing.T) {
+		response := openStream(t, "users=Mark,Harrison", strconv.Itoa(first))
+		defer response.Body.Close()
+
+		assertStatus(t, response.StatusCode, http.StatusOK)
+		assertEqual(t, response.Header.Get("Content-Type"), "text/event-stream")
+
+		reader := bufio.NewReader(response.Body)
+
+		id, squeak := readEvent(t, reader)
+		assertEqual(t, squeak.Text, "Also missed")
+		assertEqual(t, id, "3")
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			body := strings.NewReader(`{"text": "Live from the Falcon"}`)
+			request, _ := http.NewRequest(http.MethodPost, httpServer.URL+"/users/Harrison", body)
+			request.Header.Set("Cookie", "Authorization="+harrisonToken)
+			if response, err := http.DefaultClient.Do(request); err == nil {
+				response.Body.Close()
+			}
+		}()
+
+		result := make(chan SqueakPost)
+		go func() {
+			_, squeak := readEvent(t, reader)
+			result <- squeak
+		}()
+
+		select {
+		case squeak := <-result:
+			assertEqual(t, squeak.Text, "Live from the Falcon")
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for the pushed squeak")
+		}
+		<-done
+	})
+}
+
+func TestStreamSkipsPagesOfHiddenSqueaks(t *testing.T) {
+	store := NewInMemoryUserStore()
+	server := NewUserServer(store)
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+
+	store.CreateUser("Mark", "mark@test", "")
+	store.CreateUser("Harrison", "harrison@test", "")
+	store.CreateUser("Carrie", "carrie@test", "")
+	store.MuteUser("Carrie", "Harrison")
+
+	first, _ := store.PostSqueak("Mark", "Seen before disconnecting")
+	for i := 0; i < maxPageSize; i++ {
+		store.PostSqueak("Harrison", "Muted")
+	}
+	want, _ := store.PostSqueak("Mark", "Missed")
+
+	carrieToken, _ := generateJWTToken("Carrie")
+
+	request, _ := http.NewRequest(http.MethodGet, httpServer.URL+"/stream?users=Mark,Harrison", nil)
+	request.Header.Set("Cookie", "Authorization="+carrieToken)
+	request.Header.Set("Last-Event-ID", strconv.Itoa(first))
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+
+	result := make(chan string)
+	go func() {
+		id, _ := readEvent(t, bufio.NewReader(response.Body))
+		result <- id
+	}()
+
+	select {
+	case id := <-result:
+		assertEqual(t, id, strconv.Itoa(want))
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the squeak after the hidden ones")
+	}
+}
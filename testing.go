@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -17,7 +18,7 @@ func newPostSqueakRequest(name string, body []byte) *http.Request {
 
 func newPostSqueakRequestWithJWT(name string, body []byte, token string) *http.Request {
 	req, _ := http.NewRequest(http.MethodPost, fmt.Sprintf("/users/%s", name), bytes.NewBuffer(body))
-	req.Header.Set("Cookie", "Authorization=" + token)
+	req.Header.Set("Cookie", "Authorization="+token)
 	return req
 }
 
@@ -26,6 +27,53 @@ func newGetSqueakRequest(name string) *http.Request {
 	return req
 }
 
+func newFollowRequest(method, name, token string) *http.Request {
+	req, _ := http.NewRequest(method, fmt.Sprintf("/users/%s/follow", name), nil)
+	if token != "" {
+		req.Header.Set("Cookie", "Authorization="+token)
+	}
+	return req
+}
+
+func newFollowListRequest(name, list string) *http.Request {
+	req, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("/users/%s/%s", name, list), nil)
+	return req
+}
+
+func newTimelineRequest(cursor, token string) *http.Request {
+	req, _ := http.NewRequest(http.MethodGet, "/timeline?limit=2&cursor="+cursor, nil)
+	req.Header.Set("Cookie", "Authorization="+token)
+	return req
+}
+
+func newReplyRequest(id int, body []byte, token string) *http.Request {
+	req, _ := http.NewRequest(http.MethodPost, fmt.Sprintf("/squeaks/%d/replies", id), bytes.NewBuffer(body))
+	if token != "" {
+		req.Header.Set("Cookie", "Authorization="+token)
+	}
+	return req
+}
+
+func newLikeRequest(method string, id int, token string) *http.Request {
+	req, _ := http.NewRequest(method, fmt.Sprintf("/squeaks/%d/like", id), nil)
+	if token != "" {
+		req.Header.Set("Cookie", "Authorization="+token)
+	}
+	return req
+}
+
+func newEditSqueakRequest(method string, id int, body []byte, token string) *http.Request {
+	req, _ := http.NewRequest(method, fmt.Sprintf("/squeaks/%d", id), bytes.NewBuffer(body))
+	if token != "" {
+		req.Header.Set("Cookie", "Authorization="+token)
+	}
+	return req
+}
+
+func textEdit(text string) SqueakEdit {
+	return SqueakEdit{Text: &text}
+}
+
 func newUserbaseRequest() *http.Request {
 	req, _ := http.NewRequest(http.MethodGet, "/userbase", nil)
 	return req
@@ -42,6 +90,17 @@ func getUserbaseFromResponse(t testing.TB, body io.Reader) (userbase []User) {
 	return
 }
 
+func getUsersFromResponse(t testing.TB, body io.Reader) (users []User) {
+	t.Helper()
+
+	err := json.NewDecoder(body).Decode(&users)
+	if err != nil {
+		t.Fatalf("Unable to parse response from server %q into slice of User, '%v'", body, err)
+	}
+
+	return
+}
+
 func getUserSqueaksFromResponse(t testing.TB, body io.Reader) (userSqueaks []SqueakPost) {
 	t.Helper()
 
@@ -53,6 +112,17 @@ func getUserSqueaksFromResponse(t testing.TB, body io.Reader) (userSqueaks []Squ
 	return
 }
 
+func getSqueakPageFromResponse(t testing.TB, body io.Reader) (page SqueakPage) {
+	t.Helper()
+
+	err := json.NewDecoder(body).Decode(&page)
+	if err != nil {
+		t.Fatalf("Unable to parse response from server %q into SqueakPage, '%v'", body, err)
+	}
+
+	return
+}
+
 func assertResponse(t testing.TB, got, want []SqueakPost) {
 	t.Helper()
 
@@ -86,7 +156,21 @@ func assertUserbase(t testing.TB, got, want []User) {
 			got[i].Username != want[i].Username ||
 			got[i].Email != want[i].Email ||
 			!squeaksEqual(got[i].Squeaks, want[i].Squeaks) {
-				t.Errorf("user at index %d does not match: got %+v, want %+v", i, got[i], want[i])
+			t.Errorf("user at index %d does not match: got %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func assertUsernames(t testing.TB, got []User, want []string) {
+	t.Helper()
+
+	if len(got) != len(want) {
+		t.Fatalf("users count mismatch: got %d want %d", len(got), len(want))
+	}
+
+	for i := range got {
+		if got[i].Username != want[i] {
+			t.Errorf("username at index %d does not match: got %q, want %q", i, got[i].Username, want[i])
 		}
 	}
 }
@@ -146,3 +230,150 @@ func assertNoError(t testing.TB, err error) {
 		t.Fatalf("didn't expect an error but got one, %v", err)
 	}
 }
+
+func newMentionsRequest(cursor, token string) *http.Request {
+	req, _ := http.NewRequest(http.MethodGet, "/me/mentions?limit=2&cursor="+cursor, nil)
+	if token != "" {
+		req.Header.Set("Cookie", "Authorization="+token)
+	}
+	return req
+}
+
+func newNotificationsRequest(query, token string) *http.Request {
+	req, _ := http.NewRequest(http.MethodGet, "/notifications?"+query, nil)
+	if token != "" {
+		req.Header.Set("Cookie", "Authorization="+token)
+	}
+	return req
+}
+
+func newMarkReadRequest(body []byte, token string) *http.Request {
+	req, _ := http.NewRequest(http.MethodPost, "/notifications/read", bytes.NewBuffer(body))
+	if token != "" {
+		req.Header.Set("Cookie", "Authorization="+token)
+	}
+	return req
+}
+
+func getNotificationPageFromResponse(t testing.TB, body io.Reader) (page NotificationPage) {
+	t.Helper()
+
+	err := json.NewDecoder(body).Decode(&page)
+	if err != nil {
+		t.Fatalf("Unable to parse response from server %q into NotificationPage, '%v'", body, err)
+	}
+
+	return
+}
+
+func newConversationRequest(method, path string, body []byte, token string) *http.Request {
+	req, _ := http.NewRequest(method, "/conversations"+path, bytes.NewBuffer(body))
+	if token != "" {
+		req.Header.Set("Cookie", "Authorization="+token)
+	}
+	return req
+}
+
+func newRelationRequest(method, name, relation, token string) *http.Request {
+	req, _ := http.NewRequest(method, fmt.Sprintf("/users/%s/%s", name, relation), nil)
+	if token != "" {
+		req.Header.Set("Cookie", "Authorization="+token)
+	}
+	return req
+}
+
+func newBookmarkRequest(method string, id int, token string) *http.Request {
+	req, _ := http.NewRequest(method, fmt.Sprintf("/squeaks/%d/bookmark", id), nil)
+	if token != "" {
+		req.Header.Set("Cookie", "Authorization="+token)
+	}
+	return req
+}
+
+func newBookmarksRequest(cursor, token string) *http.Request {
+	req, _ := http.NewRequest(http.MethodGet, "/bookmarks?limit=2&cursor="+cursor, nil)
+	if token != "" {
+		req.Header.Set("Cookie", "Authorization="+token)
+	}
+	return req
+}
+
+func getBookmarkPageFromResponse(t testing.TB, body io.Reader) (page BookmarkPage) {
+	t.Helper()
+
+	err := json.NewDecoder(body).Decode(&page)
+	if err != nil {
+		t.Fatalf("Unable to parse response from server %q into BookmarkPage, '%v'", body, err)
+	}
+
+	return
+}
+
+func newListRequest(method, path string, body []byte, token string) *http.Request {
+	req, _ := http.NewRequest(method, path, bytes.NewBuffer(body))
+	if token != "" {
+		req.Header.Set("Cookie", "Authorization="+token)
+	}
+	return req
+}
+
+func newVoteRequest(id int, body []byte, token string) *http.Request {
+	req, _ := http.NewRequest(http.MethodPost, fmt.Sprintf("/squeaks/%d/vote", id), bytes.NewBuffer(body))
+	if token != "" {
+		req.Header.Set("Cookie", "Authorization="+token)
+	}
+	return req
+}
+
+func newUploadRequest(data []byte, token string) *http.Request {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, _ := form.CreateFormFile("file", "upload")
+	part.Write(data)
+	form.Close()
+
+	req, _ := http.NewRequest(http.MethodPost, "/media", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	if token != "" {
+		req.Header.Set("Cookie", "Authorization="+token)
+	}
+	return req
+}
+
+func newDraftRequest(method, path string, body []byte, token string) *http.Request {
+	req, _ := http.NewRequest(method, "/drafts"+path, bytes.NewBuffer(body))
+	if token != "" {
+		req.Header.Set("Cookie", "Authorization="+token)
+	}
+	return req
+}
+
+func newProfileRequest(method, path string, body []byte, token string) *http.Request {
+	req, _ := http.NewRequest(method, path, bytes.NewBuffer(body))
+	if token != "" {
+		req.Header.Set("Cookie", "Authorization="+token)
+	}
+	return req
+}
+
+func newPinRequest(method string, id int, token string) *http.Request {
+	req, _ := http.NewRequest(method, fmt.Sprintf("/squeaks/%d/pin", id), nil)
+	if token != "" {
+		req.Header.Set("Cookie", "Authorization="+token)
+	}
+	return req
+}
+
+func newFollowRequestsRequest(method, path, token string) *http.Request {
+	return newAuthenticatedRequest(method, "/me/follow-requests"+path, nil, token)
+}
+
+// newAuthenticatedRequest builds a request carrying token in the
+// Authorization cookie, or an anonymous one when token is empty.
+func newAuthenticatedRequest(method, path string, body []byte, token string) *http.Request {
+	req, _ := http.NewRequest(method, path, bytes.NewBuffer(body))
+	if token != "" {
+		req.Header.Set("Cookie", "Authorization="+token)
+	}
+	return req
+}
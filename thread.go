@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+)
+
+const (
+	defaultThreadDepth = 5
+	maxThreadDepth     = 20
+)
+
+// ThreadNode is a squeak together with its replies, nested up to the
+// requested depth. MoreReplies tells that replies were cut off by the limit.
+type ThreadNode struct {
+	SqueakPost
+	Replies     []*ThreadNode `json:"replies,omitempty"`
+	MoreReplies bool          `json:"moreReplies,omitempty"`
+}
+
+// Thread is the conversation around one squeak: the chain of squeaks it
+// replies to, starting at the root, and the tree of replies below it.
+type Thread struct {
+	Ancestors []SqueakPost `json:"ancestors"`
+	Squeak    *ThreadNode  `json:"squeak"`
+}
+
+// buildThread arranges the squeaks of a conversation into the thread of
+// squeak id, descending at most depth levels of replies.
+func buildThread(conversation []SqueakPost, id, depth int) Thread {
+	squeaks := make(map[int]SqueakPost, len(conversation))
+	replies := make(map[int][]SqueakPost)
+	for _, squeak := range conversation {
+		squeaks[squeak.ID] = squeak
+		if squeak.ParentID != nil {
+			replies[*squeak.ParentID] = append(replies[*squeak.ParentID], squeak)
+		}
+	}
+
+	thread := Thread{Ancestors: []SqueakPost{}}
+	for parent := squeaks[id].ParentID; parent != nil; parent = squeaks[*parent].ParentID {
+		ancestor, ok := squeaks[*parent]
+		if !ok {
+			break
+		}
+		thread.Ancestors = append([]SqueakPost{ancestor}, thread.Ancestors...)
+	}
+
+	var build func(squeak SqueakPost, depth int) *ThreadNode
+	build = func(squeak SqueakPost, depth int) *ThreadNode {
+		node := &ThreadNode{SqueakPost: squeak}
+		if depth == 0 {
+			node.MoreReplies = len(replies[squeak.ID]) > 0
+			return node
+		}
+		for _, reply := range replies[squeak.ID] {
+			node.Replies = append(node.Replies, build(reply, depth-1))
+		}
+		return node
+	}
+	thread.Squeak = build(squeaks[id], depth)
+
+	return thread
+}
+
+func (u *UserServer) postReply(w http.ResponseWriter, r *http.Request) {
+	user := userFromContext(r.Context())
+
+	parentID, err := squeakIDFromPath(r)
+	if err != nil {
+		http.Error(w, fmt.Sprint(err), http.StatusBadRequest)
+		return
+	}
+
+	var reply SqueakPost
+
+	if err := json.NewDecoder(r.Body).Decode(&reply); err != nil {
+		http.Error(w, "failed to decode JSON payload", http.StatusBadRequest)
+		return
+	}
+
+	if err := validateSqueakText(reply.Text); err != nil {
+		http.Error(w, fmt.Sprint(err), http.StatusBadRequest)
+		return
+	}
+
+	parent, err := u.store.GetSqueak(parentID)
+	if err != nil {
+		if errors.Is(err, ErrSqueakNotFound) {
+			http.Error(w, fmt.Sprint(err), http.StatusNotFound)
+			return
+		}
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if !u.visibleTo(w, user.Username, parent) || !u.allowedToInteract(w, user.Username, parent.Author) {
+		return
+	}
+
+	if !u.allowedToReply(w, user, parent) {
+		return
+	}
+
+	id, err := u.store.PostReply(user.Username, parentID, reply.Text)
+	if err != nil {
+		if errors.Is(err, ErrSqueakNotFound) {
+			http.Error(w, fmt.Sprint(err), http.StatusNotFound)
+			return
+		}
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if squeak, ok := u.respondWithSqueak(w, id); ok {
+		u.afterSqueakPosted(squeak)
+	}
+}
+
+func (u *UserServer) showThread(w http.ResponseWriter, r *http.Request) {
+	id, err := squeakIDFromPath(r)
+	if err != nil {
+		http.Error(w, fmt.Sprint(err), http.StatusBadRequest)
+		return
+	}
+
+	depth := defaultThreadDepth
+	if value := r.URL.Query().Get("depth"); value != "" {
+		depth, err = strconv.Atoi(value)
+		if err != nil || depth < 0 || depth > maxThreadDepth {
+			http.Error(w, fmt.Sprintf("depth must be between 0 and %d", maxThreadDepth), http.StatusBadRequest)
+			return
+		}
+	}
+
+	squeak, err := u.store.GetSqueak(id)
+	if err != nil {
+		if errors.Is(err, ErrSqueakNotFound) {
+			http.Error(w, fmt.Sprint(err), http.StatusNotFound)
+			return
+		}
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if !u.visibleTo(w, viewerName(userFromContext(r.Context())), squeak) {
+		return
+	}
+
+	rootID := squeak.ID
+	if squeak.RootID != nil {
+		rootID = *squeak.RootID
+	}
+
+	conversation, err := u.store.GetConversation(rootID)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	conversation, err = u.prepareSqueaks(userFromContext(r.Context()), conversation)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if !slices.ContainsFunc(conversation, func(squeak SqueakPost) bool { return squeak.ID == id }) {
+		http.Error(w, fmt.Sprint(ErrSqueakNotFound), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", jsonContentType)
+
+	if err := json.NewEncoder(w).Encode(buildThread(conversation, id, depth)); err != nil {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+}
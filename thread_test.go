@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBuildThread(t *testing.T) {
+	one, two, three := 1, 2, 3
+	conversation := []SqueakPost{
+		{ID: 1, Text: "root"},
+		{ID: 2, Text: "reply", ParentID: &one, RootID: &one},
+		{ID: 3, Text: "nested reply", ParentID: &two, RootID: &one},
+		{ID: 4, Text: "second reply", ParentID: &one, RootID: &one},
+		{ID: 5, Text: "deep reply", ParentID: &three, RootID: &one},
+	}
+
+	t.Run("nests replies under their parents", func(t *testing.T) {
+		thread := buildThread(conversation, 1, defaultThreadDepth)
+
+		assertSqueaks(t, thread.Ancestors, []SqueakPost{})
+		assertEqual(t, len(thread.Squeak.Replies), 2)
+		assertEqual(t, thread.Squeak.Replies[0].Replies[0].Text, "nested reply")
+		assertEqual(t, thread.Squeak.Replies[1].Text, "second reply")
+	})
+	t.Run("cuts off replies below the depth limit", func(t *testing.T) {
+		thread := buildThread(conversation, 1, 1)
+
+		nested := thread.Squeak.Replies[0]
+		assertEqual(t, len(nested.Replies), 0)
+		assertEqual(t, nested.MoreReplies, true)
+		assertEqual(t, thread.Squeak.Replies[1].MoreReplies, false)
+	})
+	t.Run("lists the ancestors of a reply from the root down", func(t *testing.T) {
+		thread := buildThread(conversation, 5, defaultThreadDepth)
+
+		assertSqueaks(t, thread.Ancestors, []SqueakPost{{Text: "root"}, {Text: "reply"}, {Text: "nested reply"}})
+		assertEqual(t, thread.Squeak.Text, "deep reply")
+	})
+}
+
+func TestReplies(t *testing.T) {
+	store := NewInMemoryUserStore()
+	server := NewUserServer(store)
+
+	store.CreateUser("Mark", "mark@test", "")
+	store.CreateUser("Harrison", "harrison@test", "")
+	rootID, _ := store.PostSqueak("Mark", "I have a bad feeling about this.")
+
+	token, _ := generateJWTToken("Harrison")
+
+	t.Run("it requires authentication to reply", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newReplyRequest(rootID, []byte(`{"text": "Don't get cocky."}`), ""))
+
+		assertStatus(t, response.Code, http.StatusUnauthorized)
+	})
+	t.Run("it saves a reply and returns it", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newReplyRequest(rootID, []byte(`{"text": "Don't get cocky."}`), token))
+
+		assertStatus(t, response.Code, http.StatusAccepted)
+
+		var reply SqueakPost
+		if err := json.NewDecoder(response.Body).Decode(&reply); err != nil {
+			t.Fatal(err)
+		}
+		assertEqual(t, reply.Author, "Harrison")
+		assertEqual(t, *reply.ParentID, rootID)
+		assertEqual(t, *reply.RootID, rootID)
+	})
+	t.Run("returns 404 when replying to a missing squeak", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newReplyRequest(42, []byte(`{"text": "Hello?"}`), token))
+
+		assertStatus(t, response.Code, http.StatusNotFound)
+	})
+	t.Run("rejects an empty reply", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newReplyRequest(rootID, []byte(`{"text": " "}`), token))
+
+		assertStatus(t, response.Code, http.StatusBadRequest)
+	})
+	t.Run("returns the thread of a squeak", func(t *testing.T) {
+		request, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("/squeaks/%d/thread", rootID), nil)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertContentType(t, response, jsonContentType)
+
+		var thread Thread
+		if err := json.NewDecoder(response.Body).Decode(&thread); err != nil {
+			t.Fatal(err)
+		}
+		assertEqual(t, thread.Squeak.Text, "I have a bad feeling about this.")
+		assertSqueaks(t, []SqueakPost{thread.Squeak.Replies[0].SqueakPost}, []SqueakPost{{Text: "Don't get cocky."}})
+	})
+	t.Run("rejects a depth over the limit", func(t *testing.T) {
+		request, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("/squeaks/%d/thread?depth=100", rootID), nil)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusBadRequest)
+	})
+}